@@ -0,0 +1,261 @@
+// Package client give typed access to the api of terraform-secure-backend
+package client
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrStateNotFound is given when a tfstate does not exist
+var ErrStateNotFound = errors.New("tfstate does not exist")
+
+// State is a tfstate as given when listing
+type State struct {
+	CredhubName      string    `json:"credhub_name"`
+	Name             string    `json:"name"`
+	VersionCreatedAt string    `json:"version_created_at"`
+	IsLocked         bool      `json:"is_locked"`
+	CurrentLockId    string    `json:"current_lock_id,omitempty"`
+	CurrentLock      *LockInfo `json:"current_lock,omitempty"`
+	Parts            int       `json:"parts,omitempty"`
+}
+
+// LockInfo is a lock as sent by terraform
+type LockInfo struct {
+	ID        string
+	Operation string
+	Info      string
+	Who       string
+	Version   string
+	Created   time.Time
+	Path      string
+}
+
+// ListOptions filter, sort and paginate tfstates when listing, zero values are ignored
+type ListOptions struct {
+	Prefix        string
+	Locked        *bool
+	UpdatedBefore time.Time
+	// WithLockInfo fill current lock of locked tfstates
+	WithLockInfo bool
+	// Sort is `name` or `updated_at`, prefixed by `-` for descending order
+	Sort   string
+	Limit  int
+	Cursor string
+}
+
+// Error is a problem given back by the api
+type Error struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail"`
+	Instance  string `json:"instance"`
+	RequestId string `json:"request_id"`
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("%d %s", e.Status, e.Title)
+	if e.Detail != "" {
+		msg += ": " + e.Detail
+	}
+	if e.RequestId != "" {
+		msg += fmt.Sprintf(" (request id: %s)", e.RequestId)
+	}
+	return msg
+}
+
+// LockedError is given when a tfstate is locked by another lock
+type LockedError struct {
+	Lock LockInfo
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("tfstate is locked by '%s' (operation: '%s', who: '%s')", e.Lock.ID, e.Lock.Operation, e.Lock.Who)
+}
+
+type Client struct {
+	endpoint   string
+	username   string
+	password   string
+	httpClient *http.Client
+}
+
+// NewClient give a client for the backend at endpoint (e.g.: https://my.backend.com),
+// username can be empty if backend has no authentication and http.DefaultClient is used if httpClient is nil
+func NewClient(endpoint, username, password string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{
+		endpoint:   strings.TrimSuffix(endpoint, "/"),
+		username:   username,
+		password:   password,
+		httpClient: httpClient,
+	}
+}
+
+// Get give content of a tfstate, ErrStateNotFound is given if it does not exist
+func (c *Client) Get(name string) ([]byte, error) {
+	resp, err := c.do("GET", c.statePath(name), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNoContent {
+		return nil, ErrStateNotFound
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// Put store content of a tfstate
+func (c *Client) Put(name string, data []byte) error {
+	sum := md5.Sum(data)
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	header.Set("Content-MD5", base64.StdEncoding.EncodeToString(sum[:]))
+	return c.doAndClose("POST", c.statePath(name), header, data)
+}
+
+// Delete a tfstate, it is moved to trash unless hard is true
+func (c *Client) Delete(name string, hard bool) error {
+	path := c.statePath(name)
+	if hard {
+		path += "?hard=true"
+	}
+	return c.doAndClose("DELETE", path, nil, nil)
+}
+
+// Lock a tfstate, a *LockedError is given if it's already locked
+func (c *Client) Lock(name string, info LockInfo) error {
+	return c.lockOperation("LOCK", name, info)
+}
+
+// Unlock a tfstate, a *LockedError is given if it's locked with another lock
+func (c *Client) Unlock(name string, info LockInfo) error {
+	return c.lockOperation("UNLOCK", name, info)
+}
+
+// ForceUnlock release the lock held on a tfstate whatever its id
+func (c *Client) ForceUnlock(name string) error {
+	return c.doAndClose("UNLOCK", c.statePath(name)+"?force=true", nil, nil)
+}
+
+func (c *Client) lockOperation(method, name string, info LockInfo) error {
+	b, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	return c.doAndClose(method, c.statePath(name), header, b)
+}
+
+// List give tfstates and cursor to next page, cursor is empty on last page
+func (c *Client) List(opts ListOptions) ([]State, string, error) {
+	params := url.Values{}
+	if opts.Prefix != "" {
+		params.Set("prefix", opts.Prefix)
+	}
+	if opts.Locked != nil {
+		params.Set("locked", strconv.FormatBool(*opts.Locked))
+	}
+	if opts.WithLockInfo {
+		params.Set("with_lock_info", "true")
+	}
+	if !opts.UpdatedBefore.IsZero() {
+		params.Set("updated_before", opts.UpdatedBefore.Format(time.RFC3339))
+	}
+	if opts.Sort != "" {
+		params.Set("sort", opts.Sort)
+	}
+	if opts.Limit > 0 {
+		params.Set("limit", strconv.Itoa(opts.Limit))
+	}
+	if opts.Cursor != "" {
+		params.Set("cursor", opts.Cursor)
+	}
+	path := "/states"
+	if len(params) > 0 {
+		path += "?" + params.Encode()
+	}
+	resp, err := c.do("GET", path, nil, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	states := make([]State, 0)
+	err = json.NewDecoder(resp.Body).Decode(&states)
+	if err != nil {
+		return nil, "", err
+	}
+	return states, resp.Header.Get("X-Next-Cursor"), nil
+}
+
+func (c *Client) statePath(name string) string {
+	return "/states/" + url.PathEscape(name)
+}
+
+func (c *Client) doAndClose(method, path string, header http.Header, body []byte) error {
+	resp, err := c.do(method, path, header, body)
+	if err != nil {
+		return err
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	return resp.Body.Close()
+}
+
+// do send request and give an error when api answers with an error status code
+func (c *Client) do(method, path string, header http.Header, body []byte) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, c.endpoint+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 400 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	b, _ := ioutil.ReadAll(resp.Body)
+	isProblem := strings.HasPrefix(resp.Header.Get("Content-Type"), "application/problem+json")
+	isLockConflict := resp.StatusCode == http.StatusLocked || (resp.StatusCode == http.StatusConflict && (method == "LOCK" || method == "UNLOCK"))
+	if isLockConflict && !isProblem {
+		lockErr := &LockedError{}
+		if json.Unmarshal(b, &lockErr.Lock) == nil {
+			return nil, lockErr
+		}
+	}
+	apiErr := &Error{}
+	if json.Unmarshal(b, apiErr) != nil || apiErr.Status == 0 {
+		apiErr = &Error{
+			Status: resp.StatusCode,
+			Title:  http.StatusText(resp.StatusCode),
+			Detail: strings.TrimSpace(string(b)),
+		}
+	}
+	return nil, apiErr
+}
@@ -0,0 +1,135 @@
+package client_test
+
+import (
+	"encoding/json"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/orange-cloudfoundry/terraform-secure-backend/client"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+)
+
+var _ = Describe("Client", func() {
+	var server *httptest.Server
+	var handler http.HandlerFunc
+	var lastReq *http.Request
+	var lastBody []byte
+	var client *Client
+	BeforeEach(func() {
+		handler = func(w http.ResponseWriter, req *http.Request) {}
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			lastReq = req
+			lastBody, _ = ioutil.ReadAll(req.Body)
+			handler(w, req)
+		}))
+		client = NewClient(server.URL+"/", "user", "password", nil)
+	})
+	AfterEach(func() {
+		server.Close()
+	})
+	Context("Get", func() {
+		It("should give tfstate content", func() {
+			handler = func(w http.ResponseWriter, req *http.Request) {
+				w.Write([]byte(`{"version": 4}`))
+			}
+			b, err := client.Get("foo")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(b)).To(Equal(`{"version": 4}`))
+			Expect(lastReq.Method).To(Equal("GET"))
+			Expect(lastReq.URL.Path).To(Equal("/states/foo"))
+			username, password, _ := lastReq.BasicAuth()
+			Expect(username).To(Equal("user"))
+			Expect(password).To(Equal("password"))
+		})
+		It("should give ErrStateNotFound when tfstate does not exist", func() {
+			handler = func(w http.ResponseWriter, req *http.Request) {
+				w.WriteHeader(http.StatusNoContent)
+			}
+			_, err := client.Get("foo")
+			Expect(err).To(Equal(ErrStateNotFound))
+		})
+		It("should give problem sent by api as error", func() {
+			handler = func(w http.ResponseWriter, req *http.Request) {
+				w.Header().Set("Content-Type", "application/problem+json")
+				w.WriteHeader(http.StatusBadGateway)
+				w.Write([]byte(`{"type": "about:blank", "title": "Bad Gateway", "status": 502, "request_id": "my-id"}`))
+			}
+			_, err := client.Get("foo")
+			Expect(err).To(HaveOccurred())
+			apiErr, ok := err.(*Error)
+			Expect(ok).To(BeTrue())
+			Expect(apiErr.Status).To(Equal(http.StatusBadGateway))
+			Expect(apiErr.RequestId).To(Equal("my-id"))
+		})
+	})
+	Context("Put", func() {
+		It("should send tfstate with its md5", func() {
+			err := client.Put("foo", []byte(`{"version": 4}`))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(lastReq.Method).To(Equal("POST"))
+			Expect(string(lastBody)).To(Equal(`{"version": 4}`))
+			Expect(lastReq.Header.Get("Content-MD5")).To(Equal("Ujug8oz/DB09QwZJuRIfqQ=="))
+		})
+	})
+	Context("Delete", func() {
+		It("should ask for hard delete when asked", func() {
+			err := client.Delete("foo", true)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(lastReq.Method).To(Equal("DELETE"))
+			Expect(lastReq.URL.Query().Get("hard")).To(Equal("true"))
+		})
+	})
+	Context("Lock and Unlock", func() {
+		It("should send lock info", func() {
+			err := client.Lock("foo", LockInfo{ID: "my-lock"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(lastReq.Method).To(Equal("LOCK"))
+			var info LockInfo
+			Expect(json.Unmarshal(lastBody, &info)).To(Succeed())
+			Expect(info.ID).To(Equal("my-lock"))
+
+			err = client.Unlock("foo", LockInfo{ID: "my-lock"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(lastReq.Method).To(Equal("UNLOCK"))
+		})
+		It("should force unlock without lock info", func() {
+			err := client.ForceUnlock("foo")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(lastReq.Method).To(Equal("UNLOCK"))
+			Expect(lastReq.URL.Query().Get("force")).To(Equal("true"))
+			Expect(lastBody).To(BeEmpty())
+		})
+		It("should give current lock when tfstate is already locked", func() {
+			handler = func(w http.ResponseWriter, req *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusLocked)
+				w.Write([]byte(`{"ID": "other-lock", "Who": "someone"}`))
+			}
+			err := client.Lock("foo", LockInfo{ID: "my-lock"})
+			Expect(err).To(HaveOccurred())
+			lockErr, ok := err.(*LockedError)
+			Expect(ok).To(BeTrue())
+			Expect(lockErr.Lock.ID).To(Equal("other-lock"))
+		})
+	})
+	Context("List", func() {
+		It("should send options and give tfstates with cursor to next page", func() {
+			handler = func(w http.ResponseWriter, req *http.Request) {
+				w.Header().Set("X-Next-Cursor", "next")
+				w.Write([]byte(`[{"name": "foo", "is_locked": true, "current_lock_id": "id"}]`))
+			}
+			locked := true
+			states, cursor, err := client.List(ListOptions{Prefix: "f", Locked: &locked, WithLockInfo: true, Limit: 1})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(lastReq.URL.Path).To(Equal("/states"))
+			Expect(lastReq.URL.Query().Get("prefix")).To(Equal("f"))
+			Expect(lastReq.URL.Query().Get("locked")).To(Equal("true"))
+			Expect(lastReq.URL.Query().Get("with_lock_info")).To(Equal("true"))
+			Expect(lastReq.URL.Query().Get("limit")).To(Equal("1"))
+			Expect(cursor).To(Equal("next"))
+			Expect(states).To(HaveLen(1))
+			Expect(states[0].CurrentLockId).To(Equal("id"))
+		})
+	})
+})
@@ -1,17 +1,22 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/gorilla/mux"
 	"github.com/hashicorp/terraform/state"
+	"github.com/orange-cloudfoundry/terraform-secure-backend/server/auth"
 	"github.com/orange-cloudfoundry/terraform-secure-backend/server/credhub"
+	"github.com/orange-cloudfoundry/terraform-secure-backend/server/metrics"
 	"github.com/orange-cloudfoundry/terraform-secure-backend/server/storer"
-	"github.com/sirupsen/logrus"
+	"github.com/orange-cloudfoundry/terraform-secure-backend/server/tfstate"
+	"github.com/orange-cloudfoundry/terraform-secure-backend/server/webhook"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"strings"
+	"time"
 )
 
 type ApiController struct {
@@ -19,10 +24,164 @@ type ApiController struct {
 	storer        storer.Storer
 	store         *LockStore
 	credhubClient credhub.CredhubClient
+	trash         *Trash
+	notifier      *webhook.Notifier
+	tenant        string
+	allowlist     *IpAllowlist
+	protections   *ProtectionStore
+	permissions   *PermissionSyncer
 }
 
-func NewApiController(basePath string, credhubClient credhub.CredhubClient, storer storer.Storer, store *LockStore) *ApiController {
-	return &ApiController{basePath, storer, store, credhubClient}
+func NewApiController(basePath string, credhubClient credhub.CredhubClient, storer storer.Storer, store *LockStore, trash *Trash, notifier *webhook.Notifier) *ApiController {
+	return &ApiController{basePath, storer, store, credhubClient, trash, notifier, "", nil, nil, nil}
+}
+
+// WithContext give a controller which traces its calls to storer and credhub as children of span found in ctx
+func (c ApiController) WithContext(ctx context.Context) ApiController {
+	protections := c.protections
+	if protections != nil {
+		protections = protections.WithContext(ctx)
+	}
+	return ApiController{
+		basePath:      c.basePath,
+		storer:        storer.WithContext(c.storer, ctx),
+		store:         c.store.WithContext(ctx),
+		credhubClient: credhub.WithContext(c.credhubClient, ctx),
+		trash:         c.trash.WithContext(ctx),
+		notifier:      c.notifier,
+		tenant:        c.tenant,
+		allowlist:     c.allowlist,
+		protections:   protections,
+		permissions:   c.permissions.WithContext(ctx),
+	}
+}
+
+// WithTenant give a controller which tells tenant name in webhook events
+func (c ApiController) WithTenant(tenant string) *ApiController {
+	c.tenant = tenant
+	return &c
+}
+
+// WithIpAllowlist give a controller which refuses tfstates to clients not allowed by allowlist
+func (c ApiController) WithIpAllowlist(allowlist *IpAllowlist) *ApiController {
+	c.allowlist = allowlist
+	return &c
+}
+
+// WithProtections give a controller which refuses to modify protected tfstates without approval
+func (c ApiController) WithProtections(protections *ProtectionStore) *ApiController {
+	c.protections = protections
+	return &c
+}
+
+// WithPermissions give a controller which grants credhub permissions from config on tfstates it creates
+func (c ApiController) WithPermissions(permissions *PermissionSyncer) *ApiController {
+	c.permissions = permissions
+	return &c
+}
+
+// grantPermissions give credhub permissions from config on a created tfstate,
+// tfstate is already stored so a failure is only logged, permissions are granted again on next startup
+func (c ApiController) grantPermissions(req *http.Request, name string) {
+	err := c.permissions.Grant(name)
+	if err != nil {
+		RequestLogger(req).WithField("action", "permissions-sync").WithField("name", name).Warn(err)
+	}
+}
+
+// authorizeProtected give a forbidden problem when tfstate is protected and caller has not protected right,
+// didn't send a valid approval token and doesn't hold a lock acquired with an approval.
+// Approval token sent is marked used.
+func (c ApiController) authorizeProtected(req *http.Request, name string) error {
+	token, err := c.protectedToken(req, name, false)
+	if err != nil || token == "" {
+		return err
+	}
+	_, err = c.protections.UseApproval(req, token, name, "")
+	return approvalError(name, err)
+}
+
+// protectedToken give approval token which must be used to modify tfstate, it is empty when no approval is needed.
+// When locking, a lock already held doesn't approve anything.
+func (c ApiController) protectedToken(req *http.Request, name string, locking bool) (string, error) {
+	if c.protections == nil {
+		return "", nil
+	}
+	protected, err := c.protections.IsProtected(name)
+	if err != nil {
+		return "", err
+	}
+	if !protected || auth.FromContext(req.Context()).Can(auth.RightProtected, name) {
+		return "", nil
+	}
+	entry := RequestLogger(req).WithField("action", "authorize").WithField("name", name)
+	// lock held is checked first as terraform sends approval given in address again with the lock id
+	heldLockId := req.URL.Query().Get("ID")
+	if heldLockId != "" && !locking {
+		info, locked := c.store.IsLocked(fmt.Sprintf("%s/%s", c.basePath, name))
+		if locked && info.ID == heldLockId {
+			approved, err := c.protections.LockApproved(name, heldLockId, identityName(req))
+			if err != nil {
+				return "", err
+			}
+			if approved {
+				entry.Debugf("Lock '%s' has been acquired with an approval", heldLockId)
+				return "", nil
+			}
+		}
+	}
+	if token := approvalToken(req); token != "" {
+		return token, nil
+	}
+	entry.Warnf("'%s' needs an approval to modify protected tfstate", identityName(req))
+	return "", NewProblem(http.StatusForbidden, fmt.Sprintf("Tfstate '%s' is protected, an approval token or the protected right is needed to modify it", name))
+}
+
+func approvalError(name string, err error) error {
+	if err == ErrInvalidApproval {
+		return NewProblem(http.StatusForbidden, fmt.Sprintf("Approval token is invalid, expired or already used for tfstate '%s'", name))
+	}
+	return err
+}
+
+// authorize give a forbidden problem when caller doesn't have right on tfstate or its ip is not allowed to access it,
+// names starting with a dot are refused as they are reserved for backend data (trash, tokens, approvals)
+func (c ApiController) authorize(req *http.Request, right, name string) error {
+	if strings.HasPrefix(name, ".") {
+		return NewProblem(http.StatusBadRequest, fmt.Sprintf("Tfstate name '%s' is reserved, names must not start with '.'", name))
+	}
+	if !c.allowlist.AllowState(remoteIp(req), name) {
+		RequestLogger(req).WithField("action", "authorize").WithField("name", name).
+			Warnf("Client ip '%s' is not allowed", remoteIp(req))
+		return NewProblem(http.StatusForbidden, fmt.Sprintf("Your ip address is not allowed to access tfstate '%s'", name))
+	}
+	if auth.FromContext(req.Context()).Can(right, name) {
+		return nil
+	}
+	RequestLogger(req).WithField("action", "authorize").WithField("name", name).
+		Warnf("'%s' is not allowed to %s", identityName(req), right)
+	return NewProblem(http.StatusForbidden, fmt.Sprintf("You are not allowed to %s tfstate '%s'", right, name))
+}
+
+// identityName give name of the caller, empty when anonymous
+func identityName(req *http.Request) string {
+	identity := auth.FromContext(req.Context())
+	if identity == nil {
+		return ""
+	}
+	return identity.Name
+}
+
+// notify send event on tfstate to webhooks
+func (c ApiController) notify(req *http.Request, event, name string, info *state.LockInfo) {
+	c.notifier.Notify(webhook.Event{
+		Event:     event,
+		State:     name,
+		Tenant:    c.tenant,
+		User:      identityName(req),
+		RequestId: RequestId(req.Context()),
+		Lock:      info,
+	})
 }
 
 type CredModel struct {
@@ -31,84 +190,224 @@ type CredModel struct {
 	VersionCreatedAt string `json:"version_created_at" yaml:"version_created_at"`
 	IsLocked         bool   `json:"is_locked"`
 	CurrentLockId    string `json:"current_lock_id,omitempty"`
+	// CurrentLock give details of the lock, it is set only when listing
+	CurrentLock *state.LockInfo `json:"current_lock,omitempty"`
+	// Parts is the number of chunks tfstate is stored into
+	Parts int `json:"parts,omitempty"`
 }
 
-func (c ApiController) Store(w http.ResponseWriter, req *http.Request) {
+func (c ApiController) Store(w http.ResponseWriter, req *http.Request) error {
 	defer req.Body.Close()
-	entry := logrus.WithField("action", "store").WithField("name", c.RequestName(req))
+	entry := RequestLogger(req).WithField("action", "store").WithField("name", c.RequestName(req))
 	entry.Debug("Storing tfstate")
-	err := c.storer.Store(c.CredhubName(req), req.Body)
+	if err := c.authorize(req, auth.RightWrite, c.RequestName(req)); err != nil {
+		return err
+	}
+	if err := c.authorizeProtected(req, c.RequestName(req)); err != nil {
+		return err
+	}
+	var body io.ReadCloser = req.Body
+	var md5Reader *ContentMD5Reader
+	if contentMD5 := req.Header.Get("Content-MD5"); contentMD5 != "" {
+		var err error
+		md5Reader, err = NewContentMD5Reader(req.Body, contentMD5)
+		if err != nil {
+			return NewProblem(http.StatusBadRequest, err.Error())
+		}
+		body = md5Reader
+	}
+	if ifMatch := req.Header.Get("If-Match"); ifMatch != "" {
+		hash, err := c.storer.Hash(c.CredhubName(req))
+		if err != nil && !strings.Contains(err.Error(), "does not exist") {
+			entry.Error(err)
+			return err
+		}
+		if err != nil || !MatchETag(ifMatch, ETag(hash), false) {
+			entry.Debug("Precondition failed")
+			return NewProblem(http.StatusPreconditionFailed, "Tfstate has been modified since it was retrieved")
+		}
+	}
+	created := false
+	if c.permissions != nil {
+		exists, err := c.stateExists(c.CredhubName(req))
+		if err != nil {
+			entry.Error(err)
+			return err
+		}
+		created = !exists
+	}
+	err := c.storer.Store(c.CredhubName(req), body)
+	if md5Reader != nil && md5Reader.Mismatch() {
+		// storers may not give back the error of body, md5 reader knows what happened
+		if err != nil {
+			entry.Warn(err)
+		}
+		return NewProblem(http.StatusBadRequest, md5Reader.MismatchError().Error())
+	}
 	if err != nil {
 		entry.Error(err)
-		panic(err)
+		return err
+	}
+	c.notify(req, webhook.EventStore, c.RequestName(req), nil)
+	if created {
+		c.grantPermissions(req, c.RequestName(req))
+	}
+	hash, err := c.storer.Hash(c.CredhubName(req))
+	if err == nil && hash != "" {
+		w.Header().Set("ETag", ETag(hash))
 	}
+	return nil
 }
 
-func (c ApiController) Retrieve(w http.ResponseWriter, req *http.Request) {
+func (c ApiController) Retrieve(w http.ResponseWriter, req *http.Request) error {
 	defer req.Body.Close()
-	entry := logrus.WithField("action", "retrieve").WithField("name", c.RequestName(req))
+	entry := RequestLogger(req).WithField("action", "retrieve").WithField("name", c.RequestName(req))
 	entry.Debug("Retrieving tfstate")
-	r, err := c.storer.Retrieve(c.CredhubName(req))
+	if err := c.authorize(req, auth.RightRead, c.RequestName(req)); err != nil {
+		return err
+	}
+	stateStorer := c.storer
+	switch view := req.URL.Query().Get("view"); view {
+	case "":
+	case "redacted":
+		stateStorer = storer.NewRedact(c.storer)
+	default:
+		return NewProblem(http.StatusBadRequest, fmt.Sprintf("Unknown view '%s', only 'redacted' is available", view))
+	}
+	hash, err := stateStorer.Hash(c.CredhubName(req))
+	if err != nil && strings.Contains(err.Error(), "does not exist") {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	if err != nil {
+		entry.Error(err)
+		return err
+	}
+	if hash != "" {
+		etag := ETag(hash)
+		w.Header().Set("ETag", etag)
+		if MatchETag(req.Header.Get("If-None-Match"), etag, true) {
+			w.WriteHeader(http.StatusNotModified)
+			return nil
+		}
+	}
+	r, err := stateStorer.Retrieve(c.CredhubName(req))
 	if err != nil && strings.Contains(err.Error(), "does not exist") {
 		w.WriteHeader(http.StatusNoContent)
-		return
+		return nil
 	}
 	if err != nil {
 		entry.Error(err)
-		panic(err)
+		return err
 	}
 	defer r.Close()
+	// state is read fully before answering as storers may only fail at the end of data, e.g. on md5 mismatch
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		entry.Error(err)
+		return err
+	}
 	w.Header().Set("Content-Type", "application/json")
-	io.Copy(w, r)
+	_, err = w.Write(data)
+	if err != nil {
+		entry.Warnf("Could not send tfstate: %s", err.Error())
+	}
+	return nil
 }
 
-func (c ApiController) Delete(w http.ResponseWriter, req *http.Request) {
+func (c ApiController) Delete(w http.ResponseWriter, req *http.Request) error {
 	defer req.Body.Close()
 	path := c.CredhubName(req)
-	entry := logrus.WithField("action", "delete").WithField("name", c.RequestName(req))
-	entry.Debug("Deleting tfstate")
-	err := c.storer.Delete(path)
+	entry := RequestLogger(req).WithField("action", "delete").WithField("name", c.RequestName(req))
+	hard := req.URL.Query().Get("hard") == "true"
+	right := auth.RightWrite
+	if hard {
+		right = auth.RightAdmin
+	}
+	err := c.authorize(req, right, c.RequestName(req))
+	if err != nil {
+		return err
+	}
+	err = c.authorizeProtected(req, c.RequestName(req))
+	if err != nil {
+		return err
+	}
+	if hard {
+		entry.Debug("Deleting tfstate")
+		err = c.storer.Delete(path)
+	} else {
+		entry.Debug("Moving tfstate to trash")
+		_, err = c.trash.Put(path, c.RequestName(req), entry)
+	}
 	if err != nil {
 		entry.Error(err)
-		panic(err)
+		return err
 	}
+	c.notify(req, webhook.EventDelete, c.RequestName(req), nil)
 	err = c.store.DeleteLock(path)
 	if err != nil {
 		entry.Error(err)
-		panic(err)
+		return err
 	}
+	return nil
 }
 
-func (c ApiController) Lock(w http.ResponseWriter, req *http.Request) {
+func (c ApiController) Lock(w http.ResponseWriter, req *http.Request) error {
 	defer req.Body.Close()
 	var info *state.LockInfo
 	name := c.CredhubName(req)
-	entry := logrus.WithField("action", "lock").WithField("name", c.RequestName(req))
+	entry := RequestLogger(req).WithField("action", "lock").WithField("name", c.RequestName(req))
 	entry.Debug("Locking tfstate")
+	if err := c.authorize(req, auth.RightLock, c.RequestName(req)); err != nil {
+		return err
+	}
 	info, locked := c.store.IsLocked(name)
 	if locked {
 		entry.Debug("Already locked")
-		w.WriteHeader(http.StatusLocked)
+		metrics.Locks.WithLabelValues("lock", "conflict").Inc()
 		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusLocked)
 		w.Write(info.Marshal())
-		return
+		return nil
 	}
 	b, err := ioutil.ReadAll(req.Body)
 	if err != nil {
 		entry.Error(err)
-		panic(err)
+		return err
 	}
 	info = &state.LockInfo{}
 	err = json.Unmarshal(b, info)
 	if err != nil {
-		entry.Error(err)
-		panic(err)
+		entry.Warn(err)
+		return NewProblem(http.StatusBadRequest, "Invalid lock info given").WithCause(err)
+	}
+	token, err := c.protectedToken(req, c.RequestName(req), true)
+	if err != nil {
+		return err
+	}
+	// approval is checked before locking but only marked used once lock is acquired
+	if token != "" {
+		_, err = c.protections.CheckApproval(req, token, c.RequestName(req))
+		if err != nil {
+			return approvalError(c.RequestName(req), err)
+		}
 	}
 	err = c.store.Lock(name, info)
 	if err != nil {
 		entry.Error(err)
-		panic(err)
+		return err
+	}
+	if token != "" {
+		_, err = c.protections.UseApproval(req, token, c.RequestName(req), info.ID)
+		if err != nil {
+			entry.Warn(err)
+			c.store.UnLock(name, info)
+			return approvalError(c.RequestName(req), err)
+		}
 	}
+	metrics.Locks.WithLabelValues("lock", "acquired").Inc()
+	c.notify(req, webhook.EventLock, c.RequestName(req), info)
+	return nil
 }
 
 func (c ApiController) CredhubName(req *http.Request) string {
@@ -120,70 +419,381 @@ func (c ApiController) RequestName(req *http.Request) string {
 	return vars["name"]
 }
 
-func (c ApiController) UnLock(w http.ResponseWriter, req *http.Request) {
+// UnLock release the lock if lock info with the same id is given,
+// any lock is released without checking lock info when `force` parameter is set to true
+func (c ApiController) UnLock(w http.ResponseWriter, req *http.Request) error {
 	defer req.Body.Close()
 	var info *state.LockInfo
 	name := c.CredhubName(req)
-	entry := logrus.WithField("action", "unlock").WithField("name", c.RequestName(req))
+	force := req.URL.Query().Get("force") == "true"
+	entry := RequestLogger(req).WithField("action", "unlock").WithField("name", c.RequestName(req))
+	right := auth.RightLock
+	if force {
+		entry = entry.WithField("action", "force-unlock")
+		right = auth.RightAdmin
+	}
 	entry.Debug("Unlocking tfstate")
+	if err := c.authorize(req, right, c.RequestName(req)); err != nil {
+		return err
+	}
+	currentInfo, locked := c.store.IsLocked(name)
+	if force {
+		if !locked {
+			return nil
+		}
+		err := c.store.UnLock(name, currentInfo)
+		if err != nil {
+			entry.Error(err)
+			return err
+		}
+		entry.Infof("Lock '%s' held by '%s' has been forced", currentInfo.ID, currentInfo.Who)
+		metrics.Locks.WithLabelValues("unlock", "forced").Inc()
+		c.notify(req, webhook.EventForceUnlock, c.RequestName(req), currentInfo)
+		return nil
+	}
 	b, err := ioutil.ReadAll(req.Body)
 	if err != nil {
 		entry.Error(err)
-		panic(err)
+		return err
 	}
 	info = &state.LockInfo{}
 	err = json.Unmarshal(b, info)
 	if err != nil {
-		entry.Error(err)
-		panic(err)
+		entry.Warn(err)
+		return NewProblem(http.StatusBadRequest, "Invalid lock info given").WithCause(err)
 	}
-	currentInfo, locked := c.store.IsLocked(name)
 	if locked && currentInfo.ID != info.ID {
-		w.WriteHeader(http.StatusConflict)
+		metrics.Locks.WithLabelValues("unlock", "conflict").Inc()
 		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
 		w.Write(currentInfo.Marshal())
-		return
+		return nil
 	}
 	err = c.store.UnLock(name, info)
 	if err != nil {
 		entry.Error(err)
-		panic(err)
+		return err
+	}
+	metrics.Locks.WithLabelValues("unlock", "released").Inc()
+	if locked {
+		c.notify(req, webhook.EventUnlock, c.RequestName(req), currentInfo)
 	}
+	return nil
 }
 
-func (c ApiController) List(w http.ResponseWriter, req *http.Request) {
-	entry := logrus.WithField("action", "list")
+// List give one entry per tfstate, they can be filtered with `prefix`, `locked` and `updated_before` parameters,
+// sorted with `sort` and paginated with `limit` and `cursor`, cursor to next page is given in `X-Next-Cursor` header
+func (c ApiController) List(w http.ResponseWriter, req *http.Request) error {
+	entry := RequestLogger(req).WithField("action", "list")
+	query, err := ParseListQuery(req.URL.Query())
+	if err != nil {
+		return NewProblem(http.StatusBadRequest, err.Error())
+	}
 	result, err := c.credhubClient.FindByPath(c.basePath)
 	if err != nil {
 		entry.Error(err)
-		panic(err)
+		return err
+	}
+	identity := auth.FromContext(req.Context())
+	visibles := make([]CredModel, 0)
+	for _, model := range groupStates(c.basePath, result.Credentials) {
+		if identity.Can(auth.RightRead, model.Name) && c.allowlist.AllowState(remoteIp(req), model.Name) {
+			visibles = append(visibles, model)
+		}
 	}
-	creds := result.Credentials
-	backendCreds := make([]CredModel, 0)
-	for _, cred := range creds {
-		name := cred.Name
-		if strings.HasSuffix(name, LOCK_SUFFIX) {
+	backendCreds, nextCursor := query.Apply(visibles)
+	for i, cred := range backendCreds {
+		if !query.WithLockInfo || !cred.IsLocked {
 			continue
 		}
-		info, locked := c.store.IsLocked(name)
-		lockId := ""
+		info, locked := c.store.IsLocked(cred.CredhubName)
+		backendCreds[i].IsLocked = locked
 		if info != nil {
-			lockId = info.ID
+			backendCreds[i].CurrentLockId = info.ID
+			backendCreds[i].CurrentLock = info
 		}
-		backendCreds = append(backendCreds, CredModel{
-			Name:             ParseTfName(name),
-			CredhubName:      cred.Name,
-			VersionCreatedAt: cred.VersionCreatedAt,
-			IsLocked:         locked,
-			CurrentLockId:    lockId,
-		})
+	}
+	if nextCursor != "" {
+		next := *req.URL
+		params := next.Query()
+		params.Set("cursor", nextCursor)
+		next.RawQuery = params.Encode()
+		w.Header().Set("X-Next-Cursor", nextCursor)
+		w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, next.RequestURI()))
 	}
 	w.Header().Set("Content-Type", "application/json")
 	b, _ := json.MarshalIndent(backendCreds, "", "\t")
 	w.Write(b)
+	return nil
 }
 
 func ParseTfName(credhubName string) string {
 	splited := strings.Split(credhubName, "/")
 	return splited[len(splited)-1]
 }
+
+func (c ApiController) Versions(w http.ResponseWriter, req *http.Request) error {
+	defer req.Body.Close()
+	entry := RequestLogger(req).WithField("action", "versions").WithField("name", c.RequestName(req))
+	entry.Debug("Listing tfstate versions")
+	if err := c.authorize(req, auth.RightRead, c.RequestName(req)); err != nil {
+		return err
+	}
+	versions, err := c.storer.Versions(c.CredhubName(req))
+	if err != nil {
+		entry.Error(err)
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	b, _ := json.MarshalIndent(versions, "", "\t")
+	w.Write(b)
+	return nil
+}
+
+// Diff give what changed in resources and outputs between two versions of a tfstate.
+// When `to` is not set latest version is used and when `from` is not set version preceding `to` is used.
+func (c ApiController) Diff(w http.ResponseWriter, req *http.Request) error {
+	defer req.Body.Close()
+	path := c.CredhubName(req)
+	entry := RequestLogger(req).WithField("action", "diff").WithField("name", c.RequestName(req))
+	entry.Debug("Diffing tfstate versions")
+	if err := c.authorize(req, auth.RightRead, c.RequestName(req)); err != nil {
+		return err
+	}
+	from := req.URL.Query().Get("from")
+	to := req.URL.Query().Get("to")
+	if from == "" || to == "" {
+		versions, err := c.storer.Versions(path)
+		if err != nil {
+			entry.Error(err)
+			return err
+		}
+		from, to = c.defaultDiffVersions(versions, from, to)
+	}
+	if to == "" {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	fromState, err := c.retrieveStateVersion(path, from)
+	if err != nil {
+		entry.Error(err)
+		return err
+	}
+	toState, err := c.retrieveStateVersion(path, to)
+	if err != nil {
+		entry.Error(err)
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	b, _ := json.MarshalIndent(tfstate.Compare(fromState, toState), "", "\t")
+	w.Write(b)
+	return nil
+}
+
+func (c ApiController) defaultDiffVersions(versions []storer.Version, from, to string) (string, string) {
+	if len(versions) == 0 {
+		return from, to
+	}
+	if to == "" {
+		to = versions[0].ID
+	}
+	if from != "" {
+		return from, to
+	}
+	for i, version := range versions {
+		if version.ID == to && i+1 < len(versions) {
+			return versions[i+1].ID, to
+		}
+	}
+	return from, to
+}
+
+// retrieveStateVersion give an empty state when no version is given
+func (c ApiController) retrieveStateVersion(path, id string) (tfstate.State, error) {
+	if id == "" {
+		return tfstate.State{}, nil
+	}
+	r, err := c.storer.RetrieveVersion(path, id)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return tfstate.Decode(r)
+}
+
+func (c ApiController) ListTrash(w http.ResponseWriter, req *http.Request) error {
+	entry := RequestLogger(req).WithField("action", "list-trash")
+	entries, err := c.trash.List()
+	if err != nil {
+		entry.Error(err)
+		return err
+	}
+	identity := auth.FromContext(req.Context())
+	visibles := make([]TrashEntry, 0)
+	for _, trashEntry := range entries {
+		if identity.Can(auth.RightRead, trashEntry.Name) && c.allowlist.AllowState(remoteIp(req), trashEntry.Name) {
+			visibles = append(visibles, trashEntry)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	b, _ := json.MarshalIndent(visibles, "", "\t")
+	w.Write(b)
+	return nil
+}
+
+// RestoreTrash move back the most recently deleted state with this name from trash,
+// a specific deletion can be chosen with `deleted_at` parameter in RFC 3339 format
+func (c ApiController) RestoreTrash(w http.ResponseWriter, req *http.Request) error {
+	defer req.Body.Close()
+	path := c.CredhubName(req)
+	entry := RequestLogger(req).WithField("action", "restore").WithField("name", c.RequestName(req))
+	entry.Debug("Restoring tfstate from trash")
+	if err := c.authorize(req, auth.RightWrite, c.RequestName(req)); err != nil {
+		return err
+	}
+	if err := c.authorizeProtected(req, c.RequestName(req)); err != nil {
+		return err
+	}
+	var deletedAt time.Time
+	if deletedAtParam := req.URL.Query().Get("deleted_at"); deletedAtParam != "" {
+		var err error
+		deletedAt, err = time.Parse(time.RFC3339, deletedAtParam)
+		if err != nil {
+			return NewProblem(http.StatusBadRequest, fmt.Sprintf("Invalid deleted_at parameter: %s", err.Error()))
+		}
+	}
+	trashEntry, found, err := c.trash.Find(c.RequestName(req), deletedAt)
+	if err != nil {
+		entry.Error(err)
+		return err
+	}
+	if !found {
+		return NewProblem(http.StatusNotFound, fmt.Sprintf("No tfstate '%s' found in trash", c.RequestName(req)))
+	}
+	exists, err := c.stateExists(path)
+	if err != nil {
+		entry.Error(err)
+		return err
+	}
+	if exists {
+		return NewProblem(http.StatusConflict, fmt.Sprintf("A tfstate '%s' already exists", c.RequestName(req)))
+	}
+	err = c.trash.Restore(trashEntry, path, entry)
+	if err != nil {
+		entry.Error(err)
+		return err
+	}
+	c.notify(req, webhook.EventStore, c.RequestName(req), nil)
+	c.grantPermissions(req, c.RequestName(req))
+	return nil
+}
+
+func (c ApiController) stateExists(path string) (bool, error) {
+	versions, err := c.storer.Versions(path)
+	if err != nil && strings.Contains(err.Error(), "does not exist") {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return len(versions) > 0, nil
+}
+
+func (c ApiController) Copy(w http.ResponseWriter, req *http.Request) error {
+	return c.transfer(w, req, false)
+}
+
+func (c ApiController) Move(w http.ResponseWriter, req *http.Request) error {
+	return c.transfer(w, req, true)
+}
+
+// transfer copy, with its history, the tfstate to the one set in `target` parameter and delete source if it's a move.
+// Both tfstates are locked by the backend during the operation.
+func (c ApiController) transfer(w http.ResponseWriter, req *http.Request, move bool) error {
+	defer req.Body.Close()
+	action := "copy"
+	if move {
+		action = "move"
+	}
+	path := c.CredhubName(req)
+	target := req.URL.Query().Get("target")
+	entry := RequestLogger(req).WithField("action", action).WithField("name", c.RequestName(req)).WithField("target", target)
+	entry.Debugf("Transferring tfstate")
+	if target == "" || strings.Contains(target, "/") || target == c.RequestName(req) {
+		return NewProblem(http.StatusBadRequest, "Parameter target must be set with a tfstate name different from source")
+	}
+	sourceRight := auth.RightRead
+	if move {
+		sourceRight = auth.RightWrite
+	}
+	if err := c.authorize(req, sourceRight, c.RequestName(req)); err != nil {
+		return err
+	}
+	if err := c.authorize(req, auth.RightWrite, target); err != nil {
+		return err
+	}
+	if move {
+		if err := c.authorizeProtected(req, c.RequestName(req)); err != nil {
+			return err
+		}
+	}
+	if err := c.authorizeProtected(req, target); err != nil {
+		return err
+	}
+	targetPath := fmt.Sprintf("%s/%s", c.basePath, target)
+
+	exists, err := c.stateExists(path)
+	if err != nil {
+		entry.Error(err)
+		return err
+	}
+	if !exists {
+		return NewProblem(http.StatusNotFound, fmt.Sprintf("Tfstate '%s' does not exist", c.RequestName(req)))
+	}
+	exists, err = c.stateExists(targetPath)
+	if err != nil {
+		entry.Error(err)
+		return err
+	}
+	if exists {
+		return NewProblem(http.StatusConflict, fmt.Sprintf("A tfstate '%s' already exists", target))
+	}
+	for _, p := range []string{path, targetPath} {
+		if info, locked := c.store.IsLocked(p); locked {
+			entry.Debugf("'%s' is locked", p)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusLocked)
+			w.Write(info.Marshal())
+			return nil
+		}
+	}
+
+	info := state.NewLockInfo()
+	info.Operation = action
+	for _, p := range []string{path, targetPath} {
+		err = c.store.Lock(p, info)
+		if err != nil {
+			entry.Error(err)
+			return err
+		}
+		defer c.store.UnLock(p, info)
+	}
+
+	err = copyStateHistory(c.storer, path, targetPath, entry)
+	if err != nil {
+		entry.Error(err)
+		return err
+	}
+	c.notify(req, webhook.EventStore, target, nil)
+	c.grantPermissions(req, target)
+	if !move {
+		return nil
+	}
+	err = c.storer.Delete(path)
+	if err != nil {
+		entry.Error(err)
+		return err
+	}
+	c.notify(req, webhook.EventDelete, c.RequestName(req), nil)
+	return nil
+}
@@ -4,52 +4,110 @@ import (
 	"bytes"
 	"code.cloudfoundry.org/credhub-cli/credhub/credentials"
 	"code.cloudfoundry.org/credhub-cli/credhub/credentials/values"
+	"crypto/md5"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
+	"github.com/gorilla/mux"
 	"github.com/hashicorp/terraform/state"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	. "github.com/orange-cloudfoundry/terraform-secure-backend/server"
+	"github.com/orange-cloudfoundry/terraform-secure-backend/server/auth"
+	"github.com/orange-cloudfoundry/terraform-secure-backend/server/credhub"
 	"github.com/orange-cloudfoundry/terraform-secure-backend/server/credhub/credhubfakes"
 	"github.com/orange-cloudfoundry/terraform-secure-backend/server/storer"
+	"github.com/orange-cloudfoundry/terraform-secure-backend/server/storer/storerfakes"
+	"github.com/orange-cloudfoundry/terraform-secure-backend/server/tfstate"
+	"github.com/orange-cloudfoundry/terraform-secure-backend/server/webhook"
 	log "github.com/sirupsen/logrus"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"testing/iotest"
+	"time"
 )
 
 var _ = Describe("Api", func() {
 	log.SetOutput(ioutil.Discard)
 	var fakeClient *credhubfakes.FakeCredhubClient
+	// client mark errors of fake client as credhub errors as it is done when serving
+	var client credhub.CredhubClient
 	var cStorer *storer.Credhub
 	var apiController *ApiController
 	var lockStore *LockStore
+	var trash *Trash
 	var responseRecorder *httptest.ResponseRecorder
+	var identity *auth.Identity
+	problemWriter := NewProblemWriter(true)
+	// handle give handler called by identity
+	handle := func(handler func(http.ResponseWriter, *http.Request) error) http.HandlerFunc {
+		return func(w http.ResponseWriter, req *http.Request) {
+			problemWriter.Handle(handler)(w, req.WithContext(auth.WithIdentity(req.Context(), identity)))
+		}
+	}
 	BeforeEach(func() {
+		identity = auth.Anonymous()
 		responseRecorder = httptest.NewRecorder()
 		fakeClient = new(credhubfakes.FakeCredhubClient)
-		cStorer = storer.NewCredhub(fakeClient)
-		lockStore = NewLockStore(fakeClient)
-		apiController = NewApiController("test", fakeClient, cStorer, lockStore)
+		client = credhub.NewErrorCredhubClient(fakeClient)
+		cStorer = storer.NewCredhub(client)
+		lockStore = NewLockStore(client)
+		trash = NewTrash("test", client, cStorer, time.Hour)
+		apiController = NewApiController("test", client, cStorer, lockStore, trash, nil)
 	})
 	Context("Store", func() {
 		It("should store data when giving state", func() {
-			apiController.Store(responseRecorder, httptest.NewRequest("POST", "http://fakeurl.com", bytes.NewBufferString(`{"key": "value"}`)))
+			handle(apiController.Store)(responseRecorder, httptest.NewRequest("POST", "http://fakeurl.com", bytes.NewBufferString(`{"key": "value"}`)))
 			Expect(fakeClient.SetJSONCallCount()).Should(Equal(1))
 			Expect(responseRecorder.Code).Should(Equal(http.StatusOK))
 		})
-		It("should panic if unmarshal was in error", func() {
-			Expect(func() {
-				apiController.Store(
-					responseRecorder,
-					httptest.NewRequest("POST", "http://fakeurl.com", bytes.NewBufferString("")))
-			}).Should(Panic())
+		It("should store data when Content-MD5 header match data", func() {
+			req := httptest.NewRequest("POST", "http://fakeurl.com", bytes.NewBufferString(`{"key": "value"}`))
+			req.Header.Set("Content-MD5", contentMD5(`{"key": "value"}`))
+			handle(apiController.Store)(responseRecorder, req)
+			Expect(fakeClient.SetJSONCallCount()).Should(Equal(1))
+			Expect(responseRecorder.Code).Should(Equal(http.StatusOK))
+		})
+		It("should answer with http code bad request and not store when Content-MD5 header doesn't match data", func() {
+			req := httptest.NewRequest("POST", "http://fakeurl.com", bytes.NewBufferString(`{"key": "val`))
+			req.Header.Set("Content-MD5", contentMD5(`{"key": "value"}`))
+			handle(apiController.Store)(responseRecorder, req)
+			Expect(fakeClient.SetJSONCallCount()).Should(Equal(0))
+			Expect(responseRecorder.Code).Should(Equal(http.StatusBadRequest))
+		})
+		It("should answer with http code bad request when Content-MD5 header doesn't match data and storer swallows error", func() {
+			fakeStorer := new(storerfakes.FakeStorer)
+			fakeStorer.StoreStub = func(path string, r io.ReadCloser) error {
+				ioutil.ReadAll(r)
+				return nil
+			}
+			apiController = NewApiController("test", client, fakeStorer, lockStore, trash, nil)
+			req := httptest.NewRequest("POST", "http://fakeurl.com", bytes.NewBufferString(`{"key": "val`))
+			req.Header.Set("Content-MD5", contentMD5(`{"key": "value"}`))
+			handle(apiController.Store)(responseRecorder, req)
+			Expect(responseRecorder.Code).Should(Equal(http.StatusBadRequest))
+			Expect(responseRecorder.Body.String()).Should(ContainSubstring(contentMD5(`{"key": "value"}`)))
+			Expect(responseRecorder.Body.String()).Should(ContainSubstring(contentMD5(`{"key": "val`)))
+		})
+		It("should answer with http code bad request when Content-MD5 header is invalid", func() {
+			req := httptest.NewRequest("POST", "http://fakeurl.com", bytes.NewBufferString(`{"key": "value"}`))
+			req.Header.Set("Content-MD5", "notmd5")
+			handle(apiController.Store)(responseRecorder, req)
+			Expect(fakeClient.SetJSONCallCount()).Should(Equal(0))
+			Expect(responseRecorder.Code).Should(Equal(http.StatusBadRequest))
+		})
+		It("should answer with http code bad request if unmarshal was in error", func() {
+			handle(apiController.Store)(
+				responseRecorder,
+				httptest.NewRequest("POST", "http://fakeurl.com", bytes.NewBufferString("")))
+			Expect(responseRecorder.Code).Should(Equal(http.StatusBadRequest))
 		})
-		It("should panic if setting credential was in error", func() {
+		It("should answer with http code bad gateway if setting credential was in error", func() {
 			fakeClient.SetJSONReturns(credentials.JSON{}, errors.New("a fake error"))
-			Expect(func() {
-				apiController.Store(responseRecorder, httptest.NewRequest("POST", "http://fakeurl.com", bytes.NewBufferString(`{"key": "value"}`)))
-			}).Should(Panic())
+			handle(apiController.Store)(responseRecorder, httptest.NewRequest("POST", "http://fakeurl.com", bytes.NewBufferString(`{"key": "value"}`)))
+			Expect(responseRecorder.Code).Should(Equal(http.StatusBadGateway))
 		})
 	})
 	Context("Retrieve", func() {
@@ -61,7 +119,7 @@ var _ = Describe("Api", func() {
 				Value: data,
 			}, nil)
 
-			apiController.Retrieve(responseRecorder, httptest.NewRequest("GET", "http://fakeurl.com", nil))
+			handle(apiController.Retrieve)(responseRecorder, httptest.NewRequest("GET", "http://fakeurl.com", nil))
 
 			Expect(fakeClient.GetLatestJSONCallCount()).Should(Equal(1))
 			Expect(responseRecorder.Code).Should(Equal(http.StatusOK))
@@ -77,41 +135,87 @@ var _ = Describe("Api", func() {
 
 			fakeClient.GetLatestJSONReturns(credentials.JSON{}, errors.New("does not exist"))
 
-			apiController.Retrieve(responseRecorder, httptest.NewRequest("GET", "http://fakeurl.com", nil))
+			handle(apiController.Retrieve)(responseRecorder, httptest.NewRequest("GET", "http://fakeurl.com", nil))
 
 			Expect(fakeClient.GetLatestJSONCallCount()).Should(Equal(1))
 			Expect(responseRecorder.Code).Should(Equal(http.StatusNoContent))
 		})
-		It("should panic if getting credential was in error", func() {
+		It("should give redacted data when asking redacted view", func() {
+			fakeClient.GetLatestJSONReturns(credentials.JSON{
+				Value: values.JSON{
+					"version": 4,
+					"outputs": map[string]interface{}{
+						"password": map[string]interface{}{"value": "secret", "sensitive": true},
+					},
+				},
+			}, nil)
+
+			handle(apiController.Retrieve)(responseRecorder, httptest.NewRequest("GET", "http://fakeurl.com?view=redacted", nil))
+
+			Expect(responseRecorder.Code).Should(Equal(http.StatusOK))
+			Expect(responseRecorder.Body.Bytes()).Should(MatchJSON(`{"version": 4, "outputs": {"password": {"value": "(sensitive value)", "sensitive": true}}}`))
+		})
+		It("should answer with http code bad request when view is unknown", func() {
+			handle(apiController.Retrieve)(responseRecorder, httptest.NewRequest("GET", "http://fakeurl.com?view=foo", nil))
+
+			Expect(fakeClient.GetLatestJSONCallCount()).Should(Equal(0))
+			Expect(responseRecorder.Code).Should(Equal(http.StatusBadRequest))
+		})
+		It("should answer with http code bad gateway if getting credential was in error", func() {
 			fakeClient.GetLatestJSONReturns(credentials.JSON{}, errors.New("a fake error"))
-			Expect(func() {
-				apiController.Retrieve(responseRecorder, httptest.NewRequest("GET", "http://fakeurl.com", nil))
-			}).Should(Panic())
+			handle(apiController.Retrieve)(responseRecorder, httptest.NewRequest("GET", "http://fakeurl.com", nil))
+			Expect(responseRecorder.Code).Should(Equal(http.StatusBadGateway))
+		})
+		It("should not answer with http code ok if reading state fails after its first bytes", func() {
+			fakeStorer := new(storerfakes.FakeStorer)
+			fakeStorer.RetrieveReturns(ioutil.NopCloser(io.MultiReader(
+				bytes.NewBufferString(`{"key": `),
+				iotest.ErrReader(errors.New("storer/cutter: md5 mismatch")),
+			)), nil)
+			apiController = NewApiController("test", client, fakeStorer, lockStore, trash, nil)
+
+			handle(apiController.Retrieve)(responseRecorder, httptest.NewRequest("GET", "http://fakeurl.com", nil))
+
+			Expect(responseRecorder.Code).Should(Equal(http.StatusInternalServerError))
+			Expect(responseRecorder.Body.String()).ShouldNot(ContainSubstring(`{"key": `))
 		})
 	})
 	Context("Delete", func() {
-		It("should delete data from credhub and delete lock", func() {
+		It("should move data to trash and delete lock", func() {
+			fakeClient.GetLatestJSONReturns(credentials.JSON{Value: values.JSON{"key": "value"}}, nil)
 			req := httptest.NewRequest("DELETE", "http://fakeurl.com", nil)
-			apiController.Delete(responseRecorder, req)
+			handle(apiController.Delete)(responseRecorder, req)
+
+			Expect(fakeClient.SetJSONCallCount()).Should(Equal(1))
+			trashPath, data := fakeClient.SetJSONArgsForCall(0)
+			Expect(trashPath).Should(HavePrefix("test" + TRASH_PREFIX + "//"))
+			Expect(data).Should(HaveKeyWithValue("key", "value"))
+			Expect(fakeClient.DeleteCallCount()).Should(Equal(2))
+			Expect(fakeClient.DeleteArgsForCall(0)).Should(Equal(apiController.CredhubName(req)))
+			Expect(fakeClient.DeleteArgsForCall(1)).Should(Equal(apiController.CredhubName(req) + LOCK_SUFFIX))
+			Expect(responseRecorder.Code).Should(Equal(http.StatusOK))
+		})
+		It("should delete data from credhub and delete lock without trash when hard delete is asked", func() {
+			req := httptest.NewRequest("DELETE", "http://fakeurl.com?hard=true", nil)
+			handle(apiController.Delete)(responseRecorder, req)
 
+			Expect(fakeClient.SetJSONCallCount()).Should(Equal(0))
 			Expect(fakeClient.DeleteCallCount()).Should(Equal(2))
 			Expect(fakeClient.DeleteArgsForCall(0)).Should(Equal(apiController.CredhubName(req)))
 			Expect(fakeClient.DeleteArgsForCall(1)).Should(Equal(apiController.CredhubName(req) + LOCK_SUFFIX))
 			Expect(responseRecorder.Code).Should(Equal(http.StatusOK))
 		})
-		It("should panic if deleting lock was in error", func() {
+		It("should answer with http code bad gateway if deleting lock was in error", func() {
 			req := httptest.NewRequest("DELETE", "http://fakeurl.com", nil)
 			fakeClient.DeleteReturnsOnCall(1, errors.New("fake error"))
-			Expect(func() {
-				apiController.Delete(responseRecorder, req)
-			}).Should(Panic())
+			handle(apiController.Delete)(responseRecorder, req)
+			Expect(responseRecorder.Code).Should(Equal(http.StatusBadGateway))
 		})
-		It("should panic if deleting data was in error", func() {
+		It("should answer with http code bad gateway if deleting data was in error", func() {
 			req := httptest.NewRequest("DELETE", "http://fakeurl.com", nil)
 			fakeClient.DeleteReturnsOnCall(0, errors.New("fake error"))
-			Expect(func() {
-				apiController.Delete(responseRecorder, req)
-			}).Should(Panic())
+			handle(apiController.Delete)(responseRecorder, req)
+			Expect(responseRecorder.Code).Should(Equal(http.StatusBadGateway))
 		})
 	})
 	Context("Lock", func() {
@@ -121,11 +225,27 @@ var _ = Describe("Api", func() {
 				ID: "fakeid",
 			}).Marshal()))
 
-			apiController.Lock(responseRecorder, req)
+			handle(apiController.Lock)(responseRecorder, req)
 
 			Expect(fakeClient.SetValueCallCount()).Should(Equal(1))
 			Expect(responseRecorder.Code).Should(Equal(http.StatusOK))
 		})
+		It("should store whole lock info", func() {
+			fakeClient.GetLatestValueReturns(credentials.Value{}, errors.New("does not exist"))
+			req := httptest.NewRequest("LOCK", "http://fakeurl.com", bytes.NewBuffer((&state.LockInfo{
+				ID:  "fakeid",
+				Who: "me@host",
+			}).Marshal()))
+
+			handle(apiController.Lock)(responseRecorder, req)
+
+			_, value := fakeClient.SetValueArgsForCall(0)
+			var lockInfo state.LockInfo
+			err := json.Unmarshal([]byte(value), &lockInfo)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(lockInfo.ID).Should(Equal("fakeid"))
+			Expect(lockInfo.Who).Should(Equal("me@host"))
+		})
 		It("should return http code locked and lock info if it's already locked", func() {
 			req := httptest.NewRequest("LOCK", "http://fakeurl.com", bytes.NewBuffer((&state.LockInfo{
 				ID: "fakeid",
@@ -134,7 +254,7 @@ var _ = Describe("Api", func() {
 				Value: values.Value("an id"),
 			}, nil)
 
-			apiController.Lock(responseRecorder, req)
+			handle(apiController.Lock)(responseRecorder, req)
 
 			Expect(responseRecorder.Code).Should(Equal(http.StatusLocked))
 			var lockInfo state.LockInfo
@@ -142,24 +262,22 @@ var _ = Describe("Api", func() {
 			Expect(err).ShouldNot(HaveOccurred())
 			Expect(lockInfo.ID).Should(Equal("an id"))
 		})
-		It("should panic if unmarshal was in error", func() {
+		It("should answer with http code bad request if unmarshal was in error", func() {
 			req := httptest.NewRequest("LOCK", "http://fakeurl.com", bytes.NewBufferString(""))
 			fakeClient.GetLatestValueReturns(credentials.Value{}, errors.New("does not exist"))
 
-			Expect(func() {
-				apiController.Lock(responseRecorder, req)
-			}).Should(Panic())
+			handle(apiController.Lock)(responseRecorder, req)
+			Expect(responseRecorder.Code).Should(Equal(http.StatusBadRequest))
 		})
-		It("should panic if locking was in error", func() {
+		It("should answer with http code bad gateway if locking was in error", func() {
 			req := httptest.NewRequest("LOCK", "http://fakeurl.com", bytes.NewBuffer((&state.LockInfo{
 				ID: "fakeid",
 			}).Marshal()))
 			fakeClient.SetValueReturns(credentials.Value{}, errors.New("fake error"))
 			fakeClient.GetLatestValueReturns(credentials.Value{}, errors.New("does not exist"))
 
-			Expect(func() {
-				apiController.Lock(responseRecorder, req)
-			}).Should(Panic())
+			handle(apiController.Lock)(responseRecorder, req)
+			Expect(responseRecorder.Code).Should(Equal(http.StatusBadGateway))
 		})
 	})
 	Context("UnLock", func() {
@@ -172,7 +290,7 @@ var _ = Describe("Api", func() {
 				ID: id,
 			}).Marshal()))
 
-			apiController.UnLock(responseRecorder, req)
+			handle(apiController.UnLock)(responseRecorder, req)
 
 			Expect(fakeClient.DeleteCallCount()).Should(Equal(1))
 			Expect(responseRecorder.Code).Should(Equal(http.StatusOK))
@@ -186,7 +304,7 @@ var _ = Describe("Api", func() {
 				ID: "otherid",
 			}).Marshal()))
 
-			apiController.UnLock(responseRecorder, req)
+			handle(apiController.UnLock)(responseRecorder, req)
 
 			Expect(responseRecorder.Code).Should(Equal(http.StatusConflict))
 			var lockInfo state.LockInfo
@@ -194,14 +312,24 @@ var _ = Describe("Api", func() {
 			Expect(err).ShouldNot(HaveOccurred())
 			Expect(lockInfo.ID).Should(Equal(id))
 		})
-		It("should panic if unmarshal was in error", func() {
+		It("should answer with http code bad request if unmarshal was in error", func() {
 			req := httptest.NewRequest("UNLOCK", "http://fakeurl.com", bytes.NewBufferString(""))
 
-			Expect(func() {
-				apiController.UnLock(responseRecorder, req)
-			}).Should(Panic())
+			handle(apiController.UnLock)(responseRecorder, req)
+			Expect(responseRecorder.Code).Should(Equal(http.StatusBadRequest))
+		})
+		It("should release any lock without lock info when unlock is forced", func() {
+			fakeClient.GetLatestValueReturns(credentials.Value{
+				Value: values.Value("myid"),
+			}, nil)
+			req := httptest.NewRequest("UNLOCK", "http://fakeurl.com?force=true", bytes.NewBufferString(""))
+
+			handle(apiController.UnLock)(responseRecorder, req)
+
+			Expect(fakeClient.DeleteCallCount()).Should(Equal(1))
+			Expect(responseRecorder.Code).Should(Equal(http.StatusOK))
 		})
-		It("should panic if unlocking was in error", func() {
+		It("should answer with http code bad gateway if unlocking was in error", func() {
 			id := "myid"
 			fakeClient.GetLatestValueReturns(credentials.Value{
 				Value: values.Value(id),
@@ -210,54 +338,536 @@ var _ = Describe("Api", func() {
 				ID: id,
 			}).Marshal()))
 			fakeClient.DeleteReturns(errors.New("fake error"))
-			Expect(func() {
-				apiController.UnLock(responseRecorder, req)
-			}).Should(Panic())
+			handle(apiController.UnLock)(responseRecorder, req)
+			Expect(responseRecorder.Code).Should(Equal(http.StatusBadGateway))
 		})
 	})
-	Context("List", func() {
-		It("should give a list credentials", func() {
-			req := httptest.NewRequest("GET", "http://fakeurl.com", bytes.NewBufferString(""))
-			fakeClient.FindByPathReturns(credentials.FindResults{[]credentials.Base{
-				{
-					Name:             apiController.CredhubName(req) + "data1",
-					VersionCreatedAt: "now",
-				},
-				{
-					Name:             apiController.CredhubName(req) + "data2",
-					VersionCreatedAt: "now",
-				},
-				{
-					Name:             apiController.CredhubName(req) + LOCK_SUFFIX,
-					VersionCreatedAt: "now",
-				},
+	Context("Authorization", func() {
+		withName := func(req *http.Request, name string) *http.Request {
+			return mux.SetURLVars(req, map[string]string{"name": name})
+		}
+		BeforeEach(func() {
+			identity = &auth.Identity{Name: "team-a", Grants: []auth.Grant{
+				{States: []string{"team-a-*"}, Rights: []string{auth.RightWrite, auth.RightLock}},
+				{States: []string{"shared"}, Rights: []string{auth.RightRead}},
+			}}
+		})
+		It("should let caller store and retrieve tfstates it has rights on", func() {
+			handle(apiController.Store)(responseRecorder, withName(httptest.NewRequest("POST", "http://fakeurl.com", bytes.NewBufferString(`{"key": "value"}`)), "team-a-network"))
+			Expect(responseRecorder.Code).Should(Equal(http.StatusOK))
+
+			responseRecorder = httptest.NewRecorder()
+			handle(apiController.Retrieve)(responseRecorder, withName(httptest.NewRequest("GET", "http://fakeurl.com", nil), "shared"))
+			Expect(responseRecorder.Code).ShouldNot(Equal(http.StatusForbidden))
+		})
+		It("should answer with http code forbidden when caller has not the right", func() {
+			handle(apiController.Store)(responseRecorder, withName(httptest.NewRequest("POST", "http://fakeurl.com", bytes.NewBufferString(`{"key": "value"}`)), "shared"))
+			Expect(responseRecorder.Code).Should(Equal(http.StatusForbidden))
+			Expect(fakeClient.SetJSONCallCount()).Should(Equal(0))
+
+			responseRecorder = httptest.NewRecorder()
+			handle(apiController.Retrieve)(responseRecorder, withName(httptest.NewRequest("GET", "http://fakeurl.com", nil), "team-b-network"))
+			Expect(responseRecorder.Code).Should(Equal(http.StatusForbidden))
+
+			responseRecorder = httptest.NewRecorder()
+			handle(apiController.Lock)(responseRecorder, withName(httptest.NewRequest("LOCK", "http://fakeurl.com", nil), "shared"))
+			Expect(responseRecorder.Code).Should(Equal(http.StatusForbidden))
+		})
+		It("should require admin right to hard delete and force unlock", func() {
+			handle(apiController.Delete)(responseRecorder, withName(httptest.NewRequest("DELETE", "http://fakeurl.com?hard=true", nil), "team-a-network"))
+			Expect(responseRecorder.Code).Should(Equal(http.StatusForbidden))
+
+			responseRecorder = httptest.NewRecorder()
+			handle(apiController.UnLock)(responseRecorder, withName(httptest.NewRequest("UNLOCK", "http://fakeurl.com?force=true", nil), "team-a-network"))
+			Expect(responseRecorder.Code).Should(Equal(http.StatusForbidden))
+			Expect(fakeClient.DeleteCallCount()).Should(Equal(0))
+		})
+		It("should answer with http code forbidden when client ip is not allowed for tfstate", func() {
+			allowlist, err := NewIpAllowlist(nil, []IpRule{{Prefix: "team-a-", Ips: []string{"10.0.0.0/8"}}})
+			Expect(err).ShouldNot(HaveOccurred())
+			controller := apiController.WithIpAllowlist(allowlist)
+			handle(controller.Store)(responseRecorder, withName(httptest.NewRequest("POST", "http://fakeurl.com", bytes.NewBufferString(`{"key": "value"}`)), "team-a-network"))
+			Expect(responseRecorder.Code).Should(Equal(http.StatusForbidden))
+			Expect(fakeClient.SetJSONCallCount()).Should(Equal(0))
+
+			responseRecorder = httptest.NewRecorder()
+			req := withName(httptest.NewRequest("POST", "http://fakeurl.com", bytes.NewBufferString(`{"key": "value"}`)), "team-a-network")
+			req.RemoteAddr = "10.1.2.3:5000"
+			handle(controller.Store)(responseRecorder, req)
+			Expect(responseRecorder.Code).Should(Equal(http.StatusOK))
+		})
+		It("should refuse names reserved for backend data", func() {
+			handle(apiController.Store)(responseRecorder, withName(httptest.NewRequest("POST", "http://fakeurl.com", bytes.NewBufferString(`{"key": "value"}`)), ".tokens"))
+			Expect(responseRecorder.Code).Should(Equal(http.StatusBadRequest))
+			Expect(fakeClient.SetJSONCallCount()).Should(Equal(0))
+		})
+		It("should only list tfstates caller can read", func() {
+			fakeClient.FindByPathReturns(credentials.FindResults{Credentials: []credentials.Base{
+				{Name: "/test/team-a-network/index", VersionCreatedAt: "2019-01-01T00:00:00Z"},
+				{Name: "/test/team-b-network/index", VersionCreatedAt: "2019-01-01T00:00:00Z"},
+				{Name: "/test/shared/index", VersionCreatedAt: "2019-01-01T00:00:00Z"},
 			}}, nil)
-			fakeClient.GetLatestValueReturnsOnCall(0, credentials.Value{}, errors.New("does not exist"))
-			fakeClient.GetLatestValueReturnsOnCall(1, credentials.Value{
-				Value: values.Value("id"),
+			handle(apiController.List)(responseRecorder, httptest.NewRequest("GET", "http://fakeurl.com/states", nil))
+
+			var creds []CredModel
+			err := json.Unmarshal(responseRecorder.Body.Bytes(), &creds)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(creds).Should(HaveLen(2))
+			Expect(creds[0].Name).Should(Equal("shared"))
+			Expect(creds[1].Name).Should(Equal("team-a-network"))
+		})
+	})
+	Context("Webhooks", func() {
+		var receiver *httptest.Server
+		var received chan webhook.Event
+		BeforeEach(func() {
+			received = make(chan webhook.Event, 10)
+			receiver = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				var event webhook.Event
+				json.NewDecoder(req.Body).Decode(&event)
+				received <- event
+			}))
+			notifier, err := webhook.NewNotifier([]webhook.Config{{URL: receiver.URL, Secret: "my-secret"}})
+			Expect(err).ShouldNot(HaveOccurred())
+			apiController = NewApiController("test", client, cStorer, lockStore, trash, notifier)
+		})
+		AfterEach(func() {
+			receiver.Close()
+		})
+		It("should notify lock with its lock info", func() {
+			fakeClient.GetLatestValueReturns(credentials.Value{}, errors.New("does not exist"))
+			req := httptest.NewRequest("LOCK", "http://fakeurl.com", bytes.NewBuffer((&state.LockInfo{
+				ID:  "fakeid",
+				Who: "me@host",
+			}).Marshal()))
+			req = mux.SetURLVars(req, map[string]string{"name": "prod"})
+
+			handle(apiController.Lock)(responseRecorder, req)
+
+			var event webhook.Event
+			Eventually(received).Should(Receive(&event))
+			Expect(event.Event).Should(Equal(webhook.EventLock))
+			Expect(event.State).Should(Equal("prod"))
+			Expect(event.Lock.Who).Should(Equal("me@host"))
+		})
+		It("should notify force unlock with lock which was held", func() {
+			fakeClient.GetLatestValueReturns(credentials.Value{
+				Value: values.Value("myid"),
 			}, nil)
+			req := httptest.NewRequest("UNLOCK", "http://fakeurl.com?force=true", nil)
+
+			handle(apiController.UnLock)(responseRecorder, req)
 
-			apiController.List(responseRecorder, req)
+			var event webhook.Event
+			Eventually(received).Should(Receive(&event))
+			Expect(event.Event).Should(Equal(webhook.EventForceUnlock))
+			Expect(event.Lock.ID).Should(Equal("myid"))
+		})
+		It("should not notify when storing failed", func() {
+			fakeClient.SetJSONReturns(credentials.JSON{}, errors.New("fake error"))
+			handle(apiController.Store)(responseRecorder, httptest.NewRequest("POST", "http://fakeurl.com", bytes.NewBufferString(`{"key": "value"}`)))
 
+			Consistently(received, "100ms").ShouldNot(Receive())
+		})
+	})
+	Context("List", func() {
+		BeforeEach(func() {
+			fakeClient.FindByPathReturns(credentials.FindResults{Credentials: []credentials.Base{
+				{Name: "/test/data1/index", VersionCreatedAt: "2019-01-03T00:00:00Z"},
+				{Name: "/test/data1/0", VersionCreatedAt: "2019-01-02T00:00:00Z"},
+				{Name: "/test/data2/index", VersionCreatedAt: "2019-01-01T00:00:00Z"},
+				{Name: "/test/data2/0", VersionCreatedAt: "2019-01-01T00:00:00Z"},
+				{Name: "/test/data2" + LOCK_SUFFIX, VersionCreatedAt: "2019-01-04T00:00:00Z"},
+				{Name: "/test/other/index", VersionCreatedAt: "2019-01-02T00:00:00Z"},
+				{Name: "/test/.trash/data3/1000/index", VersionCreatedAt: "2019-01-01T00:00:00Z"},
+			}}, nil)
+			fakeClient.GetLatestValueReturns(credentials.Value{
+				Value: values.Value("id"),
+			}, nil)
+		})
+		list := func(url string) []CredModel {
+			handle(apiController.List)(responseRecorder, httptest.NewRequest("GET", url, nil))
 			Expect(responseRecorder.Code).Should(Equal(http.StatusOK))
 			var creds []CredModel
 			err := json.Unmarshal(responseRecorder.Body.Bytes(), &creds)
 			Expect(err).ShouldNot(HaveOccurred())
-			Expect(creds).Should(HaveLen(2))
+			return creds
+		}
+		It("should give one entry per tfstate with lock status from listing", func() {
+			creds := list("http://fakeurl.com/states")
+			Expect(creds).Should(HaveLen(3))
 
 			Expect(creds[0].Name).Should(Equal("data1"))
+			Expect(creds[0].CredhubName).Should(Equal("test/data1"))
+			Expect(creds[0].VersionCreatedAt).Should(Equal("2019-01-03T00:00:00Z"))
 			Expect(creds[0].IsLocked).Should(BeFalse())
 
 			Expect(creds[1].Name).Should(Equal("data2"))
 			Expect(creds[1].IsLocked).Should(BeTrue())
+			Expect(creds[1].CurrentLock).Should(BeNil())
+			Expect(creds[1].Parts).Should(Equal(1))
+
+			Expect(creds[2].Name).Should(Equal("other"))
+			Expect(fakeClient.FindByPathCallCount()).Should(Equal(1))
+			Expect(fakeClient.GetLatestValueCallCount()).Should(Equal(0))
+		})
+		It("should give current lock of locked tfstates only when asked", func() {
+			creds := list("http://fakeurl.com/states?with_lock_info=true")
+			Expect(creds).Should(HaveLen(3))
+
+			Expect(creds[0].CurrentLock).Should(BeNil())
+			Expect(creds[1].IsLocked).Should(BeTrue())
 			Expect(creds[1].CurrentLockId).Should(Equal("id"))
+			Expect(creds[1].CurrentLock.ID).Should(Equal("id"))
+			Expect(fakeClient.GetLatestValueCallCount()).Should(Equal(1))
+			Expect(fakeClient.GetLatestValueArgsForCall(0)).Should(Equal("test/data2" + LOCK_SUFFIX))
 		})
-		It("should panic if find was in error", func() {
-			fakeClient.FindByPathReturns(credentials.FindResults{[]credentials.Base{}}, errors.New("a fake error"))
+		It("should filter on prefix, lock status and update date", func() {
+			creds := list("http://fakeurl.com/states?prefix=data")
+			Expect(creds).Should(HaveLen(2))
+
+			responseRecorder = httptest.NewRecorder()
+			creds = list("http://fakeurl.com/states?locked=false")
+			Expect(creds).Should(HaveLen(2))
+			Expect(creds[0].Name).Should(Equal("data1"))
+			Expect(creds[1].Name).Should(Equal("other"))
+
+			responseRecorder = httptest.NewRecorder()
+			creds = list("http://fakeurl.com/states?updated_before=2019-01-02T12:00:00Z")
+			Expect(creds).Should(HaveLen(2))
+			Expect(creds[0].Name).Should(Equal("data2"))
+			Expect(creds[1].Name).Should(Equal("other"))
+		})
+		It("should sort on update date", func() {
+			creds := list("http://fakeurl.com/states?sort=-updated_at")
+			Expect(creds).Should(HaveLen(3))
+			Expect(creds[0].Name).Should(Equal("data1"))
+			Expect(creds[1].Name).Should(Equal("other"))
+			Expect(creds[2].Name).Should(Equal("data2"))
+		})
+		It("should paginate with cursor", func() {
+			creds := list("http://fakeurl.com/states?limit=2")
+			Expect(creds).Should(HaveLen(2))
+			Expect(creds[1].Name).Should(Equal("data2"))
+			cursor := responseRecorder.Header().Get("X-Next-Cursor")
+			Expect(cursor).ShouldNot(BeEmpty())
+			Expect(responseRecorder.Header().Get("Link")).Should(ContainSubstring("cursor=" + cursor))
+
+			responseRecorder = httptest.NewRecorder()
+			creds = list("http://fakeurl.com/states?limit=2&cursor=" + cursor)
+			Expect(creds).Should(HaveLen(1))
+			Expect(creds[0].Name).Should(Equal("other"))
+			Expect(responseRecorder.Header().Get("X-Next-Cursor")).Should(BeEmpty())
+		})
+		It("should answer with http code bad request when a parameter is invalid", func() {
+			handle(apiController.List)(responseRecorder, httptest.NewRequest("GET", "http://fakeurl.com/states?sort=size", nil))
+			Expect(responseRecorder.Code).Should(Equal(http.StatusBadRequest))
+		})
+		It("should answer with http code bad gateway if find was in error", func() {
+			fakeClient.FindByPathReturns(credentials.FindResults{Credentials: []credentials.Base{}}, errors.New("a fake error"))
 			req := httptest.NewRequest("GET", "http://fakeurl.com", nil)
-			Expect(func() {
-				apiController.List(responseRecorder, req)
-			}).Should(Panic())
+			handle(apiController.List)(responseRecorder, req)
+			Expect(responseRecorder.Code).Should(Equal(http.StatusBadGateway))
+		})
+	})
+	Context("Versions", func() {
+		It("should give versions of the state", func() {
+			fakeClient.GetAllVersionsReturns([]credentials.Credential{
+				{Metadata: credentials.Metadata{Id: "2", Base: credentials.Base{VersionCreatedAt: "2019-01-02T00:00:00Z"}}},
+				{Metadata: credentials.Metadata{Id: "1", Base: credentials.Base{VersionCreatedAt: "2019-01-01T00:00:00Z"}}},
+			}, nil)
+
+			handle(apiController.Versions)(responseRecorder, httptest.NewRequest("GET", "http://fakeurl.com", nil))
+
+			Expect(responseRecorder.Code).Should(Equal(http.StatusOK))
+			var versions []storer.Version
+			err := json.Unmarshal(responseRecorder.Body.Bytes(), &versions)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(versions).Should(HaveLen(2))
+			Expect(versions[0].ID).Should(Equal("2"))
+		})
+		It("should answer with http code bad gateway if getting versions was in error", func() {
+			fakeClient.GetAllVersionsReturns(nil, errors.New("a fake error"))
+			handle(apiController.Versions)(responseRecorder, httptest.NewRequest("GET", "http://fakeurl.com", nil))
+			Expect(responseRecorder.Code).Should(Equal(http.StatusBadGateway))
+		})
+	})
+	Context("Diff", func() {
+		var stateV1, stateV2 credentials.Credential
+		BeforeEach(func() {
+			stateV1 = credentials.Credential{
+				Metadata: credentials.Metadata{Id: "1", Base: credentials.Base{Name: "/test/"}},
+				Value: map[string]interface{}{
+					"version": 4,
+					"outputs": map[string]interface{}{
+						"password": map[string]interface{}{"value": "secret1", "sensitive": true},
+					},
+				},
+			}
+			stateV2 = credentials.Credential{
+				Metadata: credentials.Metadata{Id: "2", Base: credentials.Base{Name: "/test/"}},
+				Value: map[string]interface{}{
+					"version": 4,
+					"outputs": map[string]interface{}{
+						"password": map[string]interface{}{"value": "secret2", "sensitive": true},
+						"ip":       map[string]interface{}{"value": "10.0.0.1"},
+					},
+				},
+			}
+			fakeClient.GetByIdStub = func(id string) (credentials.Credential, error) {
+				if id == "1" {
+					return stateV1, nil
+				}
+				return stateV2, nil
+			}
+		})
+		It("should give diff between latest version and its previous one by default", func() {
+			fakeClient.GetAllVersionsReturns([]credentials.Credential{stateV2, stateV1}, nil)
+
+			handle(apiController.Diff)(responseRecorder, httptest.NewRequest("GET", "http://fakeurl.com", nil))
+
+			Expect(responseRecorder.Code).Should(Equal(http.StatusOK))
+			Expect(fakeClient.GetByIdArgsForCall(0)).Should(Equal("1"))
+			Expect(fakeClient.GetByIdArgsForCall(1)).Should(Equal("2"))
+			Expect(responseRecorder.Body.String()).ShouldNot(ContainSubstring("secret"))
+			var diff tfstate.Diff
+			err := json.Unmarshal(responseRecorder.Body.Bytes(), &diff)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(diff.Outputs.Added).Should(Equal([]string{"ip"}))
+			Expect(diff.Outputs.Changed).Should(HaveLen(1))
+			Expect(diff.Outputs.Changed[0].After).Should(Equal(tfstate.RedactedValue))
+		})
+		It("should give diff between versions asked", func() {
+			handle(apiController.Diff)(responseRecorder, httptest.NewRequest("GET", "http://fakeurl.com?from=2&to=1", nil))
+
+			Expect(responseRecorder.Code).Should(Equal(http.StatusOK))
+			Expect(fakeClient.GetAllVersionsCallCount()).Should(Equal(0))
+			var diff tfstate.Diff
+			err := json.Unmarshal(responseRecorder.Body.Bytes(), &diff)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(diff.Outputs.Removed).Should(Equal([]string{"ip"}))
+		})
+		It("should answer with http code status no content when there is no version", func() {
+			fakeClient.GetAllVersionsReturns([]credentials.Credential{}, nil)
+
+			handle(apiController.Diff)(responseRecorder, httptest.NewRequest("GET", "http://fakeurl.com", nil))
+
+			Expect(responseRecorder.Code).Should(Equal(http.StatusNoContent))
+		})
+		It("should answer with http code bad gateway if retrieving a version was in error", func() {
+			fakeClient.GetByIdStub = nil
+			fakeClient.GetByIdReturns(credentials.Credential{}, errors.New("a fake error"))
+			handle(apiController.Diff)(responseRecorder, httptest.NewRequest("GET", "http://fakeurl.com?from=1&to=2", nil))
+			Expect(responseRecorder.Code).Should(Equal(http.StatusBadGateway))
+		})
+	})
+	Context("ListTrash", func() {
+		It("should give entries in trash from the most recently deleted", func() {
+			fakeClient.FindByPathReturns(credentials.FindResults{Credentials: []credentials.Base{
+				{Name: "/test/.trash/foo/1000000000000/index"},
+				{Name: "/test/.trash/foo/1000000000000/0"},
+				{Name: "/test/.trash/bar/2000000000000/index"},
+			}}, nil)
+
+			handle(apiController.ListTrash)(responseRecorder, httptest.NewRequest("GET", "http://fakeurl.com", nil))
+
+			Expect(fakeClient.FindByPathArgsForCall(0)).Should(Equal("test" + TRASH_PREFIX))
+			Expect(responseRecorder.Code).Should(Equal(http.StatusOK))
+			var entries []TrashEntry
+			err := json.Unmarshal(responseRecorder.Body.Bytes(), &entries)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(entries).Should(HaveLen(2))
+			Expect(entries[0].Name).Should(Equal("bar"))
+			Expect(entries[0].DeletedAt.Unix()).Should(Equal(int64(2000)))
+			Expect(entries[0].ExpireAt.Unix()).Should(Equal(int64(2000 + 3600)))
+			Expect(entries[1].Name).Should(Equal("foo"))
+		})
+	})
+	Context("RestoreTrash", func() {
+		BeforeEach(func() {
+			fakeClient.FindByPathReturns(credentials.FindResults{Credentials: []credentials.Base{
+				{Name: "/test/.trash//1000000000000/index"},
+				{Name: "/test/.trash//2000000000000/index"},
+			}}, nil)
+			fakeClient.GetAllVersionsReturns(nil, errors.New("does not exist"))
+		})
+		It("should move back the most recently deleted state", func() {
+			req := httptest.NewRequest("POST", "http://fakeurl.com", nil)
+			handle(apiController.RestoreTrash)(responseRecorder, req)
+
+			Expect(responseRecorder.Code).Should(Equal(http.StatusOK))
+			Expect(fakeClient.GetLatestJSONArgsForCall(0)).Should(Equal("test" + TRASH_PREFIX + "//2000000000000"))
+			path, _ := fakeClient.SetJSONArgsForCall(0)
+			Expect(path).Should(Equal(apiController.CredhubName(req)))
+			Expect(fakeClient.DeleteArgsForCall(0)).Should(Equal("test" + TRASH_PREFIX + "//2000000000000"))
+		})
+		It("should move back the state deleted at the time asked", func() {
+			req := httptest.NewRequest("POST", "http://fakeurl.com?deleted_at="+time.Unix(1000, 0).UTC().Format(time.RFC3339), nil)
+			handle(apiController.RestoreTrash)(responseRecorder, req)
+
+			Expect(responseRecorder.Code).Should(Equal(http.StatusOK))
+			Expect(fakeClient.GetLatestJSONArgsForCall(0)).Should(Equal("test" + TRASH_PREFIX + "//1000000000000"))
+		})
+		It("should answer with http code not found when state is not in trash", func() {
+			req := httptest.NewRequest("POST", "http://fakeurl.com?deleted_at="+time.Unix(3000, 0).UTC().Format(time.RFC3339), nil)
+			handle(apiController.RestoreTrash)(responseRecorder, req)
+
+			Expect(responseRecorder.Code).Should(Equal(http.StatusNotFound))
+			Expect(fakeClient.SetJSONCallCount()).Should(Equal(0))
+		})
+		It("should answer with http code conflict when state already exists", func() {
+			fakeClient.GetAllVersionsReturns([]credentials.Credential{{}}, nil)
+			req := httptest.NewRequest("POST", "http://fakeurl.com", nil)
+			handle(apiController.RestoreTrash)(responseRecorder, req)
+
+			Expect(responseRecorder.Code).Should(Equal(http.StatusConflict))
+			Expect(fakeClient.SetJSONCallCount()).Should(Equal(0))
+		})
+	})
+	Context("Copy and Move", func() {
+		BeforeEach(func() {
+			fakeClient.GetAllVersionsStub = func(name string) ([]credentials.Credential, error) {
+				if name != "test/" {
+					return nil, errors.New("does not exist")
+				}
+				return []credentials.Credential{
+					{Metadata: credentials.Metadata{Id: "2", Base: credentials.Base{Name: "/test/"}}},
+					{Metadata: credentials.Metadata{Id: "1", Base: credentials.Base{Name: "/test/"}}},
+				}, nil
+			}
+			fakeClient.GetByIdReturns(credentials.Credential{
+				Metadata: credentials.Metadata{Id: "1", Base: credentials.Base{Name: "/test/"}},
+				Value:    map[string]interface{}{"serial": 1},
+			}, nil)
+			fakeClient.GetLatestJSONReturns(credentials.JSON{Value: values.JSON{"serial": 2}}, nil)
+			fakeClient.GetLatestValueReturns(credentials.Value{}, errors.New("does not exist"))
+		})
+		It("should copy history of state to target while locking both", func() {
+			handle(apiController.Copy)(responseRecorder, httptest.NewRequest("POST", "http://fakeurl.com?target=bar", nil))
+
+			Expect(responseRecorder.Code).Should(Equal(http.StatusOK))
+			Expect(fakeClient.SetJSONCallCount()).Should(Equal(2))
+			path, data := fakeClient.SetJSONArgsForCall(0)
+			Expect(path).Should(Equal("test/bar"))
+			Expect(data).Should(HaveKeyWithValue("serial", BeEquivalentTo(1)))
+			_, data = fakeClient.SetJSONArgsForCall(1)
+			Expect(data).Should(HaveKeyWithValue("serial", BeEquivalentTo(2)))
+
+			Expect(fakeClient.SetValueCallCount()).Should(Equal(2))
+			lockPath, _ := fakeClient.SetValueArgsForCall(1)
+			Expect(lockPath).Should(Equal("test/bar" + LOCK_SUFFIX))
+			Expect(fakeClient.DeleteCallCount()).Should(Equal(2))
+		})
+		It("should delete source after copy when moving", func() {
+			handle(apiController.Move)(responseRecorder, httptest.NewRequest("POST", "http://fakeurl.com?target=bar", nil))
+
+			Expect(responseRecorder.Code).Should(Equal(http.StatusOK))
+			Expect(fakeClient.SetJSONCallCount()).Should(Equal(2))
+			Expect(fakeClient.DeleteCallCount()).Should(Equal(3))
+			Expect(fakeClient.DeleteArgsForCall(0)).Should(Equal("test/"))
+		})
+		It("should answer with http code locked when source or target is locked", func() {
+			fakeClient.GetLatestValueStub = func(name string) (credentials.Value, error) {
+				if name == "test/bar"+LOCK_SUFFIX {
+					return credentials.Value{Value: values.Value("an id")}, nil
+				}
+				return credentials.Value{}, errors.New("does not exist")
+			}
+
+			handle(apiController.Move)(responseRecorder, httptest.NewRequest("POST", "http://fakeurl.com?target=bar", nil))
+
+			Expect(responseRecorder.Code).Should(Equal(http.StatusLocked))
+			var lockInfo state.LockInfo
+			err := json.Unmarshal(responseRecorder.Body.Bytes(), &lockInfo)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(lockInfo.ID).Should(Equal("an id"))
+			Expect(fakeClient.SetJSONCallCount()).Should(Equal(0))
+		})
+		It("should answer with http code conflict when target exists", func() {
+			fakeClient.GetAllVersionsStub = nil
+			fakeClient.GetAllVersionsReturns([]credentials.Credential{{}}, nil)
+
+			handle(apiController.Copy)(responseRecorder, httptest.NewRequest("POST", "http://fakeurl.com?target=bar", nil))
+
+			Expect(responseRecorder.Code).Should(Equal(http.StatusConflict))
+			Expect(fakeClient.SetJSONCallCount()).Should(Equal(0))
+		})
+		It("should answer with http code not found when source does not exist", func() {
+			fakeClient.GetAllVersionsStub = nil
+			fakeClient.GetAllVersionsReturns(nil, errors.New("does not exist"))
+
+			handle(apiController.Copy)(responseRecorder, httptest.NewRequest("POST", "http://fakeurl.com?target=bar", nil))
+
+			Expect(responseRecorder.Code).Should(Equal(http.StatusNotFound))
+		})
+		It("should answer with http code bad request when target is not valid", func() {
+			handle(apiController.Copy)(responseRecorder, httptest.NewRequest("POST", "http://fakeurl.com?target=foo/bar", nil))
+
+			Expect(responseRecorder.Code).Should(Equal(http.StatusBadRequest))
+		})
+	})
+	Context("Conditional requests", func() {
+		var fakeStorer *storerfakes.FakeStorer
+		BeforeEach(func() {
+			fakeStorer = new(storerfakes.FakeStorer)
+			fakeStorer.HashReturns("abc", nil)
+			fakeStorer.RetrieveReturns(ioutil.NopCloser(bytes.NewBufferString(`{"key": "value"}`)), nil)
+			apiController = NewApiController("test", client, fakeStorer, lockStore, trash, nil)
+		})
+		It("should give etag of state when retrieving", func() {
+			handle(apiController.Retrieve)(responseRecorder, httptest.NewRequest("GET", "http://fakeurl.com", nil))
+
+			Expect(responseRecorder.Code).Should(Equal(http.StatusOK))
+			Expect(responseRecorder.Header().Get("ETag")).Should(Equal(`"abc"`))
+			Expect(responseRecorder.Body.Bytes()).Should(MatchJSON(`{"key": "value"}`))
+		})
+		It("should answer with http code not modified when If-None-Match match etag", func() {
+			req := httptest.NewRequest("GET", "http://fakeurl.com", nil)
+			req.Header.Set("If-None-Match", `"other", W/"abc"`)
+			handle(apiController.Retrieve)(responseRecorder, req)
+
+			Expect(responseRecorder.Code).Should(Equal(http.StatusNotModified))
+			Expect(fakeStorer.RetrieveCallCount()).Should(Equal(0))
+		})
+		It("should give state when If-None-Match doesn't match etag", func() {
+			req := httptest.NewRequest("GET", "http://fakeurl.com", nil)
+			req.Header.Set("If-None-Match", `"other"`)
+			handle(apiController.Retrieve)(responseRecorder, req)
+
+			Expect(responseRecorder.Code).Should(Equal(http.StatusOK))
+			Expect(fakeStorer.RetrieveCallCount()).Should(Equal(1))
+		})
+		It("should store state and give its new etag when If-Match match etag", func() {
+			fakeStorer.HashReturnsOnCall(1, "def", nil)
+			req := httptest.NewRequest("POST", "http://fakeurl.com", bytes.NewBufferString(`{"key": "value"}`))
+			req.Header.Set("If-Match", `"abc"`)
+			handle(apiController.Store)(responseRecorder, req)
+
+			Expect(responseRecorder.Code).Should(Equal(http.StatusOK))
+			Expect(fakeStorer.StoreCallCount()).Should(Equal(1))
+			Expect(responseRecorder.Header().Get("ETag")).Should(Equal(`"def"`))
+		})
+		It("should answer with http code precondition failed when If-Match doesn't match etag", func() {
+			req := httptest.NewRequest("POST", "http://fakeurl.com", bytes.NewBufferString(`{"key": "value"}`))
+			req.Header.Set("If-Match", `"other"`)
+			handle(apiController.Store)(responseRecorder, req)
+
+			Expect(responseRecorder.Code).Should(Equal(http.StatusPreconditionFailed))
+			Expect(fakeStorer.StoreCallCount()).Should(Equal(0))
+		})
+		It("should answer with http code precondition failed when If-Match is set and state does not exist", func() {
+			fakeStorer.HashReturns("", errors.New("does not exist"))
+			req := httptest.NewRequest("POST", "http://fakeurl.com", bytes.NewBufferString(`{"key": "value"}`))
+			req.Header.Set("If-Match", "*")
+			handle(apiController.Store)(responseRecorder, req)
+
+			Expect(responseRecorder.Code).Should(Equal(http.StatusPreconditionFailed))
+			Expect(fakeStorer.StoreCallCount()).Should(Equal(0))
 		})
 	})
 })
+
+func contentMD5(data string) string {
+	sum := md5.Sum([]byte(data))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
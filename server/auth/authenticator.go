@@ -0,0 +1,15 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+)
+
+// ErrInvalidCredentials is given when credentials sent are wrong
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// Authenticator give identity of the caller of a request, identity and error are nil
+// when request doesn't carry credentials handled by this authenticator
+type Authenticator interface {
+	Authenticate(req *http.Request) (*Identity, error)
+}
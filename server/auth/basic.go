@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"net/http"
+	"sync"
+)
+
+// User is a user authenticating with basic auth, Password is a bcrypt hash
+type User struct {
+	Username string `json:"username" yaml:"username"`
+	Password string `json:"password" yaml:"password"`
+}
+
+// LoadUsersFile give users found in a yaml file with a `users` key in the same format as in config
+func LoadUsersFile(file string) ([]User, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var content struct {
+		Users []User `yaml:"users"`
+	}
+	err = yaml.Unmarshal(b, &content)
+	if err != nil {
+		return nil, fmt.Errorf("Could not unmarshal users file '%s': %s", file, err.Error())
+	}
+	return content.Users, nil
+}
+
+// BasicAuthenticator authenticate users with basic auth against their bcrypt hash,
+// a password successfully checked is remembered (as a sha256) to not pay bcrypt cost at each request
+type BasicAuthenticator struct {
+	hashes   map[string][]byte
+	policies Policies
+	mu       sync.RWMutex
+	verified map[string][32]byte
+}
+
+func NewBasicAuthenticator(users []User, policies Policies) (*BasicAuthenticator, error) {
+	hashes := make(map[string][]byte)
+	for _, user := range users {
+		if user.Username == "" {
+			return nil, fmt.Errorf("A user has no username")
+		}
+		if _, err := bcrypt.Cost([]byte(user.Password)); err != nil {
+			return nil, fmt.Errorf("Password of user '%s' is not a bcrypt hash: %s", user.Username, err.Error())
+		}
+		hashes[user.Username] = []byte(user.Password)
+	}
+	err := policies.Validate()
+	if err != nil {
+		return nil, err
+	}
+	return &BasicAuthenticator{
+		hashes:   hashes,
+		policies: policies,
+		verified: make(map[string][32]byte),
+	}, nil
+}
+
+// Authenticate give identity of the user found in basic auth
+func (a *BasicAuthenticator) Authenticate(req *http.Request) (*Identity, error) {
+	username, password, ok := req.BasicAuth()
+	if !ok {
+		return nil, nil
+	}
+	hash, ok := a.hashes[username]
+	if !ok {
+		// same cost as for an existing user to not tell which users exist
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return nil, ErrInvalidCredentials
+	}
+	if !a.check(username, hash, password) {
+		return nil, ErrInvalidCredentials
+	}
+	return &Identity{
+		Name:   username,
+		Grants: a.policies.Grants(username, nil),
+	}, nil
+}
+
+func (a *BasicAuthenticator) check(username string, hash []byte, password string) bool {
+	sum := sha256.Sum256([]byte(password))
+	a.mu.RLock()
+	verified, ok := a.verified[username]
+	a.mu.RUnlock()
+	if ok && subtle.ConstantTimeCompare(verified[:], sum[:]) == 1 {
+		return true
+	}
+	if bcrypt.CompareHashAndPassword(hash, []byte(password)) != nil {
+		return false
+	}
+	a.mu.Lock()
+	a.verified[username] = sum
+	a.mu.Unlock()
+	return true
+}
+
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy"), bcrypt.DefaultCost)
@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"crypto/x509"
+	"fmt"
+	"net/http"
+)
+
+const (
+	CertIdentitySubject = "subject"
+	CertIdentityDNS     = "dns"
+	CertIdentityURI     = "uri"
+	CertIdentityEmail   = "email"
+)
+
+// CertAuthenticator authenticate callers with the client certificate verified during tls handshake,
+// name of identity is taken from certificate subject common name or from its first SAN of chosen type
+// and organizational units of subject are used as groups
+type CertAuthenticator struct {
+	identityFrom string
+	policies     Policies
+}
+
+func NewCertAuthenticator(identityFrom string, policies Policies) (*CertAuthenticator, error) {
+	if identityFrom == "" {
+		identityFrom = CertIdentitySubject
+	}
+	if !contains([]string{CertIdentitySubject, CertIdentityDNS, CertIdentityURI, CertIdentityEmail}, identityFrom) {
+		return nil, fmt.Errorf("Unknown client certificate identity '%s', it must be one of subject, dns, uri or email", identityFrom)
+	}
+	err := policies.Validate()
+	if err != nil {
+		return nil, err
+	}
+	return &CertAuthenticator{identityFrom, policies}, nil
+}
+
+// Authenticate give identity of the client certificate, only certificates verified against client CA are considered
+func (a *CertAuthenticator) Authenticate(req *http.Request) (*Identity, error) {
+	if req.TLS == nil || len(req.TLS.VerifiedChains) == 0 || len(req.TLS.VerifiedChains[0]) == 0 {
+		return nil, nil
+	}
+	cert := req.TLS.VerifiedChains[0][0]
+	name := a.name(cert)
+	if name == "" {
+		return nil, fmt.Errorf("%s: client certificate has no %s to identify it", ErrInvalidCredentials.Error(), a.identityFrom)
+	}
+	groups := append([]string{}, cert.Subject.OrganizationalUnit...)
+	return &Identity{
+		Name:   name,
+		Groups: groups,
+		Grants: a.policies.Grants(name, groups),
+	}, nil
+}
+
+func (a *CertAuthenticator) name(cert *x509.Certificate) string {
+	switch a.identityFrom {
+	case CertIdentityDNS:
+		if len(cert.DNSNames) > 0 {
+			return cert.DNSNames[0]
+		}
+	case CertIdentityURI:
+		if len(cert.URIs) > 0 {
+			return cert.URIs[0].String()
+		}
+	case CertIdentityEmail:
+		if len(cert.EmailAddresses) > 0 {
+			return cert.EmailAddresses[0]
+		}
+	default:
+		return cert.Subject.CommonName
+	}
+	return ""
+}
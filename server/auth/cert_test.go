@@ -0,0 +1,66 @@
+package auth_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http/httptest"
+	"net/url"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/orange-cloudfoundry/terraform-secure-backend/server/auth"
+)
+
+var _ = Describe("CertAuthenticator", func() {
+	spiffeId, _ := url.Parse("spiffe://example.com/ci/network")
+	cert := &x509.Certificate{
+		Subject: pkix.Name{
+			CommonName:         "ci-pipeline",
+			OrganizationalUnit: []string{"platform"},
+		},
+		DNSNames: []string{"ci.example.com"},
+		URIs:     []*url.URL{spiffeId},
+	}
+	policies := Policies{
+		{Groups: []string{"platform"}, States: []string{"platform-*"}, Rights: []string{RightWrite}},
+	}
+	authenticate := func(identityFrom string, verified bool) (*Identity, error) {
+		authenticator, err := NewCertAuthenticator(identityFrom, policies)
+		Expect(err).ShouldNot(HaveOccurred())
+		req := httptest.NewRequest("GET", "https://fakeurl.com/states", nil)
+		req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+		if verified {
+			req.TLS.VerifiedChains = [][]*x509.Certificate{{cert}}
+		}
+		return authenticator.Authenticate(req)
+	}
+	It("should give identity from subject with organizational units as groups", func() {
+		identity, err := authenticate("", true)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(identity.Name).Should(Equal("ci-pipeline"))
+		Expect(identity.Can(RightWrite, "platform-network")).Should(BeTrue())
+		Expect(identity.Can(RightRead, "other")).Should(BeFalse())
+	})
+	It("should give identity from chosen SAN", func() {
+		identity, err := authenticate(CertIdentityURI, true)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(identity.Name).Should(Equal("spiffe://example.com/ci/network"))
+
+		identity, err = authenticate(CertIdentityDNS, true)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(identity.Name).Should(Equal("ci.example.com"))
+
+		_, err = authenticate(CertIdentityEmail, true)
+		Expect(err).Should(HaveOccurred())
+	})
+	It("should ignore certificates which were not verified", func() {
+		identity, err := authenticate("", false)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(identity).Should(BeNil())
+	})
+	It("should refuse unknown identity source", func() {
+		_, err := NewCertAuthenticator("serial", policies)
+		Expect(err).Should(HaveOccurred())
+	})
+})
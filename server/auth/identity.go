@@ -0,0 +1,141 @@
+// Package auth authenticates callers of the api and tells what they are allowed to do on tfstates
+package auth
+
+import (
+	"context"
+	"fmt"
+	"path"
+)
+
+const (
+	// RightRead allow retrieving a tfstate, its versions and seeing it when listing
+	RightRead = "read"
+	// RightWrite allow storing, deleting (in trash), copying, moving and restoring a tfstate, it implies read
+	RightWrite = "write"
+	// RightLock allow locking and unlocking a tfstate with its lock id
+	RightLock = "lock"
+	// RightProtected allow modifying and locking a protected tfstate without approval, with write and lock rights
+	RightProtected = "protected"
+	// RightAdmin allow hard deleting and force unlocking a tfstate, it implies all other rights
+	RightAdmin = "admin"
+)
+
+var rights = []string{RightRead, RightWrite, RightLock, RightProtected, RightAdmin}
+
+// Grant give rights on tfstates whose name matches one of the globs in States
+type Grant struct {
+	States []string `json:"states" yaml:"states"`
+	Rights []string `json:"rights" yaml:"rights"`
+}
+
+func (g Grant) Validate() error {
+	for _, glob := range g.States {
+		if _, err := path.Match(glob, ""); err != nil {
+			return fmt.Errorf("Invalid state glob '%s': %s", glob, err.Error())
+		}
+	}
+	for _, right := range g.Rights {
+		if !contains(rights, right) {
+			return fmt.Errorf("Unknown right '%s'", right)
+		}
+	}
+	return nil
+}
+
+func (g Grant) allows(right, state string) bool {
+	if !g.hasRight(right) {
+		return false
+	}
+	for _, glob := range g.States {
+		if ok, _ := path.Match(glob, state); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (g Grant) hasRight(right string) bool {
+	for _, r := range g.Rights {
+		if r == right || r == RightAdmin || (r == RightWrite && right == RightRead) {
+			return true
+		}
+	}
+	return false
+}
+
+// Identity is an authenticated caller with rights it has been granted
+type Identity struct {
+	Name string
+	// Groups are groups or scopes caller belongs to, given by its token
+	Groups []string
+	Grants []Grant
+}
+
+// Anonymous is the identity given when authentication is disabled, it can do anything
+func Anonymous() *Identity {
+	return &Identity{
+		Name:   "",
+		Grants: []Grant{{States: []string{"*"}, Rights: []string{RightAdmin}}},
+	}
+}
+
+// Can tell if identity has right on tfstate
+func (i *Identity) Can(right, state string) bool {
+	if i == nil {
+		return false
+	}
+	for _, grant := range i.Grants {
+		if grant.allows(right, state) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsAdmin tell if identity is admin of all tfstates, it needs admin right granted on glob `*` itself
+// as globs like `?` or `[*]` match the name `*` without matching every tfstate
+func (i *Identity) IsAdmin() bool {
+	if i == nil {
+		return false
+	}
+	for _, grant := range i.Grants {
+		if grant.hasRight(RightAdmin) && contains(grant.States, "*") {
+			return true
+		}
+	}
+	return false
+}
+
+// HasRight tell if identity has right on at least one tfstate
+func (i *Identity) HasRight(right string) bool {
+	if i == nil {
+		return false
+	}
+	for _, grant := range i.Grants {
+		if grant.hasRight(right) && len(grant.States) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+type identityKey struct{}
+
+func WithIdentity(ctx context.Context, identity *Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// FromContext give identity found in ctx, nil if there is none
+func FromContext(ctx context.Context) *Identity {
+	identity, _ := ctx.Value(identityKey{}).(*Identity)
+	return identity
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
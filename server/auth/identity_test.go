@@ -0,0 +1,61 @@
+package auth_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/orange-cloudfoundry/terraform-secure-backend/server/auth"
+)
+
+var _ = Describe("Identity", func() {
+	identity := &Identity{Name: "alice", Grants: []Grant{
+		{States: []string{"team-a-*"}, Rights: []string{RightWrite}},
+		{States: []string{"prod-*"}, Rights: []string{RightLock}},
+		{States: []string{"sandbox"}, Rights: []string{RightAdmin}},
+	}}
+	It("should give rights on tfstates matching globs", func() {
+		Expect(identity.Can(RightWrite, "team-a-network")).Should(BeTrue())
+		Expect(identity.Can(RightWrite, "team-b-network")).Should(BeFalse())
+		Expect(identity.Can(RightLock, "prod-network")).Should(BeTrue())
+		Expect(identity.Can(RightRead, "prod-network")).Should(BeFalse())
+	})
+	It("should make write imply read and admin imply all rights", func() {
+		Expect(identity.Can(RightRead, "team-a-network")).Should(BeTrue())
+		Expect(identity.Can(RightLock, "team-a-network")).Should(BeFalse())
+		for _, right := range []string{RightRead, RightWrite, RightLock, RightAdmin} {
+			Expect(identity.Can(right, "sandbox")).Should(BeTrue())
+		}
+	})
+	It("should tell if a right is given on any tfstate", func() {
+		Expect(identity.HasRight(RightAdmin)).Should(BeTrue())
+		Expect((&Identity{}).HasRight(RightRead)).Should(BeFalse())
+	})
+	It("should give no right to a nil identity", func() {
+		var nilIdentity *Identity
+		Expect(nilIdentity.Can(RightRead, "sandbox")).Should(BeFalse())
+		Expect(nilIdentity.IsAdmin()).Should(BeFalse())
+	})
+	It("should only make admin of all tfstates an identity with admin right on glob *", func() {
+		Expect(identity.IsAdmin()).Should(BeFalse())
+		Expect(Anonymous().IsAdmin()).Should(BeTrue())
+		for _, glob := range []string{"?", "[*]", "[!a]"} {
+			Expect((&Identity{Grants: []Grant{{States: []string{glob}, Rights: []string{RightAdmin}}}}).IsAdmin()).Should(BeFalse())
+		}
+	})
+})
+
+var _ = Describe("Policies", func() {
+	policies := Policies{
+		{Users: []string{"alice"}, States: []string{"team-a-*"}, Rights: []string{RightWrite}},
+		{Users: []string{"*"}, States: []string{"shared"}, Rights: []string{RightRead}},
+	}
+	It("should give grants of policies applying to user", func() {
+		Expect(policies.Grants("alice", nil)).Should(HaveLen(2))
+		Expect(policies.Grants("bob", nil)).Should(HaveLen(1))
+	})
+	It("should refuse unknown rights and invalid globs", func() {
+		Expect(Policies{{Users: []string{"alice"}, States: []string{"*"}, Rights: []string{"delete"}}}.Validate()).ShouldNot(Succeed())
+		Expect(Policies{{Users: []string{"alice"}, States: []string{"["}, Rights: []string{RightRead}}}.Validate()).ShouldNot(Succeed())
+		Expect(Policies{{States: []string{"*"}, Rights: []string{RightRead}}}.Validate()).ShouldNot(Succeed())
+		Expect(policies.Validate()).Should(Succeed())
+	})
+})
@@ -0,0 +1,218 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// jwksTTL is the time keys are kept before being fetched again
+	jwksTTL = time.Hour
+	// jwksMinRefresh is the minimum time between two fetches when a token is signed with an unknown key
+	jwksMinRefresh = 30 * time.Second
+)
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// keySet give keys of an issuer found at jwksURL, or found through OpenID discovery on issuer when jwksURL is empty.
+// Keys are fetched without holding the mutex so that a slow issuer doesn't block callers with known keys.
+type keySet struct {
+	issuer     string
+	jwksURL    string
+	httpClient *http.Client
+	mu         sync.Mutex
+	keys       map[string]crypto.PublicKey
+	fetchedAt  time.Time
+	// fetching is closed when keys being fetched are set, nil when no fetch is running
+	fetching chan struct{}
+}
+
+func newKeySet(issuer, jwksURL string, httpClient *http.Client) *keySet {
+	return &keySet{
+		issuer:     issuer,
+		jwksURL:    jwksURL,
+		httpClient: httpClient,
+		keys:       make(map[string]crypto.PublicKey),
+	}
+}
+
+// Key give key with this id, keys are fetched again when they are too old or when kid is unknown.
+// While keys are fetched, known keys are given right away and callers with unknown kid wait for the fetch.
+func (s *keySet) Key(kid string) (crypto.PublicKey, error) {
+	s.mu.Lock()
+	key, ok := s.find(kid)
+	age := time.Since(s.fetchedAt)
+	fetching := s.fetching
+	if ok && (age < jwksTTL || fetching != nil) {
+		s.mu.Unlock()
+		return key, nil
+	}
+	if fetching != nil {
+		s.mu.Unlock()
+		<-fetching
+		return s.known(kid)
+	}
+	if !ok && age < jwksMinRefresh {
+		s.mu.Unlock()
+		return nil, fmt.Errorf("unknown key '%s'", kid)
+	}
+	fetching = make(chan struct{})
+	s.fetching = fetching
+	s.fetchedAt = time.Now()
+	jwksURL := s.jwksURL
+	s.mu.Unlock()
+
+	keys, jwksURL, err := s.fetch(jwksURL)
+
+	s.mu.Lock()
+	if err == nil {
+		s.keys = keys
+		s.jwksURL = jwksURL
+	}
+	s.fetching = nil
+	close(fetching)
+	s.mu.Unlock()
+	if err != nil {
+		if ok {
+			// keep using known key when issuer is unavailable
+			return key, nil
+		}
+		return nil, err
+	}
+	return s.known(kid)
+}
+
+// known give key with this id among keys already fetched
+func (s *keySet) known(kid string) (crypto.PublicKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, ok := s.find(kid)
+	if !ok {
+		return nil, fmt.Errorf("unknown key '%s'", kid)
+	}
+	return key, nil
+}
+
+// find give key with this id, or the only key when no id is given
+func (s *keySet) find(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(s.keys) == 1 {
+		for _, key := range s.keys {
+			return key, true
+		}
+	}
+	key, ok := s.keys[kid]
+	return key, ok
+}
+
+// fetch give keys found at jwksURL, jwksURL is discovered first when empty and given back,
+// it must be called without holding the mutex
+func (s *keySet) fetch(jwksURL string) (map[string]crypto.PublicKey, string, error) {
+	if jwksURL == "" {
+		var discovery struct {
+			JwksURI string `json:"jwks_uri"`
+		}
+		err := s.getJSON(strings.TrimSuffix(s.issuer, "/")+"/.well-known/openid-configuration", &discovery)
+		if err != nil {
+			return nil, "", fmt.Errorf("could not discover keys of issuer '%s': %s", s.issuer, err.Error())
+		}
+		if discovery.JwksURI == "" {
+			return nil, "", fmt.Errorf("issuer '%s' gives no jwks_uri", s.issuer)
+		}
+		jwksURL = discovery.JwksURI
+	}
+	var jwks struct {
+		Keys []jwk `json:"keys"`
+	}
+	err := s.getJSON(jwksURL, &jwks)
+	if err != nil {
+		return nil, "", fmt.Errorf("could not get keys of issuer '%s': %s", s.issuer, err.Error())
+	}
+	keys := make(map[string]crypto.PublicKey)
+	for _, k := range jwks.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[k.Kid] = key
+	}
+	return keys, jwksURL, nil
+}
+
+func (s *keySet) getJSON(url string, v interface{}) error {
+	resp, err := s.httpClient.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s answered with status code %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve '%s'", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type '%s'", k.Kty)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,248 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// jwtLeeway is the clock skew tolerated when checking expiration and not before dates
+const jwtLeeway = time.Minute
+
+// JWTIssuer is an issuer (e.g.: UAA or an OIDC provider) whose tokens are accepted as bearer tokens
+type JWTIssuer struct {
+	// Issuer must be the `iss` claim of tokens, keys are discovered from <issuer>/.well-known/openid-configuration
+	Issuer string `json:"issuer" yaml:"issuer"`
+	// JwksURL set where keys are found instead of discovering them (e.g.: https://uaa.example.com/token_keys)
+	JwksURL string `json:"jwks_url" yaml:"jwks_url"`
+	// Audiences accepted in `aud` claim, audience is not checked when empty
+	Audiences []string `json:"audiences" yaml:"audiences"`
+	// UsernameClaim is the claim giving name of identity (Default: sub)
+	UsernameClaim string `json:"username_claim" yaml:"username_claim"`
+	// GroupsClaims are claims giving groups matched against policies groups (Default: scope and groups)
+	GroupsClaims      []string `json:"groups_claims" yaml:"groups_claims"`
+	SkipSslValidation bool     `json:"skip_ssl_validation" yaml:"skip_ssl_validation"`
+}
+
+type jwtIssuer struct {
+	JWTIssuer
+	keys *keySet
+}
+
+// JWTAuthenticator authenticate callers with JWT sent as `Authorization: Bearer <token>`
+type JWTAuthenticator struct {
+	issuers  map[string]*jwtIssuer
+	policies Policies
+}
+
+func NewJWTAuthenticator(issuers []JWTIssuer, policies Policies) (*JWTAuthenticator, error) {
+	err := policies.Validate()
+	if err != nil {
+		return nil, err
+	}
+	a := &JWTAuthenticator{
+		issuers:  make(map[string]*jwtIssuer),
+		policies: policies,
+	}
+	for _, issuer := range issuers {
+		if issuer.Issuer == "" {
+			return nil, fmt.Errorf("A jwt issuer has no issuer set")
+		}
+		if issuer.UsernameClaim == "" {
+			issuer.UsernameClaim = "sub"
+		}
+		if len(issuer.GroupsClaims) == 0 {
+			issuer.GroupsClaims = []string{"scope", "groups"}
+		}
+		httpClient := &http.Client{Timeout: 10 * time.Second}
+		if issuer.SkipSslValidation {
+			httpClient.Transport = &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+			}
+		}
+		a.issuers[issuer.Issuer] = &jwtIssuer{
+			JWTIssuer: issuer,
+			keys:      newKeySet(issuer.Issuer, issuer.JwksURL, httpClient),
+		}
+	}
+	return a, nil
+}
+
+// Authenticate give identity of the subject of the bearer token
+func (a *JWTAuthenticator) Authenticate(req *http.Request) (*Identity, error) {
+	authorization := req.Header.Get("Authorization")
+	if len(authorization) < 7 || !strings.EqualFold(authorization[:7], "Bearer ") {
+		return nil, nil
+	}
+	claims, err := a.verify(strings.TrimSpace(authorization[7:]))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", ErrInvalidCredentials.Error(), err.Error())
+	}
+	issuer := a.issuers[claims.string("iss")]
+	name := claims.string(issuer.UsernameClaim)
+	if name == "" {
+		return nil, fmt.Errorf("%s: token has no '%s' claim", ErrInvalidCredentials.Error(), issuer.UsernameClaim)
+	}
+	groups := make([]string, 0)
+	for _, claim := range issuer.GroupsClaims {
+		groups = append(groups, claims.strings(claim)...)
+	}
+	return &Identity{
+		Name:   name,
+		Groups: groups,
+		Grants: a.policies.Grants(name, groups),
+	}, nil
+}
+
+type jwtClaims map[string]interface{}
+
+// verify check signature, issuer, audience and dates of token and give its claims
+func (a *JWTAuthenticator) verify(token string) (jwtClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed token")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	err := decodeSegment(parts[0], &header)
+	if err != nil {
+		return nil, fmt.Errorf("malformed token header: %s", err.Error())
+	}
+	claims := jwtClaims{}
+	err = decodeSegment(parts[1], &claims)
+	if err != nil {
+		return nil, fmt.Errorf("malformed token claims: %s", err.Error())
+	}
+	issuer, ok := a.issuers[claims.string("iss")]
+	if !ok {
+		return nil, fmt.Errorf("issuer '%s' is not trusted", claims.string("iss"))
+	}
+	key, err := issuer.keys.Key(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed token signature: %s", err.Error())
+	}
+	err = verifySignature(header.Alg, key, parts[0]+"."+parts[1], signature)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	exp, ok := claims.time("exp")
+	if !ok || now.After(exp.Add(jwtLeeway)) {
+		return nil, fmt.Errorf("token is expired")
+	}
+	if nbf, ok := claims.time("nbf"); ok && now.Before(nbf.Add(-jwtLeeway)) {
+		return nil, fmt.Errorf("token is not valid yet")
+	}
+	if len(issuer.Audiences) > 0 && !intersect(issuer.Audiences, claims.strings("aud")) {
+		return nil, fmt.Errorf("token audience is not accepted")
+	}
+	return claims, nil
+}
+
+func verifySignature(alg string, key crypto.PublicKey, signed string, signature []byte) error {
+	if len(alg) != 5 {
+		return fmt.Errorf("unsupported algorithm '%s'", alg)
+	}
+	var hash crypto.Hash
+	switch alg[2:] {
+	case "256":
+		hash = crypto.SHA256
+	case "384":
+		hash = crypto.SHA384
+	case "512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported algorithm '%s'", alg)
+	}
+	h := hash.New()
+	h.Write([]byte(signed))
+	digest := h.Sum(nil)
+	switch {
+	case strings.HasPrefix(alg, "RS"):
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("key doesn't match algorithm '%s'", alg)
+		}
+		return rsa.VerifyPKCS1v15(rsaKey, hash, digest, signature)
+	case strings.HasPrefix(alg, "PS"):
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("key doesn't match algorithm '%s'", alg)
+		}
+		return rsa.VerifyPSS(rsaKey, hash, digest, signature, nil)
+	case strings.HasPrefix(alg, "ES"):
+		ecKey, ok := key.(*ecdsa.PublicKey)
+		if !ok || len(signature)%2 != 0 {
+			return fmt.Errorf("key doesn't match algorithm '%s'", alg)
+		}
+		r := new(big.Int).SetBytes(signature[:len(signature)/2])
+		s := new(big.Int).SetBytes(signature[len(signature)/2:])
+		if !ecdsa.Verify(ecKey, digest, r, s) {
+			return fmt.Errorf("invalid signature")
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported algorithm '%s'", alg)
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+func (c jwtClaims) string(name string) string {
+	s, _ := c[name].(string)
+	return s
+}
+
+// strings give values of a claim which is either a list or a space separated string (as `scope`)
+func (c jwtClaims) strings(name string) []string {
+	switch v := c[name].(type) {
+	case string:
+		return strings.Fields(v)
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, e := range v {
+			if s, ok := e.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return []string{}
+}
+
+func (c jwtClaims) time(name string) (time.Time, bool) {
+	v, ok := c[name].(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(v), 0), true
+}
+
+func intersect(a, b []string) bool {
+	for _, e := range a {
+		if contains(b, e) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,176 @@
+package auth_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/orange-cloudfoundry/terraform-secure-backend/server/auth"
+)
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func signRS256(key *rsa.PrivateKey, kid string, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := b64(header) + "." + b64(payload)
+	digest := sha256.Sum256([]byte(signed))
+	signature, _ := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	return signed + "." + b64(signature)
+}
+
+func signES256(key *ecdsa.PrivateKey, kid string, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "ES256", "kid": kid})
+	payload, _ := json.Marshal(claims)
+	signed := b64(header) + "." + b64(payload)
+	digest := sha256.Sum256([]byte(signed))
+	r, s, _ := ecdsa.Sign(rand.Reader, key, digest[:])
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	s.FillBytes(signature[32:])
+	return signed + "." + b64(signature)
+}
+
+var _ = Describe("JWTAuthenticator", func() {
+	var rsaKey *rsa.PrivateKey
+	var ecKey *ecdsa.PrivateKey
+	var issuerServer *httptest.Server
+	var jwksCalls int32
+	var jwksDelay time.Duration
+	var authenticator *JWTAuthenticator
+	var claims map[string]interface{}
+	policies := Policies{
+		{Groups: []string{"tfstate.write"}, States: []string{"*"}, Rights: []string{RightWrite, RightLock}},
+		{Users: []string{"ci-pipeline"}, States: []string{"prod-*"}, Rights: []string{RightRead}},
+	}
+	rsaKey, _ = rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	BeforeEach(func() {
+		jwksCalls = 0
+		jwksDelay = 0
+		mux := http.NewServeMux()
+		mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, req *http.Request) {
+			json.NewEncoder(w).Encode(map[string]string{"jwks_uri": issuerServer.URL + "/keys"})
+		})
+		mux.HandleFunc("/keys", func(w http.ResponseWriter, req *http.Request) {
+			atomic.AddInt32(&jwksCalls, 1)
+			time.Sleep(jwksDelay)
+			json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{
+				{"kty": "RSA", "kid": "rsa-key", "use": "sig", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+				{"kty": "EC", "kid": "ec-key", "crv": "P-256", "x": b64(ecKey.X.Bytes()), "y": b64(ecKey.Y.Bytes())},
+			}})
+		})
+		issuerServer = httptest.NewServer(mux)
+		var err error
+		authenticator, err = NewJWTAuthenticator([]JWTIssuer{{
+			Issuer:    issuerServer.URL,
+			Audiences: []string{"terraform-secure-backend"},
+		}}, policies)
+		Expect(err).ShouldNot(HaveOccurred())
+		claims = map[string]interface{}{
+			"iss":   issuerServer.URL,
+			"sub":   "ci-pipeline",
+			"aud":   []string{"terraform-secure-backend"},
+			"scope": "openid tfstate.write",
+			"exp":   time.Now().Add(time.Hour).Unix(),
+		}
+	})
+	AfterEach(func() {
+		issuerServer.Close()
+	})
+	authenticate := func(token string) (*Identity, error) {
+		req := httptest.NewRequest("GET", "http://fakeurl.com/states", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		return authenticator.Authenticate(req)
+	}
+	It("should give identity with rights mapped from subject and scopes", func() {
+		identity, err := authenticate(signRS256(rsaKey, "rsa-key", claims))
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(identity.Name).Should(Equal("ci-pipeline"))
+		Expect(identity.Groups).Should(ConsistOf("openid", "tfstate.write"))
+		Expect(identity.Can(RightWrite, "dev-network")).Should(BeTrue())
+		Expect(identity.Can(RightAdmin, "prod-network")).Should(BeFalse())
+	})
+	It("should accept tokens signed with elliptic curve keys", func() {
+		identity, err := authenticate(signES256(ecKey, "ec-key", claims))
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(identity.Name).Should(Equal("ci-pipeline"))
+	})
+	It("should cache keys of issuer", func() {
+		for i := 0; i < 3; i++ {
+			_, err := authenticate(signRS256(rsaKey, "rsa-key", claims))
+			Expect(err).ShouldNot(HaveOccurred())
+		}
+		Expect(jwksCalls).Should(BeEquivalentTo(1))
+	})
+	It("should fetch keys once for concurrent callers and let them wait for it", func() {
+		jwksDelay = 100 * time.Millisecond
+		token := signRS256(rsaKey, "rsa-key", claims)
+		var wg sync.WaitGroup
+		errs := make(chan error, 5)
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+				_, err := authenticate(token)
+				errs <- err
+			}()
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			Expect(err).ShouldNot(HaveOccurred())
+		}
+		Expect(atomic.LoadInt32(&jwksCalls)).Should(BeEquivalentTo(1))
+	})
+	It("should refuse tokens which are expired, from another issuer or for another audience", func() {
+		claims["exp"] = time.Now().Add(-time.Hour).Unix()
+		_, err := authenticate(signRS256(rsaKey, "rsa-key", claims))
+		Expect(err).Should(HaveOccurred())
+
+		claims["exp"] = time.Now().Add(time.Hour).Unix()
+		claims["aud"] = "other"
+		_, err = authenticate(signRS256(rsaKey, "rsa-key", claims))
+		Expect(err).Should(HaveOccurred())
+
+		claims["aud"] = "terraform-secure-backend"
+		claims["iss"] = "https://evil.example.com"
+		_, err = authenticate(signRS256(rsaKey, "rsa-key", claims))
+		Expect(err).Should(HaveOccurred())
+	})
+	It("should refuse tokens with invalid signature", func() {
+		otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+		_, err := authenticate(signRS256(otherKey, "rsa-key", claims))
+		Expect(err).Should(HaveOccurred())
+
+		token := signRS256(rsaKey, "rsa-key", claims)
+		parts := strings.Split(token, ".")
+		unsigned := b64([]byte(`{"alg":"none"}`)) + "." + parts[1] + "."
+		_, err = authenticate(unsigned)
+		Expect(err).Should(HaveOccurred())
+	})
+	It("should ignore requests without bearer token", func() {
+		req := httptest.NewRequest("GET", "http://fakeurl.com/states", nil)
+		req.SetBasicAuth("user", "password")
+		identity, err := authenticator.Authenticate(req)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(identity).Should(BeNil())
+	})
+})
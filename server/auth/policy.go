@@ -0,0 +1,45 @@
+package auth
+
+import (
+	"fmt"
+)
+
+// Policy grant rights on tfstates whose name matches one of the globs in States to users and to members of groups,
+// `*` in Users match any authenticated user
+type Policy struct {
+	Users []string `json:"users" yaml:"users"`
+	// Groups are matched against groups or scopes found in tokens
+	Groups []string `json:"groups" yaml:"groups"`
+	States []string `json:"states" yaml:"states"`
+	Rights []string `json:"rights" yaml:"rights"`
+}
+
+func (p Policy) Grant() Grant {
+	return Grant{States: p.States, Rights: p.Rights}
+}
+
+type Policies []Policy
+
+func (p Policies) Validate() error {
+	for i, policy := range p {
+		if len(policy.Users) == 0 && len(policy.Groups) == 0 {
+			return fmt.Errorf("Policy %d has no users or groups", i)
+		}
+		err := policy.Grant().Validate()
+		if err != nil {
+			return fmt.Errorf("Policy %d: %s", i, err.Error())
+		}
+	}
+	return nil
+}
+
+// Grants give grants of policies applying to user or to one of its groups
+func (p Policies) Grants(user string, groups []string) []Grant {
+	grants := make([]Grant, 0)
+	for _, policy := range p {
+		if contains(policy.Users, user) || contains(policy.Users, "*") || intersect(policy.Groups, groups) {
+			grants = append(grants, policy.Grant())
+		}
+	}
+	return grants
+}
@@ -0,0 +1,145 @@
+package server
+
+import (
+	"github.com/orange-cloudfoundry/terraform-secure-backend/server/auth"
+	"net/http"
+	"time"
+)
+
+// LockoutLogger is told about callers locked out after too many failed authentications
+type LockoutLogger interface {
+	LogLockout(req *http.Request, key string, duration time.Duration)
+}
+
+// AuthMiddleware set identity of the caller in request context, requests without valid credentials are refused.
+// When there is no authenticator, authentication is disabled and callers are anonymous with all rights.
+type AuthMiddleware struct {
+	authenticators []auth.Authenticator
+	problemWriter  *ProblemWriter
+	failures       *FailureTracker
+	limiter        *RateLimiter
+	lockoutLoggers []LockoutLogger
+}
+
+func NewAuthMiddleware(problemWriter *ProblemWriter, authenticators ...auth.Authenticator) *AuthMiddleware {
+	return &AuthMiddleware{authenticators: authenticators, problemWriter: problemWriter}
+}
+
+// WithFailureTracker lock out ips and usernames after too many failed authentications,
+// lockouts are given to lockout loggers
+func (m AuthMiddleware) WithFailureTracker(failures *FailureTracker, lockoutLoggers ...LockoutLogger) *AuthMiddleware {
+	m.failures = failures
+	m.lockoutLoggers = lockoutLoggers
+	return &m
+}
+
+// WithRateLimiter limit requests per identity, anonymous callers are limited per ip
+func (m AuthMiddleware) WithRateLimiter(limiter *RateLimiter) *AuthMiddleware {
+	m.limiter = limiter
+	return &m
+}
+
+func (m AuthMiddleware) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		keys := m.failureKeys(req)
+		if m.refuseLocked(w, req, keys) {
+			return
+		}
+		identity, err := m.authenticate(req)
+		if err != nil || identity == nil {
+			m.refuse(w, req, keys, err)
+			return
+		}
+		m.serveIdentity(identity, keys, next, w, req)
+	})
+}
+
+// refuseLocked answer too many requests when one of keys is locked out and tell if it did
+func (m AuthMiddleware) refuseLocked(w http.ResponseWriter, req *http.Request, keys []string) bool {
+	wait, locked := m.locked(keys)
+	if !locked {
+		return false
+	}
+	setRetryAfter(w, wait)
+	m.problemWriter.Write(w, req, NewProblem(http.StatusTooManyRequests, "Too many failed authentications, retry later"))
+	return true
+}
+
+// refuse answer unauthorized, err is counted as a failed authentication when not nil
+func (m AuthMiddleware) refuse(w http.ResponseWriter, req *http.Request, keys []string, err error) {
+	if err != nil {
+		RequestLogger(req).WithField("action", "authenticate").Warnf("Authentication failed: %s", err.Error())
+		m.fail(req, keys)
+	}
+	w.Header().Set("WWW-Authenticate", `Basic realm="Restricted"`)
+	m.problemWriter.Write(w, req, NewProblem(http.StatusUnauthorized, "Valid credentials must be given"))
+}
+
+// serveIdentity serve request of an authenticated caller, its failures are forgotten and it is rate limited
+func (m AuthMiddleware) serveIdentity(identity *auth.Identity, keys []string, next http.Handler, w http.ResponseWriter, req *http.Request) {
+	if m.failures != nil {
+		for _, key := range keys {
+			m.failures.Reset(key)
+		}
+	}
+	SetLoggedUser(req.Context(), identity.Name)
+	if m.limiter != nil {
+		key := "ip:" + remoteIp(req)
+		if identity.Name != "" {
+			key = "user:" + identity.Name
+		}
+		if wait, ok := m.limiter.Allow(key); !ok {
+			setRetryAfter(w, wait)
+			m.problemWriter.Write(w, req, NewProblem(http.StatusTooManyRequests, "Rate limit exceeded, retry later"))
+			return
+		}
+	}
+	next.ServeHTTP(w, req.WithContext(auth.WithIdentity(req.Context(), identity)))
+}
+
+// failureKeys give keys on which failed authentications are counted, ip first then username if any
+func (m AuthMiddleware) failureKeys(req *http.Request) []string {
+	if m.failures == nil {
+		return nil
+	}
+	keys := []string{"ip:" + remoteIp(req)}
+	if username, _, ok := req.BasicAuth(); ok && username != "" {
+		keys = append(keys, "user:"+username)
+	}
+	return keys
+}
+
+func (m AuthMiddleware) locked(keys []string) (time.Duration, bool) {
+	for _, key := range keys {
+		if wait, locked := m.failures.Locked(key); locked {
+			return wait, true
+		}
+	}
+	return 0, false
+}
+
+func (m AuthMiddleware) fail(req *http.Request, keys []string) {
+	for _, key := range keys {
+		duration, locked := m.failures.Fail(key)
+		if !locked {
+			continue
+		}
+		RequestLogger(req).WithField("action", "authenticate").Warnf("Locking out %s for %s after too many failed authentications", key, duration)
+		for _, lockoutLogger := range m.lockoutLoggers {
+			lockoutLogger.LogLockout(req, key, duration)
+		}
+	}
+}
+
+func (m AuthMiddleware) authenticate(req *http.Request) (*auth.Identity, error) {
+	if len(m.authenticators) == 0 {
+		return auth.Anonymous(), nil
+	}
+	for _, authenticator := range m.authenticators {
+		identity, err := authenticator.Authenticate(req)
+		if err != nil || identity != nil {
+			return identity, err
+		}
+	}
+	return nil, nil
+}
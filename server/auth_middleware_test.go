@@ -0,0 +1,126 @@
+package server_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/orange-cloudfoundry/terraform-secure-backend/server"
+	"github.com/orange-cloudfoundry/terraform-secure-backend/server/auth"
+	"golang.org/x/crypto/bcrypt"
+	"net/http"
+	"net/http/httptest"
+	"time"
+)
+
+type fakeLockoutLogger struct {
+	keys []string
+}
+
+func (l *fakeLockoutLogger) LogLockout(req *http.Request, key string, duration time.Duration) {
+	l.keys = append(l.keys, key)
+}
+
+var _ = Describe("AuthMiddleware", func() {
+	var identity *auth.Identity
+	var responseRecorder *httptest.ResponseRecorder
+	var next http.Handler
+	BeforeEach(func() {
+		identity = nil
+		responseRecorder = httptest.NewRecorder()
+		next = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			identity = auth.FromContext(req.Context())
+		})
+	})
+	It("should give anonymous identity with all rights when there is no authenticator", func() {
+		NewAuthMiddleware(NewProblemWriter(false)).Middleware(next).ServeHTTP(responseRecorder, httptest.NewRequest("GET", "http://fakeurl.com/states", nil))
+
+		Expect(responseRecorder.Code).Should(Equal(http.StatusOK))
+		Expect(identity.Can(auth.RightAdmin, "any")).Should(BeTrue())
+	})
+	Context("with basic auth users", func() {
+		var middleware http.Handler
+		BeforeEach(func() {
+			hash, _ := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+			authenticator, err := auth.NewBasicAuthenticator([]auth.User{{Username: "alice", Password: string(hash)}}, auth.Policies{
+				{Users: []string{"alice"}, States: []string{"team-a-*"}, Rights: []string{auth.RightWrite}},
+			})
+			Expect(err).ShouldNot(HaveOccurred())
+			middleware = NewAuthMiddleware(NewProblemWriter(false), authenticator).Middleware(next)
+		})
+		It("should set identity of user with its grants", func() {
+			req := httptest.NewRequest("GET", "http://fakeurl.com/states", nil)
+			req.SetBasicAuth("alice", "password")
+			middleware.ServeHTTP(responseRecorder, req)
+
+			Expect(responseRecorder.Code).Should(Equal(http.StatusOK))
+			Expect(identity.Name).Should(Equal("alice"))
+			Expect(identity.Can(auth.RightRead, "team-a-network")).Should(BeTrue())
+			Expect(identity.Can(auth.RightRead, "team-b-network")).Should(BeFalse())
+		})
+		It("should answer with http code unauthorized when credentials are wrong or missing", func() {
+			req := httptest.NewRequest("GET", "http://fakeurl.com/states", nil)
+			req.SetBasicAuth("alice", "wrong")
+			middleware.ServeHTTP(responseRecorder, req)
+			Expect(responseRecorder.Code).Should(Equal(http.StatusUnauthorized))
+
+			responseRecorder = httptest.NewRecorder()
+			middleware.ServeHTTP(responseRecorder, httptest.NewRequest("GET", "http://fakeurl.com/states", nil))
+			Expect(responseRecorder.Code).Should(Equal(http.StatusUnauthorized))
+			Expect(responseRecorder.Header().Get("WWW-Authenticate")).Should(HavePrefix("Basic"))
+			Expect(identity).Should(BeNil())
+		})
+		Context("with failure tracker", func() {
+			var lockoutLogger *fakeLockoutLogger
+			BeforeEach(func() {
+				hash, _ := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+				authenticator, _ := auth.NewBasicAuthenticator([]auth.User{{Username: "alice", Password: string(hash)}}, nil)
+				lockoutLogger = &fakeLockoutLogger{}
+				middleware = NewAuthMiddleware(NewProblemWriter(false), authenticator).
+					WithFailureTracker(NewFailureTracker(2, time.Minute), lockoutLogger).
+					Middleware(next)
+			})
+			serve := func(password string) *httptest.ResponseRecorder {
+				recorder := httptest.NewRecorder()
+				req := httptest.NewRequest("GET", "http://fakeurl.com/states", nil)
+				req.SetBasicAuth("alice", password)
+				middleware.ServeHTTP(recorder, req)
+				return recorder
+			}
+			It("should lock out caller after too many failed authentications even with right credentials", func() {
+				Expect(serve("wrong").Code).Should(Equal(http.StatusUnauthorized))
+				Expect(serve("wrong").Code).Should(Equal(http.StatusUnauthorized))
+
+				recorder := serve("password")
+				Expect(recorder.Code).Should(Equal(http.StatusTooManyRequests))
+				Expect(recorder.Header().Get("Retry-After")).Should(Equal("60"))
+				Expect(lockoutLogger.keys).Should(ConsistOf("ip:192.0.2.1", "user:alice"))
+			})
+			It("should forget failures of ip and username after a successful authentication", func() {
+				Expect(serve("wrong").Code).Should(Equal(http.StatusUnauthorized))
+				Expect(serve("password").Code).Should(Equal(http.StatusOK))
+
+				req := httptest.NewRequest("GET", "http://fakeurl.com/states", nil)
+				req.SetBasicAuth("bob", "wrong")
+				middleware.ServeHTTP(httptest.NewRecorder(), req)
+
+				Expect(serve("password").Code).Should(Equal(http.StatusOK))
+				Expect(lockoutLogger.keys).Should(BeEmpty())
+			})
+			It("should not count requests without credentials", func() {
+				for i := 0; i < 3; i++ {
+					middleware.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://fakeurl.com/states", nil))
+				}
+				Expect(serve("password").Code).Should(Equal(http.StatusOK))
+			})
+		})
+	})
+	It("should answer with http code too many requests when identity exceeds rate limit", func() {
+		middleware := NewAuthMiddleware(NewProblemWriter(false)).WithRateLimiter(NewRateLimiter(1, 1)).Middleware(next)
+		middleware.ServeHTTP(responseRecorder, httptest.NewRequest("GET", "http://fakeurl.com/states", nil))
+		Expect(responseRecorder.Code).Should(Equal(http.StatusOK))
+
+		responseRecorder = httptest.NewRecorder()
+		middleware.ServeHTTP(responseRecorder, httptest.NewRequest("GET", "http://fakeurl.com/states", nil))
+		Expect(responseRecorder.Code).Should(Equal(http.StatusTooManyRequests))
+		Expect(responseRecorder.Header().Get("Retry-After")).Should(Equal("1"))
+	})
+})
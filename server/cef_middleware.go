@@ -7,6 +7,7 @@ import (
 	"io"
 	"net/http"
 	"strings"
+	"time"
 )
 
 type CEFMiddleware struct {
@@ -28,12 +29,52 @@ func (h CEFMiddleware) Middleware(next http.Handler) http.Handler {
 			WithField("request", req.URL.Path).
 			WithField("requestMethod", req.Method).
 			WithField("httpStatusCode", sw.status).
-			WithField("src", strings.Split(req.RemoteAddr, ":")[0]).
+			WithField("src", remoteIp(req)).
 			WithField("xForwardedFor", strings.Replace(req.Header.Get("x-forwarded-for"), " ", "", -1)).
+			WithField("requestId", RequestId(req.Context())).
+			WithField("suser", LoggedUser(req)).
 			Info(fmt.Sprintf("%s %s", req.Method, req.URL.Path))
 	})
 }
 
+// LogLockout emit a warning event when a caller is locked out after too many failed authentications
+func (h CEFMiddleware) LogLockout(req *http.Request, key string, duration time.Duration) {
+	kind, value := "", key
+	if i := strings.Index(key, ":"); i >= 0 {
+		kind, value = key[:i], key[i+1:]
+	}
+	entry := h.logger.
+		WithField(cef.KeySignatureID, "authentication-lockout").
+		WithField("request", req.URL.Path).
+		WithField("requestMethod", req.Method).
+		WithField("src", remoteIp(req)).
+		WithField("requestId", RequestId(req.Context())).
+		WithField("act", "lockout").
+		WithField("cn1", int(duration.Seconds())).
+		WithField("cn1Label", "lockoutSeconds")
+	if kind == "user" {
+		entry = entry.WithField("suser", value)
+	}
+	entry.Warn(fmt.Sprintf("Authentication lockout of %s %s", kind, value))
+}
+
+// LogAudit emit a warning event for each operation on protected tfstates and their approvals
+func (h CEFMiddleware) LogAudit(req *http.Request, event AuditEvent) {
+	h.logger.
+		WithField(cef.KeySignatureID, "protected-state").
+		WithField("request", req.URL.Path).
+		WithField("requestMethod", req.Method).
+		WithField("src", remoteIp(req)).
+		WithField("suser", identityName(req)).
+		WithField("requestId", RequestId(req.Context())).
+		WithField("act", event.Action).
+		WithField("cs1", event.State).
+		WithField("cs1Label", "tfstate").
+		WithField("cs2", event.ApprovalId).
+		WithField("cs2Label", "approvalId").
+		Warn(event.Detail)
+}
+
 type statusWriter struct {
 	http.ResponseWriter
 	status int
@@ -0,0 +1,193 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+type clientIpKey struct{}
+
+// ClientIpResolver find ip of client, X-Forwarded-For header is only used when request comes from a trusted proxy
+type ClientIpResolver struct {
+	trustedProxies []*net.IPNet
+}
+
+func NewClientIpResolver(trustedProxies []string) (*ClientIpResolver, error) {
+	nets, err := parseCIDRs(trustedProxies)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid trusted_proxies: %s", err.Error())
+	}
+	return &ClientIpResolver{nets}, nil
+}
+
+// Middleware set resolved client ip in request context, it is then given by remoteIp
+func (r *ClientIpResolver) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		next.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), clientIpKey{}, r.Resolve(req))))
+	})
+}
+
+// Resolve give ip of client, when request comes from a trusted proxy, X-Forwarded-For is read from right to left
+// and first ip which is not a trusted proxy is given
+func (r *ClientIpResolver) Resolve(req *http.Request) string {
+	ip := hostIp(req.RemoteAddr)
+	if !r.trusted(ip) {
+		return ip
+	}
+	forwarded := make([]string, 0)
+	for _, header := range req.Header.Values("X-Forwarded-For") {
+		forwarded = append(forwarded, strings.Split(header, ",")...)
+	}
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		forwardedIp := strings.TrimSpace(forwarded[i])
+		if net.ParseIP(forwardedIp) == nil {
+			break
+		}
+		ip = forwardedIp
+		if !r.trusted(ip) {
+			break
+		}
+	}
+	return ip
+}
+
+func (r *ClientIpResolver) trusted(ip string) bool {
+	if r == nil {
+		return false
+	}
+	return containsIp(r.trustedProxies, ip)
+}
+
+// remoteIp give ip of client, as resolved by ClientIpResolver when it is used
+func remoteIp(req *http.Request) string {
+	if ip, ok := req.Context().Value(clientIpKey{}).(string); ok {
+		return ip
+	}
+	return hostIp(req.RemoteAddr)
+}
+
+func hostIp(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
+
+// IpRule restrict access to tfstates whose name starts with prefix to clients in given ip ranges
+type IpRule struct {
+	Prefix string   `json:"prefix" yaml:"prefix"`
+	Ips    []string `json:"ips" yaml:"ips"`
+}
+
+type ipRule struct {
+	prefix string
+	nets   []*net.IPNet
+}
+
+// IpAllowlist restrict access to clients in allowed ip ranges, globally and by tfstate name prefix.
+// A nil allowlist allows any client.
+type IpAllowlist struct {
+	global []*net.IPNet
+	rules  []ipRule
+}
+
+// NewIpAllowlist create an allowlist from ips or CIDRs, nil is given when there is no restriction
+func NewIpAllowlist(allowedIps []string, rules []IpRule) (*IpAllowlist, error) {
+	if len(allowedIps) == 0 && len(rules) == 0 {
+		return nil, nil
+	}
+	global, err := parseCIDRs(allowedIps)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid allowed_ips: %s", err.Error())
+	}
+	allowlist := &IpAllowlist{global: global}
+	for _, rule := range rules {
+		nets, err := parseCIDRs(rule.Ips)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid ips for prefix '%s': %s", rule.Prefix, err.Error())
+		}
+		allowlist.rules = append(allowlist.rules, ipRule{rule.Prefix, nets})
+	}
+	return allowlist, nil
+}
+
+// Allow tell if client ip is in global ranges, all ips are allowed when there is none
+func (a *IpAllowlist) Allow(ip string) bool {
+	if a == nil || len(a.global) == 0 {
+		return true
+	}
+	return containsIp(a.global, ip)
+}
+
+// AllowState tell if client ip is allowed globally and by all rules whose prefix matches tfstate name
+func (a *IpAllowlist) AllowState(ip, name string) bool {
+	if !a.Allow(ip) {
+		return false
+	}
+	if a == nil {
+		return true
+	}
+	for _, rule := range a.rules {
+		if strings.HasPrefix(name, rule.prefix) && !containsIp(rule.nets, ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// Middleware refuse requests from clients which are not in global ranges
+func (a *IpAllowlist) Middleware(problemWriter *ProblemWriter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if !a.Allow(remoteIp(req)) {
+				RequestLogger(req).WithField("action", "allowlist").Warnf("Refusing client ip '%s'", remoteIp(req))
+				problemWriter.Write(w, req, NewProblem(http.StatusForbidden, "Your ip address is not allowed"))
+				return
+			}
+			next.ServeHTTP(w, req)
+		})
+	}
+}
+
+// parseCIDRs parse CIDRs, single ips are taken as a range of one ip
+func parseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0)
+	for _, cidr := range cidrs {
+		if !strings.Contains(cidr, "/") {
+			ip := net.ParseIP(cidr)
+			if ip == nil {
+				return nil, fmt.Errorf("'%s' is not an ip or a CIDR", cidr)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+func containsIp(nets []*net.IPNet, ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, ipNet := range nets {
+		if ipNet.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+package server_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/orange-cloudfoundry/terraform-secure-backend/server"
+	"net/http"
+	"net/http/httptest"
+)
+
+var _ = Describe("ClientIp", func() {
+	Context("ClientIpResolver", func() {
+		var resolver *ClientIpResolver
+		BeforeEach(func() {
+			var err error
+			resolver, err = NewClientIpResolver([]string{"10.0.0.0/24", "fd00::1"})
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+		newRequest := func(remoteAddr string, forwardedFor ...string) *http.Request {
+			req := httptest.NewRequest("GET", "http://fakeurl.com/states", nil)
+			req.RemoteAddr = remoteAddr
+			for _, header := range forwardedFor {
+				req.Header.Add("X-Forwarded-For", header)
+			}
+			return req
+		}
+		It("should ignore X-Forwarded-For when request doesn't come from a trusted proxy", func() {
+			Expect(resolver.Resolve(newRequest("192.168.1.1:4000", "1.2.3.4"))).Should(Equal("192.168.1.1"))
+		})
+		It("should give first ip which is not a trusted proxy from the right of X-Forwarded-For", func() {
+			Expect(resolver.Resolve(newRequest("10.0.0.1:4000", "6.6.6.6, 1.2.3.4, 10.0.0.2"))).Should(Equal("1.2.3.4"))
+			Expect(resolver.Resolve(newRequest("10.0.0.1:4000", "6.6.6.6", "1.2.3.4"))).Should(Equal("1.2.3.4"))
+		})
+		It("should stop on invalid ip in X-Forwarded-For", func() {
+			Expect(resolver.Resolve(newRequest("10.0.0.1:4000", "1.2.3.4, garbage"))).Should(Equal("10.0.0.1"))
+		})
+		It("should handle ipv6 addresses", func() {
+			Expect(resolver.Resolve(newRequest("[fd00::2]:4000", "1.2.3.4"))).Should(Equal("fd00::2"))
+			Expect(resolver.Resolve(newRequest("[fd00::1]:4000", "2001:db8::5"))).Should(Equal("2001:db8::5"))
+		})
+		It("should refuse invalid trusted proxies", func() {
+			_, err := NewClientIpResolver([]string{"not-an-ip"})
+			Expect(err).Should(HaveOccurred())
+		})
+	})
+	Context("IpAllowlist", func() {
+		It("should allow all clients when there is no restriction", func() {
+			allowlist, err := NewIpAllowlist(nil, nil)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(allowlist.Allow("1.2.3.4")).Should(BeTrue())
+			Expect(allowlist.AllowState("1.2.3.4", "prod")).Should(BeTrue())
+		})
+		It("should allow clients in global ranges and in ranges of all prefixes matching tfstate", func() {
+			allowlist, err := NewIpAllowlist([]string{"10.0.0.0/8"}, []IpRule{
+				{Prefix: "prod-", Ips: []string{"10.1.0.0/16"}},
+				{Prefix: "prod-db", Ips: []string{"10.1.1.0/24"}},
+			})
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(allowlist.Allow("10.2.0.1")).Should(BeTrue())
+			Expect(allowlist.Allow("192.168.0.1")).Should(BeFalse())
+			Expect(allowlist.AllowState("10.2.0.1", "dev-network")).Should(BeTrue())
+			Expect(allowlist.AllowState("10.2.0.1", "prod-network")).Should(BeFalse())
+			Expect(allowlist.AllowState("10.1.0.1", "prod-network")).Should(BeTrue())
+			Expect(allowlist.AllowState("10.1.0.1", "prod-db")).Should(BeFalse())
+			Expect(allowlist.AllowState("10.1.1.1", "prod-db")).Should(BeTrue())
+		})
+		It("should answer with http code forbidden to clients not in global ranges", func() {
+			allowlist, err := NewIpAllowlist([]string{"10.0.0.0/8"}, nil)
+			Expect(err).ShouldNot(HaveOccurred())
+			handler := allowlist.Middleware(NewProblemWriter(false))(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+
+			responseRecorder := httptest.NewRecorder()
+			handler.ServeHTTP(responseRecorder, httptest.NewRequest("GET", "http://fakeurl.com/states", nil))
+			Expect(responseRecorder.Code).Should(Equal(http.StatusForbidden))
+
+			responseRecorder = httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "http://fakeurl.com/states", nil)
+			req.RemoteAddr = "10.0.0.5:4000"
+			handler.ServeHTTP(responseRecorder, req)
+			Expect(responseRecorder.Code).Should(Equal(http.StatusOK))
+		})
+		It("should refuse invalid ranges", func() {
+			_, err := NewIpAllowlist([]string{"10.0.0.0/33"}, nil)
+			Expect(err).Should(HaveOccurred())
+		})
+	})
+})
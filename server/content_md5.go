@@ -0,0 +1,66 @@
+package server
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"io"
+)
+
+// ContentMD5Reader compute md5 of data while it is read and, when reaching end of data,
+// give an error instead of io.EOF if it doesn't match expected md5
+type ContentMD5Reader struct {
+	reader   io.ReadCloser
+	hash     hash.Hash
+	expected []byte
+	computed []byte
+}
+
+// NewContentMD5Reader create a ContentMD5Reader from a Content-MD5 header value (base64 encoded md5)
+func NewContentMD5Reader(reader io.ReadCloser, contentMD5 string) (*ContentMD5Reader, error) {
+	expected, err := base64.StdEncoding.DecodeString(contentMD5)
+	if err != nil || len(expected) != md5.Size {
+		return nil, fmt.Errorf("Invalid Content-MD5 header '%s'", contentMD5)
+	}
+	return &ContentMD5Reader{
+		reader:   reader,
+		hash:     md5.New(),
+		expected: expected,
+	}, nil
+}
+
+func (r *ContentMD5Reader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.hash.Write(p[:n])
+	if err != io.EOF {
+		return n, err
+	}
+	r.computed = r.hash.Sum(nil)
+	if r.Mismatch() {
+		return n, r.MismatchError()
+	}
+	return n, err
+}
+
+func (r *ContentMD5Reader) Close() error {
+	return r.reader.Close()
+}
+
+// Mismatch tell if md5 of data read didn't match expected one
+func (r *ContentMD5Reader) Mismatch() bool {
+	return r.computed != nil && !bytes.Equal(r.computed, r.expected)
+}
+
+// MismatchError give expected and computed md5 when they don't match, nil otherwise
+func (r *ContentMD5Reader) MismatchError() error {
+	if !r.Mismatch() {
+		return nil
+	}
+	return fmt.Errorf(
+		"Content-MD5 mismatch: header gives '%s' but body has '%s'",
+		base64.StdEncoding.EncodeToString(r.expected),
+		base64.StdEncoding.EncodeToString(r.computed),
+	)
+}
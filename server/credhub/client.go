@@ -0,0 +1,57 @@
+package credhub
+
+import (
+	credhubcli "code.cloudfoundry.org/credhub-cli/credhub"
+	"code.cloudfoundry.org/credhub-cli/credhub/permissions"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+)
+
+// Client is the credhub cli client with permission calls of credhub api v2 it lacks
+type Client struct {
+	*credhubcli.CredHub
+}
+
+func NewClient(ch *credhubcli.CredHub) *Client {
+	return &Client{ch}
+}
+
+// GetPermissionByPathActor give permission of actor on path
+func (c Client) GetPermissionByPathActor(path string, actor string) (*permissions.Permission, error) {
+	query := url.Values{}
+	query.Set("path", path)
+	query.Set("actor", actor)
+	resp, err := c.Request(http.MethodGet, "/api/v2/permissions", query, nil, true)
+	if err != nil {
+		return nil, err
+	}
+	return decodePermission(resp)
+}
+
+// UpdatePermission replace operations of permission with this uuid
+func (c Client) UpdatePermission(uuid string, path string, actor string, ops []string) (*permissions.Permission, error) {
+	requestBody := map[string]interface{}{
+		"path":       path,
+		"actor":      actor,
+		"operations": ops,
+	}
+	resp, err := c.Request(http.MethodPut, "/api/v2/permissions/"+uuid, nil, requestBody, true)
+	if err != nil {
+		return nil, err
+	}
+	return decodePermission(resp)
+}
+
+func decodePermission(resp *http.Response) (*permissions.Permission, error) {
+	defer resp.Body.Close()
+	defer io.Copy(ioutil.Discard, resp.Body)
+	var perm permissions.Permission
+	err := json.NewDecoder(resp.Body).Decode(&perm)
+	if err != nil {
+		return nil, err
+	}
+	return &perm, nil
+}
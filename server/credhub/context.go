@@ -0,0 +1,19 @@
+package credhub
+
+import (
+	"context"
+)
+
+// ContextBinder is implemented by clients which can be bound to a context,
+// calls made by a bound client are traced as children of the span found in context
+type ContextBinder interface {
+	WithContext(ctx context.Context) CredhubClient
+}
+
+// WithContext give client bound to ctx, client is given back unchanged if it can't be bound
+func WithContext(client CredhubClient, ctx context.Context) CredhubClient {
+	if binder, ok := client.(ContextBinder); ok {
+		return binder.WithContext(ctx)
+	}
+	return client
+}
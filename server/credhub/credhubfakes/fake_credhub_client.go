@@ -6,10 +6,26 @@ import (
 
 	"code.cloudfoundry.org/credhub-cli/credhub/credentials"
 	"code.cloudfoundry.org/credhub-cli/credhub/credentials/values"
+	"code.cloudfoundry.org/credhub-cli/credhub/permissions"
 	"github.com/orange-cloudfoundry/terraform-secure-backend/server/credhub"
 )
 
 type FakeCredhubClient struct {
+	AddPermissionStub        func(string, string, []string) (*permissions.Permission, error)
+	addPermissionMutex       sync.RWMutex
+	addPermissionArgsForCall []struct {
+		arg1 string
+		arg2 string
+		arg3 []string
+	}
+	addPermissionReturns struct {
+		result1 *permissions.Permission
+		result2 error
+	}
+	addPermissionReturnsOnCall map[int]struct {
+		result1 *permissions.Permission
+		result2 error
+	}
 	DeleteStub        func(string) error
 	deleteMutex       sync.RWMutex
 	deleteArgsForCall []struct {
@@ -34,6 +50,32 @@ type FakeCredhubClient struct {
 		result1 credentials.FindResults
 		result2 error
 	}
+	GetAllVersionsStub        func(string) ([]credentials.Credential, error)
+	getAllVersionsMutex       sync.RWMutex
+	getAllVersionsArgsForCall []struct {
+		arg1 string
+	}
+	getAllVersionsReturns struct {
+		result1 []credentials.Credential
+		result2 error
+	}
+	getAllVersionsReturnsOnCall map[int]struct {
+		result1 []credentials.Credential
+		result2 error
+	}
+	GetByIdStub        func(string) (credentials.Credential, error)
+	getByIdMutex       sync.RWMutex
+	getByIdArgsForCall []struct {
+		arg1 string
+	}
+	getByIdReturns struct {
+		result1 credentials.Credential
+		result2 error
+	}
+	getByIdReturnsOnCall map[int]struct {
+		result1 credentials.Credential
+		result2 error
+	}
 	GetLatestJSONStub        func(string) (credentials.JSON, error)
 	getLatestJSONMutex       sync.RWMutex
 	getLatestJSONArgsForCall []struct {
@@ -60,6 +102,20 @@ type FakeCredhubClient struct {
 		result1 credentials.Value
 		result2 error
 	}
+	GetPermissionByPathActorStub        func(string, string) (*permissions.Permission, error)
+	getPermissionByPathActorMutex       sync.RWMutex
+	getPermissionByPathActorArgsForCall []struct {
+		arg1 string
+		arg2 string
+	}
+	getPermissionByPathActorReturns struct {
+		result1 *permissions.Permission
+		result2 error
+	}
+	getPermissionByPathActorReturnsOnCall map[int]struct {
+		result1 *permissions.Permission
+		result2 error
+	}
 	SetJSONStub        func(string, values.JSON) (credentials.JSON, error)
 	setJSONMutex       sync.RWMutex
 	setJSONArgsForCall []struct {
@@ -88,25 +144,113 @@ type FakeCredhubClient struct {
 		result1 credentials.Value
 		result2 error
 	}
+	UpdatePermissionStub        func(string, string, string, []string) (*permissions.Permission, error)
+	updatePermissionMutex       sync.RWMutex
+	updatePermissionArgsForCall []struct {
+		arg1 string
+		arg2 string
+		arg3 string
+		arg4 []string
+	}
+	updatePermissionReturns struct {
+		result1 *permissions.Permission
+		result2 error
+	}
+	updatePermissionReturnsOnCall map[int]struct {
+		result1 *permissions.Permission
+		result2 error
+	}
 	invocations      map[string][][]interface{}
 	invocationsMutex sync.RWMutex
 }
 
+func (fake *FakeCredhubClient) AddPermission(arg1 string, arg2 string, arg3 []string) (*permissions.Permission, error) {
+	var arg3Copy []string
+	if arg3 != nil {
+		arg3Copy = make([]string, len(arg3))
+		copy(arg3Copy, arg3)
+	}
+	fake.addPermissionMutex.Lock()
+	ret, specificReturn := fake.addPermissionReturnsOnCall[len(fake.addPermissionArgsForCall)]
+	fake.addPermissionArgsForCall = append(fake.addPermissionArgsForCall, struct {
+		arg1 string
+		arg2 string
+		arg3 []string
+	}{arg1, arg2, arg3Copy})
+	stub := fake.AddPermissionStub
+	fakeReturns := fake.addPermissionReturns
+	fake.recordInvocation("AddPermission", []interface{}{arg1, arg2, arg3Copy})
+	fake.addPermissionMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2, arg3)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeCredhubClient) AddPermissionCallCount() int {
+	fake.addPermissionMutex.RLock()
+	defer fake.addPermissionMutex.RUnlock()
+	return len(fake.addPermissionArgsForCall)
+}
+
+func (fake *FakeCredhubClient) AddPermissionCalls(stub func(string, string, []string) (*permissions.Permission, error)) {
+	fake.addPermissionMutex.Lock()
+	defer fake.addPermissionMutex.Unlock()
+	fake.AddPermissionStub = stub
+}
+
+func (fake *FakeCredhubClient) AddPermissionArgsForCall(i int) (string, string, []string) {
+	fake.addPermissionMutex.RLock()
+	defer fake.addPermissionMutex.RUnlock()
+	argsForCall := fake.addPermissionArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3
+}
+
+func (fake *FakeCredhubClient) AddPermissionReturns(result1 *permissions.Permission, result2 error) {
+	fake.addPermissionMutex.Lock()
+	defer fake.addPermissionMutex.Unlock()
+	fake.AddPermissionStub = nil
+	fake.addPermissionReturns = struct {
+		result1 *permissions.Permission
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeCredhubClient) AddPermissionReturnsOnCall(i int, result1 *permissions.Permission, result2 error) {
+	fake.addPermissionMutex.Lock()
+	defer fake.addPermissionMutex.Unlock()
+	fake.AddPermissionStub = nil
+	if fake.addPermissionReturnsOnCall == nil {
+		fake.addPermissionReturnsOnCall = make(map[int]struct {
+			result1 *permissions.Permission
+			result2 error
+		})
+	}
+	fake.addPermissionReturnsOnCall[i] = struct {
+		result1 *permissions.Permission
+		result2 error
+	}{result1, result2}
+}
+
 func (fake *FakeCredhubClient) Delete(arg1 string) error {
 	fake.deleteMutex.Lock()
 	ret, specificReturn := fake.deleteReturnsOnCall[len(fake.deleteArgsForCall)]
 	fake.deleteArgsForCall = append(fake.deleteArgsForCall, struct {
 		arg1 string
 	}{arg1})
+	stub := fake.DeleteStub
+	fakeReturns := fake.deleteReturns
 	fake.recordInvocation("Delete", []interface{}{arg1})
 	fake.deleteMutex.Unlock()
-	if fake.DeleteStub != nil {
-		return fake.DeleteStub(arg1)
+	if stub != nil {
+		return stub(arg1)
 	}
 	if specificReturn {
 		return ret.result1
 	}
-	fakeReturns := fake.deleteReturns
 	return fakeReturns.result1
 }
 
@@ -158,15 +302,16 @@ func (fake *FakeCredhubClient) FindByPath(arg1 string) (credentials.FindResults,
 	fake.findByPathArgsForCall = append(fake.findByPathArgsForCall, struct {
 		arg1 string
 	}{arg1})
+	stub := fake.FindByPathStub
+	fakeReturns := fake.findByPathReturns
 	fake.recordInvocation("FindByPath", []interface{}{arg1})
 	fake.findByPathMutex.Unlock()
-	if fake.FindByPathStub != nil {
-		return fake.FindByPathStub(arg1)
+	if stub != nil {
+		return stub(arg1)
 	}
 	if specificReturn {
 		return ret.result1, ret.result2
 	}
-	fakeReturns := fake.findByPathReturns
 	return fakeReturns.result1, fakeReturns.result2
 }
 
@@ -215,21 +360,150 @@ func (fake *FakeCredhubClient) FindByPathReturnsOnCall(i int, result1 credential
 	}{result1, result2}
 }
 
+func (fake *FakeCredhubClient) GetAllVersions(arg1 string) ([]credentials.Credential, error) {
+	fake.getAllVersionsMutex.Lock()
+	ret, specificReturn := fake.getAllVersionsReturnsOnCall[len(fake.getAllVersionsArgsForCall)]
+	fake.getAllVersionsArgsForCall = append(fake.getAllVersionsArgsForCall, struct {
+		arg1 string
+	}{arg1})
+	stub := fake.GetAllVersionsStub
+	fakeReturns := fake.getAllVersionsReturns
+	fake.recordInvocation("GetAllVersions", []interface{}{arg1})
+	fake.getAllVersionsMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeCredhubClient) GetAllVersionsCallCount() int {
+	fake.getAllVersionsMutex.RLock()
+	defer fake.getAllVersionsMutex.RUnlock()
+	return len(fake.getAllVersionsArgsForCall)
+}
+
+func (fake *FakeCredhubClient) GetAllVersionsCalls(stub func(string) ([]credentials.Credential, error)) {
+	fake.getAllVersionsMutex.Lock()
+	defer fake.getAllVersionsMutex.Unlock()
+	fake.GetAllVersionsStub = stub
+}
+
+func (fake *FakeCredhubClient) GetAllVersionsArgsForCall(i int) string {
+	fake.getAllVersionsMutex.RLock()
+	defer fake.getAllVersionsMutex.RUnlock()
+	argsForCall := fake.getAllVersionsArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeCredhubClient) GetAllVersionsReturns(result1 []credentials.Credential, result2 error) {
+	fake.getAllVersionsMutex.Lock()
+	defer fake.getAllVersionsMutex.Unlock()
+	fake.GetAllVersionsStub = nil
+	fake.getAllVersionsReturns = struct {
+		result1 []credentials.Credential
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeCredhubClient) GetAllVersionsReturnsOnCall(i int, result1 []credentials.Credential, result2 error) {
+	fake.getAllVersionsMutex.Lock()
+	defer fake.getAllVersionsMutex.Unlock()
+	fake.GetAllVersionsStub = nil
+	if fake.getAllVersionsReturnsOnCall == nil {
+		fake.getAllVersionsReturnsOnCall = make(map[int]struct {
+			result1 []credentials.Credential
+			result2 error
+		})
+	}
+	fake.getAllVersionsReturnsOnCall[i] = struct {
+		result1 []credentials.Credential
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeCredhubClient) GetById(arg1 string) (credentials.Credential, error) {
+	fake.getByIdMutex.Lock()
+	ret, specificReturn := fake.getByIdReturnsOnCall[len(fake.getByIdArgsForCall)]
+	fake.getByIdArgsForCall = append(fake.getByIdArgsForCall, struct {
+		arg1 string
+	}{arg1})
+	stub := fake.GetByIdStub
+	fakeReturns := fake.getByIdReturns
+	fake.recordInvocation("GetById", []interface{}{arg1})
+	fake.getByIdMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeCredhubClient) GetByIdCallCount() int {
+	fake.getByIdMutex.RLock()
+	defer fake.getByIdMutex.RUnlock()
+	return len(fake.getByIdArgsForCall)
+}
+
+func (fake *FakeCredhubClient) GetByIdCalls(stub func(string) (credentials.Credential, error)) {
+	fake.getByIdMutex.Lock()
+	defer fake.getByIdMutex.Unlock()
+	fake.GetByIdStub = stub
+}
+
+func (fake *FakeCredhubClient) GetByIdArgsForCall(i int) string {
+	fake.getByIdMutex.RLock()
+	defer fake.getByIdMutex.RUnlock()
+	argsForCall := fake.getByIdArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeCredhubClient) GetByIdReturns(result1 credentials.Credential, result2 error) {
+	fake.getByIdMutex.Lock()
+	defer fake.getByIdMutex.Unlock()
+	fake.GetByIdStub = nil
+	fake.getByIdReturns = struct {
+		result1 credentials.Credential
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeCredhubClient) GetByIdReturnsOnCall(i int, result1 credentials.Credential, result2 error) {
+	fake.getByIdMutex.Lock()
+	defer fake.getByIdMutex.Unlock()
+	fake.GetByIdStub = nil
+	if fake.getByIdReturnsOnCall == nil {
+		fake.getByIdReturnsOnCall = make(map[int]struct {
+			result1 credentials.Credential
+			result2 error
+		})
+	}
+	fake.getByIdReturnsOnCall[i] = struct {
+		result1 credentials.Credential
+		result2 error
+	}{result1, result2}
+}
+
 func (fake *FakeCredhubClient) GetLatestJSON(arg1 string) (credentials.JSON, error) {
 	fake.getLatestJSONMutex.Lock()
 	ret, specificReturn := fake.getLatestJSONReturnsOnCall[len(fake.getLatestJSONArgsForCall)]
 	fake.getLatestJSONArgsForCall = append(fake.getLatestJSONArgsForCall, struct {
 		arg1 string
 	}{arg1})
+	stub := fake.GetLatestJSONStub
+	fakeReturns := fake.getLatestJSONReturns
 	fake.recordInvocation("GetLatestJSON", []interface{}{arg1})
 	fake.getLatestJSONMutex.Unlock()
-	if fake.GetLatestJSONStub != nil {
-		return fake.GetLatestJSONStub(arg1)
+	if stub != nil {
+		return stub(arg1)
 	}
 	if specificReturn {
 		return ret.result1, ret.result2
 	}
-	fakeReturns := fake.getLatestJSONReturns
 	return fakeReturns.result1, fakeReturns.result2
 }
 
@@ -284,15 +558,16 @@ func (fake *FakeCredhubClient) GetLatestValue(arg1 string) (credentials.Value, e
 	fake.getLatestValueArgsForCall = append(fake.getLatestValueArgsForCall, struct {
 		arg1 string
 	}{arg1})
+	stub := fake.GetLatestValueStub
+	fakeReturns := fake.getLatestValueReturns
 	fake.recordInvocation("GetLatestValue", []interface{}{arg1})
 	fake.getLatestValueMutex.Unlock()
-	if fake.GetLatestValueStub != nil {
-		return fake.GetLatestValueStub(arg1)
+	if stub != nil {
+		return stub(arg1)
 	}
 	if specificReturn {
 		return ret.result1, ret.result2
 	}
-	fakeReturns := fake.getLatestValueReturns
 	return fakeReturns.result1, fakeReturns.result2
 }
 
@@ -341,6 +616,71 @@ func (fake *FakeCredhubClient) GetLatestValueReturnsOnCall(i int, result1 creden
 	}{result1, result2}
 }
 
+func (fake *FakeCredhubClient) GetPermissionByPathActor(arg1 string, arg2 string) (*permissions.Permission, error) {
+	fake.getPermissionByPathActorMutex.Lock()
+	ret, specificReturn := fake.getPermissionByPathActorReturnsOnCall[len(fake.getPermissionByPathActorArgsForCall)]
+	fake.getPermissionByPathActorArgsForCall = append(fake.getPermissionByPathActorArgsForCall, struct {
+		arg1 string
+		arg2 string
+	}{arg1, arg2})
+	stub := fake.GetPermissionByPathActorStub
+	fakeReturns := fake.getPermissionByPathActorReturns
+	fake.recordInvocation("GetPermissionByPathActor", []interface{}{arg1, arg2})
+	fake.getPermissionByPathActorMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeCredhubClient) GetPermissionByPathActorCallCount() int {
+	fake.getPermissionByPathActorMutex.RLock()
+	defer fake.getPermissionByPathActorMutex.RUnlock()
+	return len(fake.getPermissionByPathActorArgsForCall)
+}
+
+func (fake *FakeCredhubClient) GetPermissionByPathActorCalls(stub func(string, string) (*permissions.Permission, error)) {
+	fake.getPermissionByPathActorMutex.Lock()
+	defer fake.getPermissionByPathActorMutex.Unlock()
+	fake.GetPermissionByPathActorStub = stub
+}
+
+func (fake *FakeCredhubClient) GetPermissionByPathActorArgsForCall(i int) (string, string) {
+	fake.getPermissionByPathActorMutex.RLock()
+	defer fake.getPermissionByPathActorMutex.RUnlock()
+	argsForCall := fake.getPermissionByPathActorArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeCredhubClient) GetPermissionByPathActorReturns(result1 *permissions.Permission, result2 error) {
+	fake.getPermissionByPathActorMutex.Lock()
+	defer fake.getPermissionByPathActorMutex.Unlock()
+	fake.GetPermissionByPathActorStub = nil
+	fake.getPermissionByPathActorReturns = struct {
+		result1 *permissions.Permission
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeCredhubClient) GetPermissionByPathActorReturnsOnCall(i int, result1 *permissions.Permission, result2 error) {
+	fake.getPermissionByPathActorMutex.Lock()
+	defer fake.getPermissionByPathActorMutex.Unlock()
+	fake.GetPermissionByPathActorStub = nil
+	if fake.getPermissionByPathActorReturnsOnCall == nil {
+		fake.getPermissionByPathActorReturnsOnCall = make(map[int]struct {
+			result1 *permissions.Permission
+			result2 error
+		})
+	}
+	fake.getPermissionByPathActorReturnsOnCall[i] = struct {
+		result1 *permissions.Permission
+		result2 error
+	}{result1, result2}
+}
+
 func (fake *FakeCredhubClient) SetJSON(arg1 string, arg2 values.JSON) (credentials.JSON, error) {
 	fake.setJSONMutex.Lock()
 	ret, specificReturn := fake.setJSONReturnsOnCall[len(fake.setJSONArgsForCall)]
@@ -348,15 +688,16 @@ func (fake *FakeCredhubClient) SetJSON(arg1 string, arg2 values.JSON) (credentia
 		arg1 string
 		arg2 values.JSON
 	}{arg1, arg2})
+	stub := fake.SetJSONStub
+	fakeReturns := fake.setJSONReturns
 	fake.recordInvocation("SetJSON", []interface{}{arg1, arg2})
 	fake.setJSONMutex.Unlock()
-	if fake.SetJSONStub != nil {
-		return fake.SetJSONStub(arg1, arg2)
+	if stub != nil {
+		return stub(arg1, arg2)
 	}
 	if specificReturn {
 		return ret.result1, ret.result2
 	}
-	fakeReturns := fake.setJSONReturns
 	return fakeReturns.result1, fakeReturns.result2
 }
 
@@ -412,15 +753,16 @@ func (fake *FakeCredhubClient) SetValue(arg1 string, arg2 values.Value) (credent
 		arg1 string
 		arg2 values.Value
 	}{arg1, arg2})
+	stub := fake.SetValueStub
+	fakeReturns := fake.setValueReturns
 	fake.recordInvocation("SetValue", []interface{}{arg1, arg2})
 	fake.setValueMutex.Unlock()
-	if fake.SetValueStub != nil {
-		return fake.SetValueStub(arg1, arg2)
+	if stub != nil {
+		return stub(arg1, arg2)
 	}
 	if specificReturn {
 		return ret.result1, ret.result2
 	}
-	fakeReturns := fake.setValueReturns
 	return fakeReturns.result1, fakeReturns.result2
 }
 
@@ -469,21 +811,103 @@ func (fake *FakeCredhubClient) SetValueReturnsOnCall(i int, result1 credentials.
 	}{result1, result2}
 }
 
+func (fake *FakeCredhubClient) UpdatePermission(arg1 string, arg2 string, arg3 string, arg4 []string) (*permissions.Permission, error) {
+	var arg4Copy []string
+	if arg4 != nil {
+		arg4Copy = make([]string, len(arg4))
+		copy(arg4Copy, arg4)
+	}
+	fake.updatePermissionMutex.Lock()
+	ret, specificReturn := fake.updatePermissionReturnsOnCall[len(fake.updatePermissionArgsForCall)]
+	fake.updatePermissionArgsForCall = append(fake.updatePermissionArgsForCall, struct {
+		arg1 string
+		arg2 string
+		arg3 string
+		arg4 []string
+	}{arg1, arg2, arg3, arg4Copy})
+	stub := fake.UpdatePermissionStub
+	fakeReturns := fake.updatePermissionReturns
+	fake.recordInvocation("UpdatePermission", []interface{}{arg1, arg2, arg3, arg4Copy})
+	fake.updatePermissionMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2, arg3, arg4)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeCredhubClient) UpdatePermissionCallCount() int {
+	fake.updatePermissionMutex.RLock()
+	defer fake.updatePermissionMutex.RUnlock()
+	return len(fake.updatePermissionArgsForCall)
+}
+
+func (fake *FakeCredhubClient) UpdatePermissionCalls(stub func(string, string, string, []string) (*permissions.Permission, error)) {
+	fake.updatePermissionMutex.Lock()
+	defer fake.updatePermissionMutex.Unlock()
+	fake.UpdatePermissionStub = stub
+}
+
+func (fake *FakeCredhubClient) UpdatePermissionArgsForCall(i int) (string, string, string, []string) {
+	fake.updatePermissionMutex.RLock()
+	defer fake.updatePermissionMutex.RUnlock()
+	argsForCall := fake.updatePermissionArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3, argsForCall.arg4
+}
+
+func (fake *FakeCredhubClient) UpdatePermissionReturns(result1 *permissions.Permission, result2 error) {
+	fake.updatePermissionMutex.Lock()
+	defer fake.updatePermissionMutex.Unlock()
+	fake.UpdatePermissionStub = nil
+	fake.updatePermissionReturns = struct {
+		result1 *permissions.Permission
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeCredhubClient) UpdatePermissionReturnsOnCall(i int, result1 *permissions.Permission, result2 error) {
+	fake.updatePermissionMutex.Lock()
+	defer fake.updatePermissionMutex.Unlock()
+	fake.UpdatePermissionStub = nil
+	if fake.updatePermissionReturnsOnCall == nil {
+		fake.updatePermissionReturnsOnCall = make(map[int]struct {
+			result1 *permissions.Permission
+			result2 error
+		})
+	}
+	fake.updatePermissionReturnsOnCall[i] = struct {
+		result1 *permissions.Permission
+		result2 error
+	}{result1, result2}
+}
+
 func (fake *FakeCredhubClient) Invocations() map[string][][]interface{} {
 	fake.invocationsMutex.RLock()
 	defer fake.invocationsMutex.RUnlock()
+	fake.addPermissionMutex.RLock()
+	defer fake.addPermissionMutex.RUnlock()
 	fake.deleteMutex.RLock()
 	defer fake.deleteMutex.RUnlock()
 	fake.findByPathMutex.RLock()
 	defer fake.findByPathMutex.RUnlock()
+	fake.getAllVersionsMutex.RLock()
+	defer fake.getAllVersionsMutex.RUnlock()
+	fake.getByIdMutex.RLock()
+	defer fake.getByIdMutex.RUnlock()
 	fake.getLatestJSONMutex.RLock()
 	defer fake.getLatestJSONMutex.RUnlock()
 	fake.getLatestValueMutex.RLock()
 	defer fake.getLatestValueMutex.RUnlock()
+	fake.getPermissionByPathActorMutex.RLock()
+	defer fake.getPermissionByPathActorMutex.RUnlock()
 	fake.setJSONMutex.RLock()
 	defer fake.setJSONMutex.RUnlock()
 	fake.setValueMutex.RLock()
 	defer fake.setValueMutex.RUnlock()
+	fake.updatePermissionMutex.RLock()
+	defer fake.updatePermissionMutex.RUnlock()
 	copiedInvocations := map[string][][]interface{}{}
 	for key, value := range fake.invocations {
 		copiedInvocations[key] = value
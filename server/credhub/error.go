@@ -0,0 +1,99 @@
+package credhub
+
+import (
+	"code.cloudfoundry.org/credhub-cli/credhub/credentials"
+	"code.cloudfoundry.org/credhub-cli/credhub/credentials/values"
+	"code.cloudfoundry.org/credhub-cli/credhub/permissions"
+	"context"
+)
+
+// ErrorPrefix start message of errors given by credhub, storers only keep the message when wrapping errors
+// and this let tell credhub errors apart from others
+const ErrorPrefix = "credhub: "
+
+// Error is an error given by credhub or met when calling it
+type Error struct {
+	Err error
+}
+
+func (e Error) Error() string {
+	return ErrorPrefix + e.Err.Error()
+}
+
+func (e Error) Unwrap() error {
+	return e.Err
+}
+
+func wrapError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return Error{err}
+}
+
+// ErrorCredhubClient wrap errors given by credhub in an Error
+type ErrorCredhubClient struct {
+	next CredhubClient
+}
+
+func NewErrorCredhubClient(next CredhubClient) *ErrorCredhubClient {
+	return &ErrorCredhubClient{next}
+}
+
+func (c ErrorCredhubClient) WithContext(ctx context.Context) CredhubClient {
+	return NewErrorCredhubClient(WithContext(c.next, ctx))
+}
+
+func (c ErrorCredhubClient) GetLatestJSON(name string) (credentials.JSON, error) {
+	cred, err := c.next.GetLatestJSON(name)
+	return cred, wrapError(err)
+}
+
+func (c ErrorCredhubClient) Delete(name string) error {
+	return wrapError(c.next.Delete(name))
+}
+
+func (c ErrorCredhubClient) SetJSON(name string, value values.JSON) (credentials.JSON, error) {
+	cred, err := c.next.SetJSON(name, value)
+	return cred, wrapError(err)
+}
+
+func (c ErrorCredhubClient) FindByPath(path string) (credentials.FindResults, error) {
+	result, err := c.next.FindByPath(path)
+	return result, wrapError(err)
+}
+
+func (c ErrorCredhubClient) SetValue(name string, value values.Value) (credentials.Value, error) {
+	cred, err := c.next.SetValue(name, value)
+	return cred, wrapError(err)
+}
+
+func (c ErrorCredhubClient) GetLatestValue(name string) (credentials.Value, error) {
+	cred, err := c.next.GetLatestValue(name)
+	return cred, wrapError(err)
+}
+
+func (c ErrorCredhubClient) GetAllVersions(name string) ([]credentials.Credential, error) {
+	creds, err := c.next.GetAllVersions(name)
+	return creds, wrapError(err)
+}
+
+func (c ErrorCredhubClient) GetById(id string) (credentials.Credential, error) {
+	cred, err := c.next.GetById(id)
+	return cred, wrapError(err)
+}
+
+func (c ErrorCredhubClient) AddPermission(path string, actor string, ops []string) (*permissions.Permission, error) {
+	perm, err := c.next.AddPermission(path, actor, ops)
+	return perm, wrapError(err)
+}
+
+func (c ErrorCredhubClient) GetPermissionByPathActor(path string, actor string) (*permissions.Permission, error) {
+	perm, err := c.next.GetPermissionByPathActor(path, actor)
+	return perm, wrapError(err)
+}
+
+func (c ErrorCredhubClient) UpdatePermission(uuid string, path string, actor string, ops []string) (*permissions.Permission, error) {
+	perm, err := c.next.UpdatePermission(uuid, path, actor, ops)
+	return perm, wrapError(err)
+}
@@ -3,6 +3,7 @@ package credhub
 import (
 	"code.cloudfoundry.org/credhub-cli/credhub/credentials"
 	"code.cloudfoundry.org/credhub-cli/credhub/credentials/values"
+	"code.cloudfoundry.org/credhub-cli/credhub/permissions"
 	"github.com/sirupsen/logrus"
 )
 
@@ -13,6 +14,11 @@ type CredhubClient interface {
 	FindByPath(path string) (credentials.FindResults, error)
 	SetValue(name string, value values.Value) (credentials.Value, error)
 	GetLatestValue(name string) (credentials.Value, error)
+	GetAllVersions(name string) ([]credentials.Credential, error)
+	GetById(id string) (credentials.Credential, error)
+	AddPermission(path string, actor string, ops []string) (*permissions.Permission, error)
+	GetPermissionByPathActor(path string, actor string) (*permissions.Permission, error)
+	UpdatePermission(uuid string, path string, actor string, ops []string) (*permissions.Permission, error)
 }
 
 type NullCredhubClient struct {
@@ -43,3 +49,25 @@ func (NullCredhubClient) SetValue(name string, value values.Value) (credentials.
 func (NullCredhubClient) GetLatestValue(name string) (credentials.Value, error) {
 	return credentials.Value{}, nil
 }
+
+func (NullCredhubClient) GetAllVersions(name string) ([]credentials.Credential, error) {
+	return []credentials.Credential{}, nil
+}
+
+func (NullCredhubClient) GetById(id string) (credentials.Credential, error) {
+	return credentials.Credential{}, nil
+}
+
+func (NullCredhubClient) AddPermission(path string, actor string, ops []string) (*permissions.Permission, error) {
+	logrus.WithField("path", path).WithField("type", "add-permission").Infof("%s: %v", actor, ops)
+	return &permissions.Permission{Path: path, Actor: actor, Operations: ops}, nil
+}
+
+func (NullCredhubClient) GetPermissionByPathActor(path string, actor string) (*permissions.Permission, error) {
+	return &permissions.Permission{Path: path, Actor: actor}, nil
+}
+
+func (NullCredhubClient) UpdatePermission(uuid string, path string, actor string, ops []string) (*permissions.Permission, error) {
+	logrus.WithField("path", path).WithField("type", "update-permission").Infof("%s: %v", actor, ops)
+	return &permissions.Permission{Path: path, Actor: actor, Operations: ops, UUID: uuid}, nil
+}
@@ -0,0 +1,109 @@
+package credhub
+
+import (
+	"code.cloudfoundry.org/credhub-cli/credhub/credentials"
+	"code.cloudfoundry.org/credhub-cli/credhub/credentials/values"
+	"code.cloudfoundry.org/credhub-cli/credhub/permissions"
+	"context"
+	"github.com/orange-cloudfoundry/terraform-secure-backend/server/metrics"
+	"strings"
+	"time"
+)
+
+// MetricsCredhubClient record duration of each call made to credhub
+type MetricsCredhubClient struct {
+	next CredhubClient
+}
+
+func NewMetricsCredhubClient(next CredhubClient) *MetricsCredhubClient {
+	return &MetricsCredhubClient{next}
+}
+
+func (c MetricsCredhubClient) WithContext(ctx context.Context) CredhubClient {
+	return NewMetricsCredhubClient(WithContext(c.next, ctx))
+}
+
+func (c MetricsCredhubClient) observe(operation string, start time.Time, err error) {
+	result := metrics.Result(err)
+	if err != nil && strings.Contains(err.Error(), "does not exist") {
+		result = "not_found"
+	}
+	metrics.CredhubDuration.WithLabelValues(operation, result).Observe(metrics.Since(start))
+}
+
+func (c MetricsCredhubClient) GetLatestJSON(name string) (credentials.JSON, error) {
+	start := time.Now()
+	cred, err := c.next.GetLatestJSON(name)
+	c.observe("get-latest-json", start, err)
+	return cred, err
+}
+
+func (c MetricsCredhubClient) Delete(name string) error {
+	start := time.Now()
+	err := c.next.Delete(name)
+	c.observe("delete", start, err)
+	return err
+}
+
+func (c MetricsCredhubClient) SetJSON(name string, value values.JSON) (credentials.JSON, error) {
+	start := time.Now()
+	cred, err := c.next.SetJSON(name, value)
+	c.observe("set-json", start, err)
+	return cred, err
+}
+
+func (c MetricsCredhubClient) FindByPath(path string) (credentials.FindResults, error) {
+	start := time.Now()
+	result, err := c.next.FindByPath(path)
+	c.observe("find-by-path", start, err)
+	return result, err
+}
+
+func (c MetricsCredhubClient) SetValue(name string, value values.Value) (credentials.Value, error) {
+	start := time.Now()
+	cred, err := c.next.SetValue(name, value)
+	c.observe("set-value", start, err)
+	return cred, err
+}
+
+func (c MetricsCredhubClient) GetLatestValue(name string) (credentials.Value, error) {
+	start := time.Now()
+	cred, err := c.next.GetLatestValue(name)
+	c.observe("get-latest-value", start, err)
+	return cred, err
+}
+
+func (c MetricsCredhubClient) GetAllVersions(name string) ([]credentials.Credential, error) {
+	start := time.Now()
+	creds, err := c.next.GetAllVersions(name)
+	c.observe("get-all-versions", start, err)
+	return creds, err
+}
+
+func (c MetricsCredhubClient) GetById(id string) (credentials.Credential, error) {
+	start := time.Now()
+	cred, err := c.next.GetById(id)
+	c.observe("get-by-id", start, err)
+	return cred, err
+}
+
+func (c MetricsCredhubClient) AddPermission(path string, actor string, ops []string) (*permissions.Permission, error) {
+	start := time.Now()
+	perm, err := c.next.AddPermission(path, actor, ops)
+	c.observe("add-permission", start, err)
+	return perm, err
+}
+
+func (c MetricsCredhubClient) GetPermissionByPathActor(path string, actor string) (*permissions.Permission, error) {
+	start := time.Now()
+	perm, err := c.next.GetPermissionByPathActor(path, actor)
+	c.observe("get-permission", start, err)
+	return perm, err
+}
+
+func (c MetricsCredhubClient) UpdatePermission(uuid string, path string, actor string, ops []string) (*permissions.Permission, error) {
+	start := time.Now()
+	perm, err := c.next.UpdatePermission(uuid, path, actor, ops)
+	c.observe("update-permission", start, err)
+	return perm, err
+}
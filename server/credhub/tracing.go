@@ -0,0 +1,115 @@
+package credhub
+
+import (
+	"code.cloudfoundry.org/credhub-cli/credhub/credentials"
+	"code.cloudfoundry.org/credhub-cli/credhub/credentials/values"
+	"code.cloudfoundry.org/credhub-cli/credhub/permissions"
+	"context"
+	"github.com/orange-cloudfoundry/terraform-secure-backend/server/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracingCredhubClient create a span for each call made to credhub
+type TracingCredhubClient struct {
+	next CredhubClient
+	ctx  context.Context
+}
+
+func NewTracingCredhubClient(next CredhubClient) *TracingCredhubClient {
+	return &TracingCredhubClient{next: next, ctx: context.Background()}
+}
+
+func (c TracingCredhubClient) WithContext(ctx context.Context) CredhubClient {
+	return &TracingCredhubClient{next: c.next, ctx: ctx}
+}
+
+func (c TracingCredhubClient) start(operation, name string) trace.Span {
+	_, span := tracing.Start(c.ctx, "credhub."+operation,
+		attribute.String("credhub.operation", operation),
+		attribute.String("credhub.name", name),
+	)
+	return span
+}
+
+func (c TracingCredhubClient) GetLatestJSON(name string) (credentials.JSON, error) {
+	span := c.start("get-latest-json", name)
+	cred, err := c.next.GetLatestJSON(name)
+	tracing.End(span, err)
+	return cred, err
+}
+
+func (c TracingCredhubClient) Delete(name string) error {
+	span := c.start("delete", name)
+	err := c.next.Delete(name)
+	tracing.End(span, err)
+	return err
+}
+
+func (c TracingCredhubClient) SetJSON(name string, value values.JSON) (credentials.JSON, error) {
+	span := c.start("set-json", name)
+	cred, err := c.next.SetJSON(name, value)
+	tracing.End(span, err)
+	return cred, err
+}
+
+func (c TracingCredhubClient) FindByPath(path string) (credentials.FindResults, error) {
+	span := c.start("find-by-path", path)
+	result, err := c.next.FindByPath(path)
+	span.SetAttributes(attribute.Int("credhub.results", len(result.Credentials)))
+	tracing.End(span, err)
+	return result, err
+}
+
+func (c TracingCredhubClient) SetValue(name string, value values.Value) (credentials.Value, error) {
+	span := c.start("set-value", name)
+	cred, err := c.next.SetValue(name, value)
+	tracing.End(span, err)
+	return cred, err
+}
+
+func (c TracingCredhubClient) GetLatestValue(name string) (credentials.Value, error) {
+	span := c.start("get-latest-value", name)
+	cred, err := c.next.GetLatestValue(name)
+	tracing.End(span, err)
+	return cred, err
+}
+
+func (c TracingCredhubClient) GetAllVersions(name string) ([]credentials.Credential, error) {
+	span := c.start("get-all-versions", name)
+	creds, err := c.next.GetAllVersions(name)
+	span.SetAttributes(attribute.Int("credhub.results", len(creds)))
+	tracing.End(span, err)
+	return creds, err
+}
+
+func (c TracingCredhubClient) GetById(id string) (credentials.Credential, error) {
+	span := c.start("get-by-id", id)
+	cred, err := c.next.GetById(id)
+	tracing.End(span, err)
+	return cred, err
+}
+
+func (c TracingCredhubClient) AddPermission(path string, actor string, ops []string) (*permissions.Permission, error) {
+	span := c.start("add-permission", path)
+	span.SetAttributes(attribute.String("credhub.actor", actor))
+	perm, err := c.next.AddPermission(path, actor, ops)
+	tracing.End(span, err)
+	return perm, err
+}
+
+func (c TracingCredhubClient) GetPermissionByPathActor(path string, actor string) (*permissions.Permission, error) {
+	span := c.start("get-permission", path)
+	span.SetAttributes(attribute.String("credhub.actor", actor))
+	perm, err := c.next.GetPermissionByPathActor(path, actor)
+	tracing.End(span, err)
+	return perm, err
+}
+
+func (c TracingCredhubClient) UpdatePermission(uuid string, path string, actor string, ops []string) (*permissions.Permission, error) {
+	span := c.start("update-permission", path)
+	span.SetAttributes(attribute.String("credhub.actor", actor))
+	perm, err := c.next.UpdatePermission(uuid, path, actor, ops)
+	tracing.End(span, err)
+	return perm, err
+}
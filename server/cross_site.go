@@ -0,0 +1,40 @@
+package server
+
+import (
+	"net/http"
+	"net/url"
+)
+
+// CrossSiteMiddleware refuse requests changing something (every method but GET, HEAD and OPTIONS) sent by a browser from another site:
+// browsers send credentials cached for the dashboard with cross-site forms, this prevents cross-site request forgery.
+// Sec-Fetch-Site header is trusted when given, Origin header is compared to the requested host otherwise.
+// Requests without those headers don't come from a browser and are served.
+func CrossSiteMiddleware(problemWriter *ProblemWriter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			switch req.Method {
+			case "GET", "HEAD", "OPTIONS":
+				next.ServeHTTP(w, req)
+				return
+			}
+			if !crossSite(req) {
+				next.ServeHTTP(w, req)
+				return
+			}
+			RequestLogger(req).WithField("action", "cross-site").Warnf("Refusing cross-site %s from origin '%s'", req.Method, req.Header.Get("Origin"))
+			problemWriter.Write(w, req, NewProblem(http.StatusForbidden, "Cross-site requests are refused"))
+		})
+	}
+}
+
+func crossSite(req *http.Request) bool {
+	if site := req.Header.Get("Sec-Fetch-Site"); site != "" {
+		return site != "same-origin" && site != "none"
+	}
+	origin := req.Header.Get("Origin")
+	if origin == "" {
+		return false
+	}
+	u, err := url.Parse(origin)
+	return err != nil || u.Host != req.Host
+}
@@ -0,0 +1,42 @@
+package server_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/orange-cloudfoundry/terraform-secure-backend/server"
+	"net/http"
+	"net/http/httptest"
+)
+
+var _ = Describe("CrossSiteMiddleware", func() {
+	var handler http.Handler
+	serve := func(method string, headers map[string]string) int {
+		responseRecorder := httptest.NewRecorder()
+		req := httptest.NewRequest(method, "http://fakeurl.com/states/prod", nil)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		handler.ServeHTTP(responseRecorder, req)
+		return responseRecorder.Code
+	}
+	BeforeEach(func() {
+		handler = CrossSiteMiddleware(NewProblemWriter(false))(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	})
+	It("should serve requests not sent by a browser", func() {
+		Expect(serve("POST", nil)).Should(Equal(http.StatusOK))
+		Expect(serve("LOCK", nil)).Should(Equal(http.StatusOK))
+	})
+	It("should serve same origin requests", func() {
+		Expect(serve("POST", map[string]string{"Sec-Fetch-Site": "same-origin", "Origin": "http://fakeurl.com"})).Should(Equal(http.StatusOK))
+		Expect(serve("DELETE", map[string]string{"Origin": "http://fakeurl.com"})).Should(Equal(http.StatusOK))
+	})
+	It("should refuse cross-site requests changing something", func() {
+		Expect(serve("POST", map[string]string{"Sec-Fetch-Site": "cross-site", "Origin": "http://evil.com"})).Should(Equal(http.StatusForbidden))
+		Expect(serve("POST", map[string]string{"Sec-Fetch-Site": "same-site"})).Should(Equal(http.StatusForbidden))
+		Expect(serve("DELETE", map[string]string{"Origin": "http://evil.com"})).Should(Equal(http.StatusForbidden))
+		Expect(serve("POST", map[string]string{"Origin": "null"})).Should(Equal(http.StatusForbidden))
+	})
+	It("should serve cross-site reads", func() {
+		Expect(serve("GET", map[string]string{"Sec-Fetch-Site": "cross-site", "Origin": "http://evil.com"})).Should(Equal(http.StatusOK))
+	})
+})
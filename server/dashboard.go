@@ -0,0 +1,34 @@
+package server
+
+import (
+	_ "embed"
+	"github.com/orange-cloudfoundry/terraform-secure-backend/server/auth"
+	"html/template"
+	"net/http"
+)
+
+//go:embed dashboard.html
+var dashboardPage string
+
+var dashboardTemplate = template.Must(template.New("dashboard").Parse(dashboardPage))
+
+// Dashboard serve a web page listing states and locks, it only uses the api and has no external assets
+type Dashboard struct {
+	version   string
+	chunkSize int64
+}
+
+func NewDashboard(version string, chunkSize int64) *Dashboard {
+	return &Dashboard{version, chunkSize}
+}
+
+func (d Dashboard) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", "default-src 'self'; script-src 'unsafe-inline'; style-src 'unsafe-inline'")
+	w.Header().Set("X-Frame-Options", "DENY")
+	dashboardTemplate.Execute(w, struct {
+		Version   string
+		ChunkSize int64
+		Admin     bool
+	}{d.version, d.chunkSize, auth.FromContext(req.Context()).HasRight(auth.RightAdmin)})
+}
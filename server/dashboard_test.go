@@ -0,0 +1,29 @@
+package server_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/orange-cloudfoundry/terraform-secure-backend/server"
+	"net/http"
+	"net/http/httptest"
+)
+
+var _ = Describe("Dashboard", func() {
+	It("should serve a self contained html page", func() {
+		responseRecorder := httptest.NewRecorder()
+		NewDashboard("1.0.0", 60000).ServeHTTP(responseRecorder, httptest.NewRequest("GET", "http://fakeurl.com/dashboard", nil))
+
+		Expect(responseRecorder.Code).Should(Equal(http.StatusOK))
+		Expect(responseRecorder.Header().Get("Content-Type")).Should(HavePrefix("text/html"))
+		body := responseRecorder.Body.String()
+		Expect(body).Should(ContainSubstring("1.0.0"))
+		Expect(body).Should(MatchRegexp(`var chunkSize = \s*60000\s*;`))
+		Expect(body).ShouldNot(MatchRegexp(`(src|href)="https?:`))
+	})
+	It("should list states with their current lock to show lock holders", func() {
+		responseRecorder := httptest.NewRecorder()
+		NewDashboard("1.0.0", 60000).ServeHTTP(responseRecorder, httptest.NewRequest("GET", "http://fakeurl.com/dashboard", nil))
+
+		Expect(responseRecorder.Body.String()).Should(ContainSubstring(`params.set("with_lock_info", "true");`))
+	})
+})
@@ -0,0 +1,32 @@
+package server
+
+import (
+	"strings"
+)
+
+// ETag give a strong entity tag from a stored content hash
+func ETag(hash string) string {
+	return `"` + hash + `"`
+}
+
+// MatchETag tell if etag is in the list given by an If-Match or If-None-Match header value.
+// Weak comparison (as required by If-None-Match) ignore the weak indicator W/,
+// strong comparison (as required by If-Match) never match a weak tag.
+func MatchETag(header string, etag string, weak bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if strings.HasPrefix(candidate, "W/") {
+			if !weak {
+				continue
+			}
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
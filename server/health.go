@@ -0,0 +1,125 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/orange-cloudfoundry/terraform-secure-backend/server/credhub"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultReadyTimeout  = 2 * time.Second
+	DefaultReadyCacheTTL = 10 * time.Second
+)
+
+type HealthStatus struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	// Maintenance is set when maintenance mode is enabled
+	Maintenance *MaintenanceStatus `json:"maintenance,omitempty"`
+}
+
+// HealthController give health of the server for load balancers and probes, its endpoints are not authenticated
+type HealthController struct {
+	version       string
+	basePath      string
+	credhubClient credhub.CredhubClient
+	maintenance   *Maintenance
+	timeout       time.Duration
+	cacheTTL      time.Duration
+
+	mux       sync.Mutex
+	checkedAt time.Time
+	lastErr   error
+}
+
+func NewHealthController(version, basePath string, credhubClient credhub.CredhubClient) *HealthController {
+	return &HealthController{
+		version:       version,
+		basePath:      basePath,
+		credhubClient: credhubClient,
+		timeout:       DefaultReadyTimeout,
+		cacheTTL:      DefaultReadyCacheTTL,
+	}
+}
+
+// WithMaintenance make readyz tell when maintenance mode is enabled
+func (c *HealthController) WithMaintenance(maintenance *Maintenance) *HealthController {
+	c.maintenance = maintenance
+	return c
+}
+
+// Healthz only tell that process is alive
+func (c *HealthController) Healthz(w http.ResponseWriter, req *http.Request) {
+	c.writeStatus(w, http.StatusOK, HealthStatus{Status: "ok"})
+}
+
+// Readyz tell if credhub can be reached with a valid token, result is cached to not flood credhub with probes.
+// Server stays ready in maintenance mode as reads are still served.
+func (c *HealthController) Readyz(w http.ResponseWriter, req *http.Request) {
+	var maintenance *MaintenanceStatus
+	if c.maintenance != nil {
+		if status := c.maintenance.Status(); status.Enabled {
+			maintenance = &status
+		}
+	}
+	err := c.CheckCredhub()
+	if err != nil {
+		c.writeStatus(w, http.StatusServiceUnavailable, HealthStatus{Status: "unavailable", Error: err.Error(), Maintenance: maintenance})
+		return
+	}
+	if maintenance != nil {
+		c.writeStatus(w, http.StatusOK, HealthStatus{Status: "maintenance", Maintenance: maintenance})
+		return
+	}
+	c.writeStatus(w, http.StatusOK, HealthStatus{Status: "ok"})
+}
+
+func (c *HealthController) Version(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	b, _ := json.MarshalIndent(struct {
+		Version string `json:"version"`
+	}{c.version}, "", "\t")
+	w.Write(b)
+}
+
+// CheckCredhub find credentials on a path which never exists, this needs a valid token but gives nothing.
+// A credhub not responding before timeout is considered as unavailable.
+func (c *HealthController) CheckCredhub() error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if !c.checkedAt.IsZero() && time.Since(c.checkedAt) < c.cacheTTL {
+		return c.lastErr
+	}
+	errChan := make(chan error, 1)
+	go func() {
+		_, err := c.credhubClient.FindByPath(c.basePath + "/.readyz")
+		if err != nil && strings.Contains(err.Error(), "does not exist") {
+			err = nil
+		}
+		errChan <- err
+	}()
+	select {
+	case err := <-errChan:
+		c.lastErr = err
+	case <-time.After(c.timeout):
+		c.lastErr = fmt.Errorf("credhub did not respond after %s", c.timeout)
+	}
+	c.checkedAt = time.Now()
+	if c.lastErr != nil {
+		log.WithField("action", "readyz").Warnf("Credhub is not ready: %s", c.lastErr.Error())
+	}
+	return c.lastErr
+}
+
+func (c *HealthController) writeStatus(w http.ResponseWriter, code int, status HealthStatus) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	b, _ := json.MarshalIndent(status, "", "\t")
+	w.Write(b)
+}
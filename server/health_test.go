@@ -0,0 +1,71 @@
+package server_test
+
+import (
+	"code.cloudfoundry.org/credhub-cli/credhub/credentials"
+	"encoding/json"
+	"errors"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/orange-cloudfoundry/terraform-secure-backend/server"
+	"github.com/orange-cloudfoundry/terraform-secure-backend/server/credhub/credhubfakes"
+	"net/http"
+	"net/http/httptest"
+	"time"
+)
+
+var _ = Describe("Health", func() {
+	var fakeClient *credhubfakes.FakeCredhubClient
+	var healthController *HealthController
+	var responseRecorder *httptest.ResponseRecorder
+	BeforeEach(func() {
+		responseRecorder = httptest.NewRecorder()
+		fakeClient = new(credhubfakes.FakeCredhubClient)
+		healthController = NewHealthController("1.0.0", "test", fakeClient)
+	})
+	Context("Healthz", func() {
+		It("should answer ok without calling credhub", func() {
+			healthController.Healthz(responseRecorder, httptest.NewRequest("GET", "http://fakeurl.com/healthz", nil))
+			Expect(responseRecorder.Code).Should(Equal(http.StatusOK))
+			Expect(fakeClient.Invocations()).Should(BeEmpty())
+		})
+	})
+	Context("Readyz", func() {
+		It("should answer ok when credhub answers", func() {
+			fakeClient.FindByPathReturns(credentials.FindResults{}, nil)
+			healthController.Readyz(responseRecorder, httptest.NewRequest("GET", "http://fakeurl.com/readyz", nil))
+			Expect(responseRecorder.Code).Should(Equal(http.StatusOK))
+			Expect(fakeClient.FindByPathArgsForCall(0)).Should(Equal("test/.readyz"))
+		})
+		It("should answer service unavailable when credhub gives an error", func() {
+			fakeClient.FindByPathReturns(credentials.FindResults{}, errors.New("invalid_token"))
+			healthController.Readyz(responseRecorder, httptest.NewRequest("GET", "http://fakeurl.com/readyz", nil))
+			Expect(responseRecorder.Code).Should(Equal(http.StatusServiceUnavailable))
+			var status HealthStatus
+			err := json.Unmarshal(responseRecorder.Body.Bytes(), &status)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(status.Error).Should(Equal("invalid_token"))
+		})
+		It("should tell when maintenance mode is enabled", func() {
+			maintenance := NewMaintenance("credhub upgrade", time.Minute)
+			maintenance.Enable("", 0)
+			healthController.WithMaintenance(maintenance).Readyz(responseRecorder, httptest.NewRequest("GET", "http://fakeurl.com/readyz", nil))
+			Expect(responseRecorder.Code).Should(Equal(http.StatusOK))
+			var status HealthStatus
+			err := json.Unmarshal(responseRecorder.Body.Bytes(), &status)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(status.Status).Should(Equal("maintenance"))
+			Expect(status.Maintenance.Message).Should(Equal("credhub upgrade"))
+		})
+		It("should cache result of credhub check", func() {
+			healthController.Readyz(responseRecorder, httptest.NewRequest("GET", "http://fakeurl.com/readyz", nil))
+			healthController.Readyz(httptest.NewRecorder(), httptest.NewRequest("GET", "http://fakeurl.com/readyz", nil))
+			Expect(fakeClient.FindByPathCallCount()).Should(Equal(1))
+		})
+	})
+	Context("Version", func() {
+		It("should give version of the server", func() {
+			healthController.Version(responseRecorder, httptest.NewRequest("GET", "http://fakeurl.com/version", nil))
+			Expect(responseRecorder.Body.String()).Should(MatchJSON(`{"version": "1.0.0"}`))
+		})
+	})
+})
@@ -0,0 +1,162 @@
+package server
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultAuthMaxFailures = 5
+	DefaultAuthLockout     = 15 * time.Minute
+)
+
+// FailureTracker count failed authentications by key (an ip or a username),
+// a key reaching max failures inside lockout duration is locked for this same duration
+type FailureTracker struct {
+	maxFailures int
+	lockout     time.Duration
+	mu          sync.Mutex
+	entries     map[string]*failureEntry
+	lastPrune   time.Time
+}
+
+type failureEntry struct {
+	count       int
+	first       time.Time
+	lockedUntil time.Time
+}
+
+func NewFailureTracker(maxFailures int, lockout time.Duration) *FailureTracker {
+	return &FailureTracker{
+		maxFailures: maxFailures,
+		lockout:     lockout,
+		entries:     make(map[string]*failureEntry),
+		lastPrune:   time.Now(),
+	}
+}
+
+// Locked tell if key is locked and for how long
+func (t *FailureTracker) Locked(key string) (time.Duration, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	entry, ok := t.entries[key]
+	if !ok {
+		return 0, false
+	}
+	left := time.Until(entry.lockedUntil)
+	if left <= 0 {
+		return 0, false
+	}
+	return left, true
+}
+
+// Fail record a failed authentication for key, it returns true when key has just been locked
+func (t *FailureTracker) Fail(key string) (time.Duration, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	t.prune(now)
+	entry, ok := t.entries[key]
+	if !ok || now.Sub(entry.first) > t.lockout {
+		entry = &failureEntry{first: now}
+		t.entries[key] = entry
+	}
+	entry.count++
+	if entry.count < t.maxFailures {
+		return 0, false
+	}
+	entry.lockedUntil = now.Add(t.lockout)
+	entry.count = 0
+	entry.first = now
+	return t.lockout, true
+}
+
+// Reset forget failures of key
+func (t *FailureTracker) Reset(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.entries, key)
+}
+
+// prune remove entries which can't lead to a lockout anymore, it is done at most once per lockout duration
+func (t *FailureTracker) prune(now time.Time) {
+	if now.Sub(t.lastPrune) < t.lockout {
+		return
+	}
+	t.lastPrune = now
+	for key, entry := range t.entries {
+		if now.After(entry.lockedUntil) && now.Sub(entry.first) > t.lockout {
+			delete(t.entries, key)
+		}
+	}
+}
+
+// RateLimiter is a token bucket by key (an identity or an ip),
+// buckets are refilled at rate tokens per second up to burst tokens
+type RateLimiter struct {
+	rate      float64
+	burst     float64
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastPrune time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter create a rate limiter, burst defaults to twice the rate when zero
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	if burst <= 0 {
+		burst = int(math.Max(1, math.Ceil(rate*2)))
+	}
+	return &RateLimiter{
+		rate:      rate,
+		burst:     float64(burst),
+		buckets:   make(map[string]*bucket),
+		lastPrune: time.Now(),
+	}
+}
+
+// Allow take a token for key, when there is none it gives the time to wait before one is available
+func (l *RateLimiter) Allow(key string) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	l.prune(now)
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0, true
+	}
+	return time.Duration((1 - b.tokens) / l.rate * float64(time.Second)), false
+}
+
+// prune remove buckets which are full again, it is done at most once per refill duration
+func (l *RateLimiter) prune(now time.Time) {
+	fill := time.Duration(l.burst / l.rate * float64(time.Second))
+	if now.Sub(l.lastPrune) < fill {
+		return
+	}
+	l.lastPrune = now
+	for key, b := range l.buckets {
+		if now.Sub(b.last) >= fill {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// setRetryAfter set Retry-After header in seconds rounded up
+func setRetryAfter(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+}
@@ -0,0 +1,77 @@
+package server_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/orange-cloudfoundry/terraform-secure-backend/server"
+	"time"
+)
+
+var _ = Describe("Limiter", func() {
+	Context("FailureTracker", func() {
+		It("should lock key when max failures is reached", func() {
+			tracker := NewFailureTracker(3, time.Minute)
+			for i := 0; i < 2; i++ {
+				_, locked := tracker.Fail("ip:10.0.0.1")
+				Expect(locked).Should(BeFalse())
+			}
+			_, locked := tracker.Locked("ip:10.0.0.1")
+			Expect(locked).Should(BeFalse())
+
+			duration, locked := tracker.Fail("ip:10.0.0.1")
+			Expect(locked).Should(BeTrue())
+			Expect(duration).Should(Equal(time.Minute))
+
+			wait, locked := tracker.Locked("ip:10.0.0.1")
+			Expect(locked).Should(BeTrue())
+			Expect(wait).Should(BeNumerically(">", 50*time.Second))
+
+			_, locked = tracker.Locked("ip:10.0.0.2")
+			Expect(locked).Should(BeFalse())
+		})
+		It("should unlock key after lockout duration", func() {
+			tracker := NewFailureTracker(1, 20*time.Millisecond)
+			_, locked := tracker.Fail("user:alice")
+			Expect(locked).Should(BeTrue())
+
+			time.Sleep(30 * time.Millisecond)
+			_, locked = tracker.Locked("user:alice")
+			Expect(locked).Should(BeFalse())
+		})
+		It("should forget failures on reset", func() {
+			tracker := NewFailureTracker(2, time.Minute)
+			tracker.Fail("user:alice")
+			tracker.Reset("user:alice")
+			_, locked := tracker.Fail("user:alice")
+			Expect(locked).Should(BeFalse())
+		})
+	})
+	Context("RateLimiter", func() {
+		It("should allow burst then refuse with time to wait", func() {
+			limiter := NewRateLimiter(1, 2)
+			_, ok := limiter.Allow("user:alice")
+			Expect(ok).Should(BeTrue())
+			_, ok = limiter.Allow("user:alice")
+			Expect(ok).Should(BeTrue())
+
+			wait, ok := limiter.Allow("user:alice")
+			Expect(ok).Should(BeFalse())
+			Expect(wait).Should(BeNumerically(">", 0))
+			Expect(wait).Should(BeNumerically("<=", time.Second))
+
+			_, ok = limiter.Allow("user:bob")
+			Expect(ok).Should(BeTrue())
+		})
+		It("should refill tokens over time", func() {
+			limiter := NewRateLimiter(50, 1)
+			_, ok := limiter.Allow("user:alice")
+			Expect(ok).Should(BeTrue())
+			_, ok = limiter.Allow("user:alice")
+			Expect(ok).Should(BeFalse())
+
+			time.Sleep(30 * time.Millisecond)
+			_, ok = limiter.Allow("user:alice")
+			Expect(ok).Should(BeTrue())
+		})
+	})
+})
@@ -0,0 +1,181 @@
+package server
+
+import (
+	"code.cloudfoundry.org/credhub-cli/credhub/credentials"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ListQuery is what can be asked when listing tfstates
+type ListQuery struct {
+	Prefix        string
+	Locked        *bool
+	UpdatedBefore time.Time
+	// WithLockInfo ask for info of current lock of locked tfstates, it costs a call to credhub per locked tfstate
+	WithLockInfo bool
+	// Sort is the field to sort on, `name` or `updated_at`, prefixed by `-` for descending order
+	Sort   string
+	Limit  int
+	Cursor *listCursor
+}
+
+type listCursor struct {
+	Name      string `json:"n"`
+	UpdatedAt string `json:"u"`
+}
+
+func (c listCursor) String() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// ParseListQuery give a list query from request parameters
+func ParseListQuery(params url.Values) (ListQuery, error) {
+	query := ListQuery{
+		Prefix: params.Get("prefix"),
+		Sort:   params.Get("sort"),
+	}
+	if query.Sort == "" {
+		query.Sort = "name"
+	}
+	switch strings.TrimPrefix(query.Sort, "-") {
+	case "name", "updated_at":
+	default:
+		return query, fmt.Errorf("Invalid sort parameter '%s', only 'name' and 'updated_at' are available", query.Sort)
+	}
+	if locked := params.Get("locked"); locked != "" {
+		b, err := strconv.ParseBool(locked)
+		if err != nil {
+			return query, fmt.Errorf("Invalid locked parameter: %s", err.Error())
+		}
+		query.Locked = &b
+	}
+	if withLockInfo := params.Get("with_lock_info"); withLockInfo != "" {
+		b, err := strconv.ParseBool(withLockInfo)
+		if err != nil {
+			return query, fmt.Errorf("Invalid with_lock_info parameter: %s", err.Error())
+		}
+		query.WithLockInfo = b
+	}
+	if updatedBefore := params.Get("updated_before"); updatedBefore != "" {
+		t, err := time.Parse(time.RFC3339, updatedBefore)
+		if err != nil {
+			return query, fmt.Errorf("Invalid updated_before parameter: %s", err.Error())
+		}
+		query.UpdatedBefore = t
+	}
+	if limit := params.Get("limit"); limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil || l < 0 {
+			return query, fmt.Errorf("Invalid limit parameter '%s'", limit)
+		}
+		query.Limit = l
+	}
+	if cursor := params.Get("cursor"); cursor != "" {
+		b, err := base64.RawURLEncoding.DecodeString(cursor)
+		if err == nil {
+			query.Cursor = &listCursor{}
+			err = json.Unmarshal(b, query.Cursor)
+		}
+		if err != nil {
+			return query, fmt.Errorf("Invalid cursor parameter")
+		}
+	}
+	return query, nil
+}
+
+// groupStates give one entry per logical tfstate found in credentials under basePath,
+// parts, index and lock credentials of a tfstate are all stored under <basePath>/<name>/
+// which let lock status be known without asking credhub for each tfstate.
+func groupStates(basePath string, creds []credentials.Base) []CredModel {
+	prefix := strings.Trim(basePath, "/") + "/"
+	byName := make(map[string]*CredModel)
+	names := make([]string, 0)
+	for _, cred := range creds {
+		relName := strings.TrimPrefix(strings.TrimPrefix(cred.Name, "/"), prefix)
+		// trash, tokens and approvals are stored under reserved names starting with a dot
+		if strings.HasPrefix(relName, ".") {
+			continue
+		}
+		name := strings.Split(relName, "/")[0]
+		model, ok := byName[name]
+		if !ok {
+			model = &CredModel{
+				Name:        name,
+				CredhubName: fmt.Sprintf("%s/%s", basePath, name),
+			}
+			byName[name] = model
+			names = append(names, name)
+		}
+		if relName == name+LOCK_SUFFIX {
+			model.IsLocked = true
+			continue
+		}
+		if _, err := strconv.Atoi(strings.TrimPrefix(relName, name+"/")); err == nil {
+			model.Parts++
+		}
+		if cred.VersionCreatedAt > model.VersionCreatedAt {
+			model.VersionCreatedAt = cred.VersionCreatedAt
+		}
+	}
+	models := make([]CredModel, 0)
+	for _, name := range names {
+		// a lock without state
+		if byName[name].VersionCreatedAt == "" {
+			continue
+		}
+		models = append(models, *byName[name])
+	}
+	return models
+}
+
+// Apply filter, sort and paginate models, it gives the cursor to the next page or an empty string on last page
+func (q ListQuery) Apply(models []CredModel) ([]CredModel, string) {
+	filtered := make([]CredModel, 0)
+	for _, model := range models {
+		if !strings.HasPrefix(model.Name, q.Prefix) {
+			continue
+		}
+		if q.Locked != nil && model.IsLocked != *q.Locked {
+			continue
+		}
+		if !q.UpdatedBefore.IsZero() {
+			updatedAt, err := time.Parse(time.RFC3339, model.VersionCreatedAt)
+			if err != nil || !updatedAt.Before(q.UpdatedBefore) {
+				continue
+			}
+		}
+		filtered = append(filtered, model)
+	}
+	sort.Slice(filtered, func(i, j int) bool {
+		return q.less(listCursor{filtered[i].Name, filtered[i].VersionCreatedAt}, listCursor{filtered[j].Name, filtered[j].VersionCreatedAt})
+	})
+	if q.Cursor != nil {
+		start := sort.Search(len(filtered), func(i int) bool {
+			return q.less(*q.Cursor, listCursor{filtered[i].Name, filtered[i].VersionCreatedAt})
+		})
+		filtered = filtered[start:]
+	}
+	if q.Limit == 0 || len(filtered) <= q.Limit {
+		return filtered, ""
+	}
+	last := filtered[q.Limit-1]
+	return filtered[:q.Limit], listCursor{last.Name, last.VersionCreatedAt}.String()
+}
+
+func (q ListQuery) less(a, b listCursor) bool {
+	desc := strings.HasPrefix(q.Sort, "-")
+	if desc {
+		a, b = b, a
+	}
+	if strings.TrimPrefix(q.Sort, "-") == "updated_at" && a.UpdatedAt != b.UpdatedAt {
+		return a.UpdatedAt < b.UpdatedAt
+	}
+	return a.Name < b.Name
+}
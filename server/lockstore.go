@@ -2,9 +2,15 @@ package server
 
 import (
 	"code.cloudfoundry.org/credhub-cli/credhub/credentials/values"
+	"context"
+	"encoding/json"
 	"github.com/hashicorp/terraform/state"
 	"github.com/orange-cloudfoundry/terraform-secure-backend/server/credhub"
+	"github.com/orange-cloudfoundry/terraform-secure-backend/server/metrics"
+	"github.com/orange-cloudfoundry/terraform-secure-backend/server/webhook"
+	log "github.com/sirupsen/logrus"
 	"strings"
+	"time"
 )
 
 type LockStore struct {
@@ -15,6 +21,10 @@ func NewLockStore(credhubClient credhub.CredhubClient) *LockStore {
 	return &LockStore{credhubClient}
 }
 
+func (s LockStore) WithContext(ctx context.Context) *LockStore {
+	return NewLockStore(credhub.WithContext(s.credhubClient, ctx))
+}
+
 func (s LockStore) Lock(path string, info *state.LockInfo) error {
 	return s.toggleLock(path, info, true)
 }
@@ -23,7 +33,10 @@ func (s LockStore) toggleLock(path string, info *state.LockInfo, lockState bool)
 	if !lockState {
 		return s.DeleteLock(path)
 	}
-	_, err := s.credhubClient.SetValue(path+LOCK_SUFFIX, values.Value(info.ID))
+	_, err := s.credhubClient.SetValue(path+LOCK_SUFFIX, values.Value(info.Marshal()))
+	if err == nil {
+		metrics.LocksHeld.Inc()
+	}
 	return err
 }
 
@@ -36,9 +49,15 @@ func (s LockStore) IsLocked(path string) (*state.LockInfo, bool) {
 	if err != nil {
 		return nil, false
 	}
-	return &state.LockInfo{
-		ID: string(cred.Value),
-	}, true
+	info := &state.LockInfo{}
+	err = json.Unmarshal([]byte(cred.Value), info)
+	if err != nil || info.ID == "" {
+		// lock written by an older backend which only kept the lock id
+		return &state.LockInfo{
+			ID: string(cred.Value),
+		}, true
+	}
+	return info, true
 }
 
 func (s LockStore) DeleteLock(path string) error {
@@ -46,5 +65,70 @@ func (s LockStore) DeleteLock(path string) error {
 	if err != nil && strings.Contains(err.Error(), "does not exist") {
 		return nil
 	}
+	if err == nil {
+		metrics.LocksHeld.Dec()
+	}
 	return err
 }
+
+// CountLocksHeld give the number of locks found under basePath
+func (s LockStore) CountLocksHeld(basePath string) (int, error) {
+	result, err := s.credhubClient.FindByPath(basePath)
+	if err != nil {
+		return 0, err
+	}
+	nb := 0
+	for _, cred := range result.Credentials {
+		if strings.HasSuffix(cred.Name, LOCK_SUFFIX) && !strings.Contains(cred.Name, TRASH_PREFIX+"/") {
+			nb++
+		}
+	}
+	return nb, nil
+}
+
+// NotifyLocksHeld send a lock-held event for each lock under basePath of tenant held for longer than heldFor,
+// locks already in notified are skipped and notified is updated with locks which are still held
+func (s LockStore) NotifyLocksHeld(tenant, basePath string, heldFor time.Duration, notifier *webhook.Notifier, notified map[string]bool) error {
+	result, err := s.credhubClient.FindByPath(basePath)
+	if err != nil {
+		return err
+	}
+	stillHeld := make(map[string]bool)
+	for _, model := range groupStates(basePath, result.Credentials) {
+		if !model.IsLocked {
+			continue
+		}
+		info, locked := s.IsLocked(model.CredhubName)
+		if !locked || info.Created.IsZero() || time.Since(info.Created) < heldFor {
+			continue
+		}
+		stillHeld[info.ID] = true
+		if notified[info.ID] {
+			continue
+		}
+		notifier.Notify(webhook.Event{
+			Event:  webhook.EventLockHeld,
+			State:  model.Name,
+			Tenant: tenant,
+			Lock:   info,
+		})
+	}
+	for id := range notified {
+		delete(notified, id)
+	}
+	for id := range stillHeld {
+		notified[id] = true
+	}
+	return nil
+}
+
+// WatchLocksHeld run NotifyLocksHeld at each interval, this never returns
+func (s LockStore) WatchLocksHeld(tenant, basePath string, heldFor, interval time.Duration, notifier *webhook.Notifier) {
+	notified := make(map[string]bool)
+	for range time.Tick(interval) {
+		err := s.NotifyLocksHeld(tenant, basePath, heldFor, notifier, notified)
+		if err != nil {
+			log.WithField("action", "watch-locks").Errorf("Error when looking for locks held too long: %s", err.Error())
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/orange-cloudfoundry/terraform-secure-backend/server/auth"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultMaintenanceMessage    = "Backend is in maintenance, tfstates can only be read"
+	DefaultMaintenanceRetryAfter = 5 * time.Minute
+)
+
+type MaintenanceStatus struct {
+	Enabled    bool       `json:"enabled"`
+	Message    string     `json:"message,omitempty"`
+	RetryAfter string     `json:"retry_after,omitempty"`
+	Since      *time.Time `json:"since,omitempty"`
+}
+
+// Maintenance is a read-only mode, when enabled writes and locks are refused while reads are still served
+type Maintenance struct {
+	defaultMessage    string
+	defaultRetryAfter time.Duration
+
+	mu         sync.RWMutex
+	enabled    bool
+	message    string
+	retryAfter time.Duration
+	since      time.Time
+}
+
+// NewMaintenance create a disabled maintenance mode, message and retryAfter are defaults given when enabling it
+func NewMaintenance(message string, retryAfter time.Duration) *Maintenance {
+	if message == "" {
+		message = DefaultMaintenanceMessage
+	}
+	if retryAfter <= 0 {
+		retryAfter = DefaultMaintenanceRetryAfter
+	}
+	return &Maintenance{defaultMessage: message, defaultRetryAfter: retryAfter}
+}
+
+// Enable switch on maintenance mode, defaults are used for empty message or zero retryAfter
+func (m *Maintenance) Enable(message string, retryAfter time.Duration) {
+	if message == "" {
+		message = m.defaultMessage
+	}
+	if retryAfter <= 0 {
+		retryAfter = m.defaultRetryAfter
+	}
+	m.mu.Lock()
+	if !m.enabled {
+		m.since = time.Now()
+	}
+	m.enabled = true
+	m.message = message
+	m.retryAfter = retryAfter
+	m.mu.Unlock()
+	log.WithField("action", "maintenance").Warnf("Maintenance mode enabled: %s", message)
+}
+
+// Disable switch off maintenance mode
+func (m *Maintenance) Disable() {
+	m.mu.Lock()
+	wasEnabled := m.enabled
+	m.enabled = false
+	m.mu.Unlock()
+	if wasEnabled {
+		log.WithField("action", "maintenance").Warn("Maintenance mode disabled")
+	}
+}
+
+// Toggle switch maintenance mode on with defaults or off
+func (m *Maintenance) Toggle() {
+	if m.Status().Enabled {
+		m.Disable()
+		return
+	}
+	m.Enable("", 0)
+}
+
+func (m *Maintenance) Status() MaintenanceStatus {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if !m.enabled {
+		return MaintenanceStatus{}
+	}
+	since := m.since
+	return MaintenanceStatus{
+		Enabled:    true,
+		Message:    m.message,
+		RetryAfter: m.retryAfter.String(),
+		Since:      &since,
+	}
+}
+
+// WatchSignal toggle maintenance mode each time process receives maintenance signal (SIGUSR1),
+// there is no such signal on windows
+func (m *Maintenance) WatchSignal() {
+	if len(maintenanceSignals) == 0 {
+		return
+	}
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, maintenanceSignals...)
+	for range sigs {
+		m.Toggle()
+	}
+}
+
+// Middleware answer service unavailable to writes (POST, PUT, PATCH and DELETE) and LOCK requests when maintenance mode is enabled
+func (m *Maintenance) Middleware(problemWriter *ProblemWriter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			switch req.Method {
+			case "POST", "PUT", "PATCH", "DELETE", "LOCK":
+			default:
+				next.ServeHTTP(w, req)
+				return
+			}
+			m.mu.RLock()
+			enabled, message, retryAfter := m.enabled, m.message, m.retryAfter
+			m.mu.RUnlock()
+			if !enabled {
+				next.ServeHTTP(w, req)
+				return
+			}
+			RequestLogger(req).WithField("action", "maintenance").Infof("Refusing %s during maintenance", req.Method)
+			setRetryAfter(w, retryAfter)
+			problemWriter.Write(w, req, NewProblem(http.StatusServiceUnavailable, message))
+		})
+	}
+}
+
+// MaintenanceController let admins of main tenant see and switch maintenance mode
+type MaintenanceController struct {
+	maintenance *Maintenance
+}
+
+func NewMaintenanceController(maintenance *Maintenance) *MaintenanceController {
+	return &MaintenanceController{maintenance}
+}
+
+type MaintenanceRequest struct {
+	Message    string `json:"message"`
+	RetryAfter string `json:"retry_after"`
+}
+
+func (c MaintenanceController) authorize(req *http.Request) error {
+	tenant := tenantFromContext(req.Context())
+	if auth.FromContext(req.Context()).IsAdmin() && (tenant == nil || tenant.Name == "") {
+		return nil
+	}
+	return NewProblem(http.StatusForbidden, "Only admins can manage maintenance mode")
+}
+
+func (c MaintenanceController) Get(w http.ResponseWriter, req *http.Request) error {
+	err := c.authorize(req)
+	if err != nil {
+		return err
+	}
+	c.writeStatus(w)
+	return nil
+}
+
+func (c MaintenanceController) Enable(w http.ResponseWriter, req *http.Request) error {
+	err := c.authorize(req)
+	if err != nil {
+		return err
+	}
+	var maintenanceReq MaintenanceRequest
+	if req.ContentLength != 0 {
+		err = json.NewDecoder(req.Body).Decode(&maintenanceReq)
+		if err != nil {
+			return err
+		}
+	}
+	var retryAfter time.Duration
+	if maintenanceReq.RetryAfter != "" {
+		retryAfter, err = time.ParseDuration(maintenanceReq.RetryAfter)
+		if err != nil || retryAfter < 0 {
+			return NewProblem(http.StatusBadRequest, fmt.Sprintf("Invalid retry_after '%s'", maintenanceReq.RetryAfter))
+		}
+	}
+	RequestLogger(req).WithField("action", "maintenance").Infof("'%s' enables maintenance mode", identityName(req))
+	c.maintenance.Enable(maintenanceReq.Message, retryAfter)
+	c.writeStatus(w)
+	return nil
+}
+
+func (c MaintenanceController) Disable(w http.ResponseWriter, req *http.Request) error {
+	err := c.authorize(req)
+	if err != nil {
+		return err
+	}
+	RequestLogger(req).WithField("action", "maintenance").Infof("'%s' disables maintenance mode", identityName(req))
+	c.maintenance.Disable()
+	c.writeStatus(w)
+	return nil
+}
+
+func (c MaintenanceController) writeStatus(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	b, _ := json.MarshalIndent(c.maintenance.Status(), "", "\t")
+	w.Write(b)
+}
@@ -0,0 +1,10 @@
+//go:build !windows
+
+package server
+
+import (
+	"os"
+	"syscall"
+)
+
+var maintenanceSignals = []os.Signal{syscall.SIGUSR1}
@@ -0,0 +1,5 @@
+package server
+
+import "os"
+
+var maintenanceSignals = []os.Signal{}
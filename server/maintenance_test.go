@@ -0,0 +1,100 @@
+package server_test
+
+import (
+	"bytes"
+	"encoding/json"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/orange-cloudfoundry/terraform-secure-backend/server"
+	"github.com/orange-cloudfoundry/terraform-secure-backend/server/auth"
+	"net/http"
+	"net/http/httptest"
+	"time"
+)
+
+var _ = Describe("Maintenance", func() {
+	var maintenance *Maintenance
+	BeforeEach(func() {
+		maintenance = NewMaintenance("", 0)
+	})
+	Context("Middleware", func() {
+		var handler http.Handler
+		serve := func(method string) *httptest.ResponseRecorder {
+			responseRecorder := httptest.NewRecorder()
+			handler.ServeHTTP(responseRecorder, httptest.NewRequest(method, "http://fakeurl.com/states/prod", nil))
+			return responseRecorder
+		}
+		BeforeEach(func() {
+			handler = maintenance.Middleware(NewProblemWriter(false))(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+		})
+		It("should serve all requests when maintenance mode is disabled", func() {
+			Expect(serve("POST").Code).Should(Equal(http.StatusOK))
+			Expect(serve("LOCK").Code).Should(Equal(http.StatusOK))
+		})
+		It("should refuse writes and locks with retry after when maintenance mode is enabled", func() {
+			maintenance.Enable("credhub upgrade", 2*time.Minute)
+			for _, method := range []string{"POST", "DELETE", "LOCK"} {
+				responseRecorder := serve(method)
+				Expect(responseRecorder.Code).Should(Equal(http.StatusServiceUnavailable))
+				Expect(responseRecorder.Header().Get("Retry-After")).Should(Equal("120"))
+				Expect(responseRecorder.Body.String()).Should(ContainSubstring("credhub upgrade"))
+			}
+			Expect(serve("GET").Code).Should(Equal(http.StatusOK))
+			Expect(serve("UNLOCK").Code).Should(Equal(http.StatusOK))
+		})
+		It("should serve all requests again when maintenance mode is disabled", func() {
+			maintenance.Toggle()
+			Expect(serve("POST").Code).Should(Equal(http.StatusServiceUnavailable))
+			maintenance.Toggle()
+			Expect(serve("POST").Code).Should(Equal(http.StatusOK))
+		})
+	})
+	It("should give defaults in status when enabled without message and retry after", func() {
+		Expect(maintenance.Status().Enabled).Should(BeFalse())
+		maintenance.Enable("", 0)
+		status := maintenance.Status()
+		Expect(status.Enabled).Should(BeTrue())
+		Expect(status.Message).Should(Equal(DefaultMaintenanceMessage))
+		Expect(status.RetryAfter).Should(Equal(DefaultMaintenanceRetryAfter.String()))
+		Expect(status.Since).ShouldNot(BeNil())
+	})
+	Context("MaintenanceController", func() {
+		var controller *MaintenanceController
+		var identity *auth.Identity
+		var responseRecorder *httptest.ResponseRecorder
+		handle := func(handler func(http.ResponseWriter, *http.Request) error, req *http.Request) {
+			NewProblemWriter(false).Handle(handler)(responseRecorder, req.WithContext(auth.WithIdentity(req.Context(), identity)))
+		}
+		BeforeEach(func() {
+			controller = NewMaintenanceController(maintenance)
+			identity = auth.Anonymous()
+			responseRecorder = httptest.NewRecorder()
+		})
+		It("should let admins enable and disable maintenance mode", func() {
+			handle(controller.Enable, httptest.NewRequest("PUT", "http://fakeurl.com/maintenance", bytes.NewBufferString(`{"message": "migration", "retry_after": "1h"}`)))
+			Expect(responseRecorder.Code).Should(Equal(http.StatusOK))
+			var status MaintenanceStatus
+			err := json.Unmarshal(responseRecorder.Body.Bytes(), &status)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(status.Enabled).Should(BeTrue())
+			Expect(status.Message).Should(Equal("migration"))
+			Expect(maintenance.Status().RetryAfter).Should(Equal("1h0m0s"))
+
+			responseRecorder = httptest.NewRecorder()
+			handle(controller.Disable, httptest.NewRequest("DELETE", "http://fakeurl.com/maintenance", nil))
+			Expect(responseRecorder.Code).Should(Equal(http.StatusOK))
+			Expect(maintenance.Status().Enabled).Should(BeFalse())
+		})
+		It("should answer with http code bad request when retry after is invalid", func() {
+			handle(controller.Enable, httptest.NewRequest("PUT", "http://fakeurl.com/maintenance", bytes.NewBufferString(`{"retry_after": "soon"}`)))
+			Expect(responseRecorder.Code).Should(Equal(http.StatusBadRequest))
+			Expect(maintenance.Status().Enabled).Should(BeFalse())
+		})
+		It("should answer with http code forbidden when caller is not admin", func() {
+			identity = &auth.Identity{Name: "alice", Grants: []auth.Grant{{States: []string{"*"}, Rights: []string{auth.RightWrite}}}}
+			handle(controller.Enable, httptest.NewRequest("PUT", "http://fakeurl.com/maintenance", nil))
+			Expect(responseRecorder.Code).Should(Equal(http.StatusForbidden))
+			Expect(maintenance.Status().Enabled).Should(BeFalse())
+		})
+	})
+})
@@ -0,0 +1,97 @@
+// Package metrics holds prometheus collectors of the backend
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"time"
+)
+
+const namespace = "terraform_secure_backend"
+
+var (
+	HttpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Number of http requests by route, method and status code.",
+	}, []string{"route", "method", "status"})
+
+	HttpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Duration of http requests by route, method and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	CredhubDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "credhub_request_duration_seconds",
+		Help:      "Duration of calls to credhub by operation and result.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation", "result"})
+
+	StorerDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "storer_duration_seconds",
+		Help:      "Duration of operations in each storer layer (inner layers included) by operation and result.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"layer", "operation", "result"})
+
+	StoredBytes = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "storer_stored_bytes",
+		Help:      "Size of data received by each storer layer when storing a tfstate.",
+		Buckets:   prometheus.ExponentialBuckets(1024, 4, 10),
+	}, []string{"layer"})
+
+	StoredChunks = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "storer_stored_chunks",
+		Help:      "Number of chunks a tfstate has been cut into when storing.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 10),
+	})
+
+	Locks = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "locks_total",
+		Help:      "Number of lock and unlock attempts by operation and result (acquired, released, forced, conflict).",
+	}, []string{"operation", "result"})
+
+	LocksHeld = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "locks_held",
+		Help:      "Number of tfstates currently locked.",
+	})
+
+	WebhookDeliveries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_deliveries_total",
+		Help:      "Number of webhook deliveries by event and result, a delivery is an error when all retries failed.",
+	}, []string{"event", "result"})
+)
+
+func init() {
+	prometheus.MustRegister(
+		HttpRequests,
+		HttpDuration,
+		CredhubDuration,
+		StorerDuration,
+		StoredBytes,
+		StoredChunks,
+		Locks,
+		LocksHeld,
+		WebhookDeliveries,
+	)
+}
+
+// Result give the result label of an operation
+func Result(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "success"
+}
+
+// Since give seconds elapsed since start as expected by histograms
+func Since(start time.Time) float64 {
+	return time.Since(start).Seconds()
+}
@@ -0,0 +1,32 @@
+package server
+
+import (
+	"github.com/gorilla/mux"
+	"github.com/orange-cloudfoundry/terraform-secure-backend/server/metrics"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// MetricsMiddleware count requests and record their duration by route template,
+// state names are never used as label to keep cardinality low
+func MetricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, req)
+		route := "unknown"
+		if current := mux.CurrentRoute(req); current != nil {
+			if tpl, err := current.GetPathTemplate(); err == nil {
+				route = tpl
+			}
+		}
+		status := sw.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		labels := []string{route, req.Method, strconv.Itoa(status)}
+		metrics.HttpRequests.WithLabelValues(labels...).Inc()
+		metrics.HttpDuration.WithLabelValues(labels...).Observe(metrics.Since(start))
+	})
+}
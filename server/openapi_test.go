@@ -0,0 +1,32 @@
+package server_test
+
+import (
+	"encoding/json"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/orange-cloudfoundry/terraform-secure-backend/server"
+	"net/http"
+	"net/http/httptest"
+)
+
+var _ = Describe("OpenAPI", func() {
+	It("should serve a valid OpenAPI document describing states and locks", func() {
+		responseRecorder := httptest.NewRecorder()
+		OpenAPI(responseRecorder, httptest.NewRequest("GET", "http://fakeurl.com/openapi.json", nil))
+
+		Expect(responseRecorder.Code).Should(Equal(http.StatusOK))
+		var doc struct {
+			OpenAPI string                            `json:"openapi"`
+			Paths   map[string]map[string]interface{} `json:"paths"`
+		}
+		err := json.Unmarshal(responseRecorder.Body.Bytes(), &doc)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(doc.OpenAPI).Should(HavePrefix("3."))
+		Expect(doc.Paths).Should(HaveKey("/states"))
+		Expect(doc.Paths["/states/{name}"]).Should(HaveKey("get"))
+		Expect(doc.Paths["/states/{name}"]).Should(HaveKey("post"))
+		Expect(doc.Paths["/states/{name}"]).Should(HaveKey("delete"))
+		Expect(doc.Paths["/states/{name}"]).Should(HaveKey("x-lock"))
+		Expect(doc.Paths["/states/{name}"]).Should(HaveKey("x-unlock"))
+	})
+})
@@ -0,0 +1,149 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"github.com/orange-cloudfoundry/terraform-secure-backend/server/credhub"
+	log "github.com/sirupsen/logrus"
+	"strings"
+)
+
+// credhubOperations are operations credhub lets grant on a path
+var credhubOperations = []string{"read", "write", "delete", "read_acl", "write_acl"}
+
+// StatePermission grant actor credhub operations on tfstates whose name starts with prefix,
+// actor is a credhub actor, e.g.: uaa-client:my-client or uaa-user:<user guid>
+type StatePermission struct {
+	Actor      string   `json:"actor" yaml:"actor"`
+	Prefix     string   `json:"prefix" yaml:"prefix"`
+	Operations []string `json:"operations" yaml:"operations"`
+}
+
+type StatePermissions []StatePermission
+
+// PermissionSyncer grant credhub permissions on credhub paths of tfstates to actors from config,
+// this let other tools read tfstates directly in credhub with only rights they need.
+// Permissions are added or updated, removing an actor from config doesn't revoke what it has been granted.
+// A nil syncer grants nothing.
+type PermissionSyncer struct {
+	basePath      string
+	credhubClient credhub.CredhubClient
+	permissions   StatePermissions
+}
+
+// NewPermissionSyncer create a syncer for tfstates under base path, nil is given when there is no permission to grant
+func NewPermissionSyncer(basePath string, credhubClient credhub.CredhubClient, permissions StatePermissions) (*PermissionSyncer, error) {
+	if len(permissions) == 0 {
+		return nil, nil
+	}
+	perms := make(StatePermissions, len(permissions))
+	for i, permission := range permissions {
+		if permission.Actor == "" {
+			return nil, fmt.Errorf("Invalid state_permissions: actor must be set")
+		}
+		if len(permission.Operations) == 0 {
+			permission.Operations = []string{"read"}
+		}
+		for _, operation := range permission.Operations {
+			if !validOperation(operation) {
+				return nil, fmt.Errorf("Invalid state_permissions: unknown operation '%s' for actor '%s', operations are %s",
+					operation, permission.Actor, strings.Join(credhubOperations, ", "))
+			}
+		}
+		perms[i] = permission
+	}
+	return &PermissionSyncer{basePath, credhubClient, perms}, nil
+}
+
+func validOperation(operation string) bool {
+	for _, op := range credhubOperations {
+		if op == operation {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *PermissionSyncer) WithContext(ctx context.Context) *PermissionSyncer {
+	if s == nil {
+		return nil
+	}
+	return &PermissionSyncer{s.basePath, credhub.WithContext(s.credhubClient, ctx), s.permissions}
+}
+
+// Grant give actors whose prefix matches tfstate name their permissions on credential of tfstate
+// and on all credentials under it (chunks, index and lock), permissions already granted are updated when operations changed
+func (s *PermissionSyncer) Grant(name string) error {
+	if s == nil {
+		return nil
+	}
+	statePath := fmt.Sprintf("%s/%s", s.basePath, name)
+	for _, permission := range s.permissions {
+		if !strings.HasPrefix(name, permission.Prefix) {
+			continue
+		}
+		for _, path := range []string{statePath, statePath + "/*"} {
+			_, err := s.credhubClient.AddPermission(path, permission.Actor, permission.Operations)
+			if err != nil && strings.Contains(err.Error(), "already exists") {
+				err = s.update(path, permission)
+			}
+			if err != nil {
+				return fmt.Errorf("could not grant '%s' permissions on '%s': %s", permission.Actor, path, err.Error())
+			}
+		}
+	}
+	return nil
+}
+
+// update set operations of permission already granted to actor on path when they differ from config
+func (s *PermissionSyncer) update(path string, permission StatePermission) error {
+	current, err := s.credhubClient.GetPermissionByPathActor(path, permission.Actor)
+	if err != nil {
+		return err
+	}
+	if sameOperations(current.Operations, permission.Operations) {
+		return nil
+	}
+	_, err = s.credhubClient.UpdatePermission(current.UUID, path, permission.Actor, permission.Operations)
+	return err
+}
+
+func sameOperations(ops1, ops2 []string) bool {
+	if len(ops1) != len(ops2) {
+		return false
+	}
+	set := make(map[string]bool)
+	for _, op := range ops1 {
+		set[op] = true
+	}
+	for _, op := range ops2 {
+		if !set[op] {
+			return false
+		}
+	}
+	return true
+}
+
+// Reconcile grant permissions from config on all tfstates found under base path,
+// it goes on with other tfstates when granting fails and gives back the number of failures
+func (s *PermissionSyncer) Reconcile() (int, error) {
+	if s == nil {
+		return 0, nil
+	}
+	entry := log.WithField("action", "permissions-sync").WithField("base_path", s.basePath)
+	result, err := s.credhubClient.FindByPath(s.basePath)
+	if err != nil {
+		return 0, err
+	}
+	failures := 0
+	states := groupStates(s.basePath, result.Credentials)
+	for _, state := range states {
+		err := s.Grant(state.Name)
+		if err != nil {
+			entry.WithField("name", state.Name).Warn(err)
+			failures++
+		}
+	}
+	entry.Infof("Credhub permissions reconciled on %d tfstates, %d failed", len(states), failures)
+	return failures, nil
+}
@@ -0,0 +1,138 @@
+package server_test
+
+import (
+	"bytes"
+	"code.cloudfoundry.org/credhub-cli/credhub/credentials"
+	"code.cloudfoundry.org/credhub-cli/credhub/permissions"
+	"errors"
+	"github.com/gorilla/mux"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/orange-cloudfoundry/terraform-secure-backend/server"
+	"github.com/orange-cloudfoundry/terraform-secure-backend/server/auth"
+	"github.com/orange-cloudfoundry/terraform-secure-backend/server/credhub/credhubfakes"
+	"github.com/orange-cloudfoundry/terraform-secure-backend/server/storer"
+	"net/http"
+	"net/http/httptest"
+	"time"
+)
+
+var _ = Describe("Permissions", func() {
+	var fakeClient *credhubfakes.FakeCredhubClient
+	var syncer *PermissionSyncer
+	type grant struct {
+		path  string
+		actor string
+		ops   []string
+	}
+	grants := func() []grant {
+		result := make([]grant, 0)
+		for i := 0; i < fakeClient.AddPermissionCallCount(); i++ {
+			path, actor, ops := fakeClient.AddPermissionArgsForCall(i)
+			result = append(result, grant{path, actor, ops})
+		}
+		return result
+	}
+	BeforeEach(func() {
+		fakeClient = new(credhubfakes.FakeCredhubClient)
+		var err error
+		syncer, err = NewPermissionSyncer("/test", fakeClient, StatePermissions{
+			{Actor: "uaa-client:reader", Prefix: "team-a-"},
+			{Actor: "uaa-client:ops", Operations: []string{"read", "write"}},
+		})
+		Expect(err).ShouldNot(HaveOccurred())
+	})
+	It("should grant actors whose prefix matches tfstate on its credential and credentials under it", func() {
+		err := syncer.Grant("team-a-network")
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(grants()).Should(Equal([]grant{
+			{"/test/team-a-network", "uaa-client:reader", []string{"read"}},
+			{"/test/team-a-network/*", "uaa-client:reader", []string{"read"}},
+			{"/test/team-a-network", "uaa-client:ops", []string{"read", "write"}},
+			{"/test/team-a-network/*", "uaa-client:ops", []string{"read", "write"}},
+		}))
+
+		err = syncer.Grant("team-b-network")
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(fakeClient.AddPermissionCallCount()).Should(Equal(6))
+	})
+	It("should leave permissions already granted unchanged when operations are the same", func() {
+		fakeClient.AddPermissionReturns(nil, errors.New("A permission entry for this actor and path already exists."))
+		fakeClient.GetPermissionByPathActorStub = func(path string, actor string) (*permissions.Permission, error) {
+			if actor == "uaa-client:ops" {
+				return &permissions.Permission{Path: path, Actor: actor, Operations: []string{"write", "read"}, UUID: "uuid"}, nil
+			}
+			return &permissions.Permission{Path: path, Actor: actor, Operations: []string{"read"}, UUID: "uuid"}, nil
+		}
+		err := syncer.Grant("team-a-network")
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(fakeClient.GetPermissionByPathActorCallCount()).Should(Equal(4))
+		Expect(fakeClient.UpdatePermissionCallCount()).Should(Equal(0))
+
+		fakeClient.AddPermissionReturns(nil, errors.New("fake error"))
+		err = syncer.Grant("team-a-network")
+		Expect(err).Should(HaveOccurred())
+	})
+	It("should update permissions already granted when operations changed", func() {
+		fakeClient.AddPermissionReturns(nil, errors.New("A permission entry for this actor and path already exists."))
+		fakeClient.GetPermissionByPathActorStub = func(path string, actor string) (*permissions.Permission, error) {
+			return &permissions.Permission{Path: path, Actor: actor, Operations: []string{"read"}, UUID: "uuid-" + path}, nil
+		}
+		err := syncer.Grant("team-a-network")
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(fakeClient.UpdatePermissionCallCount()).Should(Equal(2))
+		uuid, path, actor, ops := fakeClient.UpdatePermissionArgsForCall(0)
+		Expect(uuid).Should(Equal("uuid-/test/team-a-network"))
+		Expect(path).Should(Equal("/test/team-a-network"))
+		Expect(actor).Should(Equal("uaa-client:ops"))
+		Expect(ops).Should(Equal([]string{"read", "write"}))
+		_, path, _, _ = fakeClient.UpdatePermissionArgsForCall(1)
+		Expect(path).Should(Equal("/test/team-a-network/*"))
+	})
+	It("should grant permissions on all stored tfstates when reconciling and go on after a failure", func() {
+		fakeClient.FindByPathReturns(credentials.FindResults{Credentials: []credentials.Base{
+			{Name: "/test/team-a-network/index", VersionCreatedAt: "2019-01-01T00:00:00Z"},
+			{Name: "/test/team-a-network/0", VersionCreatedAt: "2019-01-01T00:00:00Z"},
+			{Name: "/test/shared/index", VersionCreatedAt: "2019-01-01T00:00:00Z"},
+			{Name: "/test/.tokens/abcd", VersionCreatedAt: "2019-01-01T00:00:00Z"},
+		}}, nil)
+		fakeClient.AddPermissionReturnsOnCall(0, nil, errors.New("fake error"))
+		failures, err := syncer.Reconcile()
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(failures).Should(Equal(1))
+		paths := make([]string, 0)
+		for _, g := range grants() {
+			paths = append(paths, g.path)
+		}
+		Expect(paths).Should(Equal([]string{"/test/team-a-network", "/test/shared", "/test/shared/*"}))
+	})
+	It("should give nil syncer without permissions and refuse invalid ones", func() {
+		syncer, err := NewPermissionSyncer("/test", fakeClient, nil)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(syncer).Should(BeNil())
+		Expect(syncer.Grant("team-a-network")).Should(Succeed())
+
+		_, err = NewPermissionSyncer("/test", fakeClient, StatePermissions{{Prefix: "team-a-"}})
+		Expect(err).Should(HaveOccurred())
+		_, err = NewPermissionSyncer("/test", fakeClient, StatePermissions{{Actor: "uaa-client:reader", Operations: []string{"admin"}}})
+		Expect(err).Should(HaveOccurred())
+	})
+	It("should grant permissions when storing a tfstate which did not exist", func() {
+		cStorer := storer.NewCredhub(fakeClient)
+		apiController := NewApiController("/test", fakeClient, cStorer, NewLockStore(fakeClient), NewTrash("/test", fakeClient, cStorer, time.Hour), nil).
+			WithPermissions(syncer)
+		store := func() {
+			responseRecorder := httptest.NewRecorder()
+			req := mux.SetURLVars(httptest.NewRequest("POST", "http://fakeurl.com", bytes.NewBufferString(`{"key": "value"}`)), map[string]string{"name": "shared"})
+			NewProblemWriter(true).Handle(apiController.Store)(responseRecorder, req.WithContext(auth.WithIdentity(req.Context(), auth.Anonymous())))
+			Expect(responseRecorder.Code).Should(Equal(http.StatusOK))
+		}
+		fakeClient.GetAllVersionsReturns(nil, errors.New("The request could not be completed because the credential does not exist"))
+		store()
+		Expect(fakeClient.AddPermissionCallCount()).Should(Equal(2))
+
+		fakeClient.GetAllVersionsReturns([]credentials.Credential{{}}, nil)
+		store()
+		Expect(fakeClient.AddPermissionCallCount()).Should(Equal(2))
+	})
+})
@@ -0,0 +1,121 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/orange-cloudfoundry/terraform-secure-backend/server/credhub"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+)
+
+const ProblemContentType = "application/problem+json"
+
+// Problem is an error which is given back to client as an RFC 7807 problem details document
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	// RequestId let a problem seen by client be found in logs
+	RequestId string `json:"request_id,omitempty"`
+	cause     error
+}
+
+func NewProblem(status int, detail string) *Problem {
+	return &Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+	}
+}
+
+// WithCause attach the error which lead to this problem, it is only shown when show_error is enabled
+func (p *Problem) WithCause(err error) *Problem {
+	p.cause = err
+	return p
+}
+
+func (p *Problem) Error() string {
+	msg := p.Title
+	if p.Detail != "" {
+		msg += ": " + p.Detail
+	}
+	if p.cause != nil {
+		msg += ": " + p.cause.Error()
+	}
+	return msg
+}
+
+// ToProblem give the problem corresponding to an error, errors coming from credhub are matched
+// on their message as storers only keep the message when wrapping them
+func ToProblem(err error) *Problem {
+	if p, ok := err.(*Problem); ok {
+		return p
+	}
+	switch e := err.(type) {
+	case *json.SyntaxError, *json.UnmarshalTypeError:
+		return NewProblem(http.StatusBadRequest, "Invalid json given").WithCause(err)
+	case net.Error:
+		if e.Timeout() {
+			return NewProblem(http.StatusGatewayTimeout, "Credhub did not respond in time").WithCause(err)
+		}
+	}
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return NewProblem(http.StatusBadRequest, "Unexpected end of data given").WithCause(err)
+	}
+	msg := strings.ToLower(err.Error())
+	switch {
+	case strings.Contains(msg, "does not exist"):
+		return NewProblem(http.StatusNotFound, "Tfstate does not exist").WithCause(err)
+	case strings.Contains(msg, "forbidden"),
+		strings.Contains(msg, "access_denied"),
+		strings.Contains(msg, "insufficient_scope"),
+		strings.Contains(msg, "invalid_token"),
+		strings.Contains(msg, "not currently authenticated"):
+		return NewProblem(http.StatusForbidden, "Backend is not allowed to perform this operation on credhub").WithCause(err)
+	case strings.Contains(msg, "deadline exceeded"),
+		strings.Contains(msg, "client.timeout"),
+		strings.Contains(msg, "i/o timeout"):
+		return NewProblem(http.StatusGatewayTimeout, "Credhub did not respond in time").WithCause(err)
+	case strings.Contains(msg, credhub.ErrorPrefix):
+		return NewProblem(http.StatusBadGateway, "Error when calling credhub").WithCause(err)
+	}
+	return NewProblem(http.StatusInternalServerError, "Unexpected error").WithCause(err)
+}
+
+// ProblemWriter write errors given by handlers as problem details documents
+type ProblemWriter struct {
+	showError bool
+}
+
+func NewProblemWriter(showError bool) *ProblemWriter {
+	return &ProblemWriter{showError}
+}
+
+// Handle make an http handler from a handler which can give back an error
+func (p ProblemWriter) Handle(handler func(w http.ResponseWriter, req *http.Request) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		err := handler(w, req)
+		if err != nil {
+			p.Write(w, req, err)
+		}
+	}
+}
+
+func (p ProblemWriter) Write(w http.ResponseWriter, req *http.Request, err error) {
+	problem := *ToProblem(err)
+	problem.Instance = req.URL.Path
+	problem.RequestId = RequestId(req.Context())
+	if p.showError && problem.cause != nil {
+		problem.Detail = strings.TrimPrefix(fmt.Sprintf("%s: %s", problem.Detail, problem.cause.Error()), ": ")
+	}
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(problem.Status)
+	b, _ := json.MarshalIndent(problem, "", "\t")
+	w.Write(b)
+}
@@ -0,0 +1,57 @@
+package server_test
+
+import (
+	"encoding/json"
+	"errors"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/orange-cloudfoundry/terraform-secure-backend/server"
+	"github.com/orange-cloudfoundry/terraform-secure-backend/server/credhub"
+	"io"
+	"net/http"
+	"net/http/httptest"
+)
+
+var _ = Describe("Problem", func() {
+	Context("ToProblem", func() {
+		It("should map errors to their status code", func() {
+			Expect(ToProblem(NewProblem(http.StatusConflict, "conflict")).Status).Should(Equal(http.StatusConflict))
+			Expect(ToProblem(io.EOF).Status).Should(Equal(http.StatusBadRequest))
+			Expect(ToProblem(json.Unmarshal([]byte("{"), &struct{}{})).Status).Should(Equal(http.StatusBadRequest))
+			Expect(ToProblem(errors.New("storer/credhub: The request could not be completed because the credential does not exist or you do not have sufficient authorization.")).Status).Should(Equal(http.StatusNotFound))
+			Expect(ToProblem(errors.New("access_denied: Access is denied")).Status).Should(Equal(http.StatusForbidden))
+			Expect(ToProblem(errors.New("context deadline exceeded (Client.Timeout exceeded while awaiting headers)")).Status).Should(Equal(http.StatusGatewayTimeout))
+			Expect(ToProblem(errors.New("storer/credhub: " + credhub.Error{Err: errors.New("a fake error")}.Error())).Status).Should(Equal(http.StatusBadGateway))
+			Expect(ToProblem(errors.New("a fake error")).Status).Should(Equal(http.StatusInternalServerError))
+		})
+	})
+	Context("ProblemWriter", func() {
+		It("should always write a problem+json body", func() {
+			responseRecorder := httptest.NewRecorder()
+			NewProblemWriter(false).Write(responseRecorder, httptest.NewRequest("GET", "http://fakeurl.com/states/foo", nil), credhub.Error{Err: errors.New("a fake error")})
+
+			Expect(responseRecorder.Code).Should(Equal(http.StatusBadGateway))
+			Expect(responseRecorder.Header().Get("Content-Type")).Should(Equal(ProblemContentType))
+			Expect(responseRecorder.Body.String()).Should(MatchJSON(`{
+				"type": "about:blank",
+				"title": "Bad Gateway",
+				"status": 502,
+				"detail": "Error when calling credhub",
+				"instance": "/states/foo"
+			}`))
+		})
+		It("should give error cause in detail only when show error is enabled", func() {
+			req := httptest.NewRequest("GET", "http://fakeurl.com/states/foo", nil)
+			responseRecorder := httptest.NewRecorder()
+			NewProblemWriter(false).Write(responseRecorder, req, errors.New("a fake error"))
+			Expect(responseRecorder.Body.String()).ShouldNot(ContainSubstring("a fake error"))
+
+			responseRecorder = httptest.NewRecorder()
+			NewProblemWriter(true).Write(responseRecorder, req, errors.New("a fake error"))
+			problem := Problem{}
+			err := json.Unmarshal(responseRecorder.Body.Bytes(), &problem)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(problem.Detail).Should(Equal("Unexpected error: a fake error"))
+		})
+	})
+})
@@ -0,0 +1,555 @@
+package server
+
+import (
+	"code.cloudfoundry.org/credhub-cli/credhub/credentials/values"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/orange-cloudfoundry/terraform-secure-backend/server/auth"
+	"github.com/orange-cloudfoundry/terraform-secure-backend/server/credhub"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	APPROVALS_PREFIX      = "/.approvals"
+	APPROVED_LOCKS_PREFIX = "/.approved-locks"
+	PROTECTED_NAME        = "/.protected"
+	// ApprovalTokenPrefix start every approval token
+	ApprovalTokenPrefix = "tsa_"
+	// ApprovalHeader is the header where an approval token is sent, it can also be sent in `approval` parameter
+	ApprovalHeader           = "X-Approval-Token"
+	DefaultApprovalExpiresIn = time.Hour
+)
+
+const (
+	AuditApprovalCreated   = "approval-created"
+	AuditApprovalUsed      = "approval-used"
+	AuditApprovalRefused   = "approval-refused"
+	AuditProtectionChanged = "protection-changed"
+)
+
+var ErrInvalidApproval = errors.New("invalid, expired or already used approval token")
+
+// AuditEvent is an operation on protected tfstates or their approvals
+type AuditEvent struct {
+	Action     string
+	State      string
+	ApprovalId string
+	Detail     string
+}
+
+// AuditLogger is told about every audit event
+type AuditLogger interface {
+	LogAudit(req *http.Request, event AuditEvent)
+}
+
+// Approval let one modification of a protected tfstate be done by a caller without protected right,
+// it is stored in credhub at <base path>/.approvals/<id> with the sha256 of the token.
+// When approval is used to lock tfstate, writes made while this lock is held are approved too.
+type Approval struct {
+	Id        string     `json:"id"`
+	State     string     `json:"state"`
+	Reason    string     `json:"reason"`
+	CreatedAt time.Time  `json:"created_at"`
+	CreatedBy string     `json:"created_by,omitempty"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	UsedBy    string     `json:"used_by,omitempty"`
+	LockId    string     `json:"lock_id,omitempty"`
+	Hash      string     `json:"hash,omitempty"`
+}
+
+// approvedLock is a lock acquired with an approval, it is stored in credhub at <base path>/.approved-locks/<tfstate name>
+// to find it from the lock id without reading every approval
+type approvedLock struct {
+	LockId     string `json:"lock_id"`
+	ApprovalId string `json:"approval_id"`
+	LockedBy   string `json:"locked_by"`
+}
+
+// ProtectionStore keep globs of protected tfstates set by admins and approvals in credhub,
+// globs from config are always protected
+type ProtectionStore struct {
+	basePath      string
+	credhubClient credhub.CredhubClient
+	configGlobs   []string
+	auditLoggers  []AuditLogger
+	uses          *approvalUses
+}
+
+func NewProtectionStore(basePath string, credhubClient credhub.CredhubClient, configGlobs []string, auditLoggers ...AuditLogger) *ProtectionStore {
+	return &ProtectionStore{basePath, credhubClient, configGlobs, auditLoggers, &approvalUses{locks: make(map[string]*sync.Mutex)}}
+}
+
+func (s ProtectionStore) WithContext(ctx context.Context) *ProtectionStore {
+	return &ProtectionStore{s.basePath, credhub.WithContext(s.credhubClient, ctx), s.configGlobs, s.auditLoggers, s.uses}
+}
+
+// approvalUses serialise uses of an approval so that concurrent requests can't use the same token twice,
+// this only holds within one backend: several backends sharing credhub can still race on the same token
+type approvalUses struct {
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+// lock wait until nobody else uses approval with this id and give the function to release it
+func (u *approvalUses) lock(id string) func() {
+	u.mu.Lock()
+	l, ok := u.locks[id]
+	if !ok {
+		l = &sync.Mutex{}
+		u.locks[id] = l
+	}
+	u.mu.Unlock()
+	l.Lock()
+	return l.Unlock
+}
+
+func (u *approvalUses) forget(id string) {
+	u.mu.Lock()
+	delete(u.locks, id)
+	u.mu.Unlock()
+}
+
+// Globs give globs of protected tfstates set by admins
+func (s ProtectionStore) Globs() ([]string, error) {
+	cred, err := s.credhubClient.GetLatestJSON(s.basePath + PROTECTED_NAME)
+	if err != nil && strings.Contains(err.Error(), "does not exist") {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(cred.Value)
+	if err != nil {
+		return nil, err
+	}
+	var protected ProtectedStates
+	err = json.Unmarshal(b, &protected)
+	if protected.States == nil {
+		protected.States = []string{}
+	}
+	return protected.States, err
+}
+
+// SetGlobs replace globs of protected tfstates set by admins
+func (s ProtectionStore) SetGlobs(globs []string) error {
+	b, _ := json.Marshal(ProtectedStates{States: globs})
+	var value values.JSON
+	json.Unmarshal(b, &value)
+	_, err := s.credhubClient.SetJSON(s.basePath+PROTECTED_NAME, value)
+	return err
+}
+
+// IsProtected tell if tfstate matches a glob from config or set by admins
+func (s ProtectionStore) IsProtected(name string) (bool, error) {
+	if matchGlobs(s.configGlobs, name) {
+		return true, nil
+	}
+	globs, err := s.Globs()
+	if err != nil {
+		return false, err
+	}
+	return matchGlobs(globs, name), nil
+}
+
+// CreateApproval store a new approval and give it with the token to send, it is not possible to get it again afterward
+func (s ProtectionStore) CreateApproval(req *http.Request, approval Approval) (Approval, string, error) {
+	id := make([]byte, 8)
+	secret := make([]byte, 32)
+	_, err := rand.Read(id)
+	if err == nil {
+		_, err = rand.Read(secret)
+	}
+	if err != nil {
+		return Approval{}, "", fmt.Errorf("could not generate approval: %s", err.Error())
+	}
+	approval.Id = hex.EncodeToString(id)
+	clearToken := ApprovalTokenPrefix + approval.Id + "_" + base64.RawURLEncoding.EncodeToString(secret)
+	approval.Hash = hashToken(clearToken)
+	err = s.saveApproval(approval)
+	if err != nil {
+		return Approval{}, "", err
+	}
+	approval.Hash = ""
+	s.audit(req, AuditEvent{
+		Action:     AuditApprovalCreated,
+		State:      approval.State,
+		ApprovalId: approval.Id,
+		Detail:     approval.Reason,
+	})
+	return approval, clearToken, nil
+}
+
+// CheckApproval check that token approves a modification of tfstate without using it
+func (s ProtectionStore) CheckApproval(req *http.Request, token, name string) (Approval, error) {
+	approval, err := s.checkApproval(token, name)
+	if err == ErrInvalidApproval {
+		s.audit(req, AuditEvent{Action: AuditApprovalRefused, State: name, ApprovalId: approval.Id, Detail: err.Error()})
+	}
+	if err != nil {
+		return Approval{}, err
+	}
+	return approval, nil
+}
+
+// UseApproval check that token approves a modification of tfstate and mark it as used,
+// lockId is set when approval is used to lock tfstate
+func (s ProtectionStore) UseApproval(req *http.Request, token, name, lockId string) (Approval, error) {
+	id, ok := approvalId(token)
+	if !ok {
+		return s.CheckApproval(req, token, name)
+	}
+	defer s.uses.lock(id)()
+	approval, err := s.CheckApproval(req, token, name)
+	if err != nil {
+		return Approval{}, err
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	approval.UsedAt = &now
+	approval.UsedBy = identityName(req)
+	approval.LockId = lockId
+	err = s.saveApproval(approval)
+	if err != nil {
+		return Approval{}, err
+	}
+	if lockId != "" {
+		err = s.saveApprovedLock(name, approvedLock{lockId, approval.Id, approval.UsedBy})
+		if err != nil {
+			return Approval{}, err
+		}
+	}
+	approval.Hash = ""
+	detail := fmt.Sprintf("%s %s", req.Method, name)
+	if lockId != "" {
+		detail += fmt.Sprintf(" with lock '%s'", lockId)
+	}
+	s.audit(req, AuditEvent{Action: AuditApprovalUsed, State: name, ApprovalId: approval.Id, Detail: detail})
+	return approval, nil
+}
+
+// approvalId give id of approval from its token
+func approvalId(token string) (string, bool) {
+	parts := strings.SplitN(strings.TrimPrefix(token, ApprovalTokenPrefix), "_", 2)
+	if !strings.HasPrefix(token, ApprovalTokenPrefix) || len(parts) != 2 || !validTokenId(parts[0]) {
+		return "", false
+	}
+	return parts[0], true
+}
+
+func (s ProtectionStore) checkApproval(token, name string) (Approval, error) {
+	id, ok := approvalId(token)
+	if !ok {
+		return Approval{}, ErrInvalidApproval
+	}
+	approval, err := s.findApproval(id)
+	if err != nil && strings.Contains(err.Error(), "does not exist") {
+		return Approval{}, ErrInvalidApproval
+	}
+	if err != nil {
+		return Approval{}, err
+	}
+	if subtle.ConstantTimeCompare([]byte(approval.Hash), []byte(hashToken(token))) != 1 {
+		return Approval{Id: approval.Id}, ErrInvalidApproval
+	}
+	if approval.State != name || approval.UsedAt != nil || time.Now().After(approval.ExpiresAt) {
+		return approval, ErrInvalidApproval
+	}
+	return approval, nil
+}
+
+// LockApproved tell if lock with this id on tfstate has been acquired with an approval by user
+func (s ProtectionStore) LockApproved(name, lockId, user string) (bool, error) {
+	cred, err := s.credhubClient.GetLatestJSON(s.basePath + APPROVED_LOCKS_PREFIX + "/" + name)
+	if err != nil && strings.Contains(err.Error(), "does not exist") {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	b, err := json.Marshal(cred.Value)
+	if err != nil {
+		return false, err
+	}
+	var lock approvedLock
+	err = json.Unmarshal(b, &lock)
+	if err != nil {
+		return false, err
+	}
+	return lock.LockId == lockId && lock.LockedBy == user, nil
+}
+
+func (s ProtectionStore) saveApprovedLock(name string, lock approvedLock) error {
+	b, _ := json.Marshal(lock)
+	var value values.JSON
+	json.Unmarshal(b, &value)
+	_, err := s.credhubClient.SetJSON(s.basePath+APPROVED_LOCKS_PREFIX+"/"+name, value)
+	return err
+}
+
+// PurgeApprovals delete approvals which are used or expired, locks acquired with them stay approved
+func (s ProtectionStore) PurgeApprovals() error {
+	approvals, err := s.ListApprovals()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, approval := range approvals {
+		if approval.UsedAt == nil && approval.ExpiresAt.After(now) {
+			continue
+		}
+		logrus.WithField("action", "purge-approvals").WithField("approval_id", approval.Id).Debug("Purging approval")
+		err = s.credhubClient.Delete(s.basePath + APPROVALS_PREFIX + "/" + approval.Id)
+		if err != nil && !strings.Contains(err.Error(), "does not exist") {
+			return err
+		}
+		s.uses.forget(approval.Id)
+	}
+	return nil
+}
+
+// PurgeApprovalsEvery run PurgeApprovals now and then at each interval, this never returns
+func (s ProtectionStore) PurgeApprovalsEvery(interval time.Duration) {
+	for {
+		err := s.PurgeApprovals()
+		if err != nil {
+			logrus.WithField("action", "purge-approvals").Errorf("Error when purging approvals: %s", err.Error())
+		}
+		time.Sleep(interval)
+	}
+}
+
+// ListApprovals give approvals, without their hash, from the most recently created to the oldest
+func (s ProtectionStore) ListApprovals() ([]Approval, error) {
+	result, err := s.credhubClient.FindByPath(s.basePath + APPROVALS_PREFIX)
+	if err != nil && strings.Contains(err.Error(), "does not exist") {
+		return []Approval{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	approvals := make([]Approval, 0)
+	for _, cred := range result.Credentials {
+		approval, err := s.findApproval(ParseTfName(cred.Name))
+		if err != nil {
+			return nil, err
+		}
+		approval.Hash = ""
+		approvals = append(approvals, approval)
+	}
+	sort.Slice(approvals, func(i, j int) bool {
+		return approvals[i].CreatedAt.After(approvals[j].CreatedAt)
+	})
+	return approvals, nil
+}
+
+func (s ProtectionStore) findApproval(id string) (Approval, error) {
+	cred, err := s.credhubClient.GetLatestJSON(s.basePath + APPROVALS_PREFIX + "/" + id)
+	if err != nil {
+		return Approval{}, err
+	}
+	b, err := json.Marshal(cred.Value)
+	if err != nil {
+		return Approval{}, err
+	}
+	var approval Approval
+	err = json.Unmarshal(b, &approval)
+	return approval, err
+}
+
+func (s ProtectionStore) saveApproval(approval Approval) error {
+	b, _ := json.Marshal(approval)
+	var value values.JSON
+	json.Unmarshal(b, &value)
+	_, err := s.credhubClient.SetJSON(s.basePath+APPROVALS_PREFIX+"/"+approval.Id, value)
+	return err
+}
+
+// audit write event in logs with type audit and give it to audit loggers
+func (s ProtectionStore) audit(req *http.Request, event AuditEvent) {
+	RequestLogger(req).WithFields(logrus.Fields{
+		"type":        "audit",
+		"action":      event.Action,
+		"name":        event.State,
+		"approval_id": event.ApprovalId,
+		"user":        identityName(req),
+		"client_ip":   remoteIp(req),
+	}).Warnf("%s: %s", event.Action, event.Detail)
+	for _, auditLogger := range s.auditLoggers {
+		auditLogger.LogAudit(req, event)
+	}
+}
+
+func matchGlobs(globs []string, name string) bool {
+	for _, glob := range globs {
+		if ok, _ := path.Match(glob, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// approvalToken give approval token sent in header or in `approval` parameter
+func approvalToken(req *http.Request) string {
+	if token := req.Header.Get(ApprovalHeader); token != "" {
+		return token
+	}
+	return req.URL.Query().Get("approval")
+}
+
+// ProtectedStates is the list of globs of protected tfstates
+type ProtectedStates struct {
+	States []string `json:"states"`
+	// ConfigStates are globs from config, they can't be changed through api
+	ConfigStates []string `json:"config_states,omitempty"`
+}
+
+// ApprovalRequest is what is sent to create an approval, it expires after an hour when expires_in is not set
+type ApprovalRequest struct {
+	State     string `json:"state"`
+	Reason    string `json:"reason"`
+	ExpiresIn string `json:"expires_in"`
+}
+
+// CreatedApproval is given back when an approval is created
+type CreatedApproval struct {
+	Approval
+	Token string `json:"token"`
+}
+
+// ProtectionController let admins of all tfstates protect tfstates and create approvals to modify them
+type ProtectionController struct {
+	store *ProtectionStore
+}
+
+func NewProtectionController(store *ProtectionStore) *ProtectionController {
+	return &ProtectionController{store}
+}
+
+func (c ProtectionController) authorize(req *http.Request) error {
+	if auth.FromContext(req.Context()).IsAdmin() {
+		return nil
+	}
+	return NewProblem(http.StatusForbidden, "Only admins of all tfstates can manage protected tfstates and approvals")
+}
+
+func (c ProtectionController) GetProtected(w http.ResponseWriter, req *http.Request) error {
+	entry := RequestLogger(req).WithField("action", "get-protected")
+	if err := c.authorize(req); err != nil {
+		return err
+	}
+	globs, err := c.store.WithContext(req.Context()).Globs()
+	if err != nil {
+		entry.Error(err)
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	b, _ := json.MarshalIndent(ProtectedStates{States: globs, ConfigStates: c.store.configGlobs}, "", "\t")
+	w.Write(b)
+	return nil
+}
+
+func (c ProtectionController) SetProtected(w http.ResponseWriter, req *http.Request) error {
+	defer req.Body.Close()
+	entry := RequestLogger(req).WithField("action", "set-protected")
+	if err := c.authorize(req); err != nil {
+		return err
+	}
+	var protected ProtectedStates
+	err := json.NewDecoder(req.Body).Decode(&protected)
+	if err != nil {
+		return NewProblem(http.StatusBadRequest, "Invalid protected tfstates given").WithCause(err)
+	}
+	if protected.States == nil {
+		protected.States = []string{}
+	}
+	for _, glob := range protected.States {
+		if _, err := path.Match(glob, ""); err != nil || glob == "" {
+			return NewProblem(http.StatusBadRequest, fmt.Sprintf("Invalid state glob '%s'", glob))
+		}
+	}
+	store := c.store.WithContext(req.Context())
+	err = store.SetGlobs(protected.States)
+	if err != nil {
+		entry.Error(err)
+		return err
+	}
+	store.audit(req, AuditEvent{
+		Action: AuditProtectionChanged,
+		Detail: fmt.Sprintf("protected tfstates set to [%s]", strings.Join(protected.States, ", ")),
+	})
+	w.Header().Set("Content-Type", "application/json")
+	b, _ := json.MarshalIndent(ProtectedStates{States: protected.States, ConfigStates: c.store.configGlobs}, "", "\t")
+	w.Write(b)
+	return nil
+}
+
+func (c ProtectionController) CreateApproval(w http.ResponseWriter, req *http.Request) error {
+	defer req.Body.Close()
+	entry := RequestLogger(req).WithField("action", "create-approval")
+	if err := c.authorize(req); err != nil {
+		return err
+	}
+	var approvalReq ApprovalRequest
+	err := json.NewDecoder(req.Body).Decode(&approvalReq)
+	if err != nil {
+		return NewProblem(http.StatusBadRequest, "Invalid approval request given").WithCause(err)
+	}
+	if approvalReq.State == "" || strings.ContainsAny(approvalReq.State, `*?[\/`) {
+		return NewProblem(http.StatusBadRequest, "Approval must be given for one tfstate name")
+	}
+	if approvalReq.Reason == "" {
+		return NewProblem(http.StatusBadRequest, "Approval must have a reason")
+	}
+	expiresIn := DefaultApprovalExpiresIn
+	if approvalReq.ExpiresIn != "" {
+		expiresIn, err = time.ParseDuration(approvalReq.ExpiresIn)
+		if err != nil || expiresIn <= 0 {
+			return NewProblem(http.StatusBadRequest, fmt.Sprintf("Invalid expires_in '%s', it must be a positive duration", approvalReq.ExpiresIn))
+		}
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	approval, token, err := c.store.WithContext(req.Context()).CreateApproval(req, Approval{
+		State:     approvalReq.State,
+		Reason:    approvalReq.Reason,
+		CreatedAt: now,
+		CreatedBy: identityName(req),
+		ExpiresAt: now.Add(expiresIn),
+	})
+	if err != nil {
+		entry.Error(err)
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	b, _ := json.MarshalIndent(CreatedApproval{approval, token}, "", "\t")
+	w.Write(b)
+	return nil
+}
+
+func (c ProtectionController) ListApprovals(w http.ResponseWriter, req *http.Request) error {
+	entry := RequestLogger(req).WithField("action", "list-approvals")
+	if err := c.authorize(req); err != nil {
+		return err
+	}
+	approvals, err := c.store.WithContext(req.Context()).ListApprovals()
+	if err != nil {
+		entry.Error(err)
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	b, _ := json.MarshalIndent(approvals, "", "\t")
+	w.Write(b)
+	return nil
+}
@@ -0,0 +1,319 @@
+package server_test
+
+import (
+	"bytes"
+	"code.cloudfoundry.org/credhub-cli/credhub/credentials"
+	"code.cloudfoundry.org/credhub-cli/credhub/credentials/values"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/orange-cloudfoundry/terraform-secure-backend/server"
+	"github.com/orange-cloudfoundry/terraform-secure-backend/server/auth"
+	"github.com/orange-cloudfoundry/terraform-secure-backend/server/credhub/credhubfakes"
+	"github.com/orange-cloudfoundry/terraform-secure-backend/server/storer"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+)
+
+type fakeAuditLogger struct {
+	events []AuditEvent
+}
+
+func (l *fakeAuditLogger) LogAudit(req *http.Request, event AuditEvent) {
+	l.events = append(l.events, event)
+}
+
+var _ = Describe("Protection", func() {
+	var fakeClient *credhubfakes.FakeCredhubClient
+	var auditLogger *fakeAuditLogger
+	var protections *ProtectionStore
+	var protectionController *ProtectionController
+	var apiController *ApiController
+	var responseRecorder *httptest.ResponseRecorder
+	var identity *auth.Identity
+	problemWriter := NewProblemWriter(true)
+	admin := &auth.Identity{Name: "admin", Grants: []auth.Grant{{States: []string{"*"}, Rights: []string{auth.RightAdmin}}}}
+	writer := &auth.Identity{Name: "ci", Grants: []auth.Grant{{States: []string{"*"}, Rights: []string{auth.RightWrite, auth.RightLock}}}}
+	handle := func(handler func(http.ResponseWriter, *http.Request) error, req *http.Request) {
+		responseRecorder = httptest.NewRecorder()
+		problemWriter.Handle(handler)(responseRecorder, req.WithContext(auth.WithIdentity(req.Context(), identity)))
+	}
+	withName := func(req *http.Request, name string) *http.Request {
+		return mux.SetURLVars(req, map[string]string{"name": name})
+	}
+	createApproval := func(body string) CreatedApproval {
+		identity = admin
+		handle(protectionController.CreateApproval, httptest.NewRequest("POST", "http://fakeurl.com/approvals", bytes.NewBufferString(body)))
+		Expect(responseRecorder.Code).Should(Equal(http.StatusCreated))
+		var created CreatedApproval
+		err := json.Unmarshal(responseRecorder.Body.Bytes(), &created)
+		Expect(err).ShouldNot(HaveOccurred())
+		identity = writer
+		return created
+	}
+	BeforeEach(func() {
+		// credhub keeping in memory what is set
+		jsonCreds := make(map[string]values.JSON)
+		valueCreds := make(map[string]string)
+		var mu sync.Mutex
+		fakeClient = new(credhubfakes.FakeCredhubClient)
+		fakeClient.SetJSONStub = func(name string, value values.JSON) (credentials.JSON, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			jsonCreds[name] = value
+			return credentials.JSON{Value: value}, nil
+		}
+		fakeClient.GetLatestJSONStub = func(name string) (credentials.JSON, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			value, ok := jsonCreds[name]
+			if !ok {
+				return credentials.JSON{}, errors.New("The request could not be completed because the credential does not exist")
+			}
+			return credentials.JSON{Value: value}, nil
+		}
+		fakeClient.DeleteStub = func(name string) error {
+			mu.Lock()
+			defer mu.Unlock()
+			delete(jsonCreds, name)
+			delete(valueCreds, name)
+			return nil
+		}
+		fakeClient.SetValueStub = func(name string, value values.Value) (credentials.Value, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			valueCreds[name] = string(value)
+			return credentials.Value{}, nil
+		}
+		fakeClient.GetLatestValueStub = func(name string) (credentials.Value, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			value, ok := valueCreds[name]
+			if !ok {
+				return credentials.Value{}, errors.New("The request could not be completed because the credential does not exist")
+			}
+			return credentials.Value{Value: values.Value(value)}, nil
+		}
+		fakeClient.FindByPathStub = func(path string) (credentials.FindResults, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			results := credentials.FindResults{Credentials: []credentials.Base{}}
+			for name := range jsonCreds {
+				if strings.HasPrefix(name, path+"/") {
+					results.Credentials = append(results.Credentials, credentials.Base{Name: name})
+				}
+			}
+			return results, nil
+		}
+		auditLogger = &fakeAuditLogger{}
+		protections = NewProtectionStore("test", fakeClient, []string{"prod-*"}, auditLogger)
+		protectionController = NewProtectionController(protections)
+		cStorer := storer.NewCredhub(fakeClient)
+		apiController = NewApiController("test", fakeClient, cStorer, NewLockStore(fakeClient), NewTrash("test", fakeClient, cStorer, time.Hour), nil).
+			WithProtections(protections)
+		identity = writer
+	})
+	It("should protect tfstates matching globs from config or set by admins", func() {
+		identity = admin
+		handle(protectionController.SetProtected, httptest.NewRequest("PUT", "http://fakeurl.com/protected", bytes.NewBufferString(`{"states": ["network"]}`)))
+		Expect(responseRecorder.Code).Should(Equal(http.StatusOK))
+
+		handle(protectionController.GetProtected, httptest.NewRequest("GET", "http://fakeurl.com/protected", nil))
+		var protected ProtectedStates
+		err := json.Unmarshal(responseRecorder.Body.Bytes(), &protected)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(protected.States).Should(ConsistOf("network"))
+		Expect(protected.ConfigStates).Should(ConsistOf("prod-*"))
+
+		for name, expected := range map[string]bool{"network": true, "prod-db": true, "dev-db": false} {
+			isProtected, err := protections.IsProtected(name)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(isProtected).Should(Equal(expected))
+		}
+		Expect(auditLogger.events).Should(HaveLen(1))
+		Expect(auditLogger.events[0].Action).Should(Equal(AuditProtectionChanged))
+	})
+	It("should refuse to modify protected tfstates without approval", func() {
+		handle(apiController.Store, withName(httptest.NewRequest("POST", "http://fakeurl.com", bytes.NewBufferString(`{"key": "value"}`)), "prod-db"))
+		Expect(responseRecorder.Code).Should(Equal(http.StatusForbidden))
+		handle(apiController.Delete, withName(httptest.NewRequest("DELETE", "http://fakeurl.com", nil), "prod-db"))
+		Expect(responseRecorder.Code).Should(Equal(http.StatusForbidden))
+		handle(apiController.Lock, withName(httptest.NewRequest("LOCK", "http://fakeurl.com", bytes.NewBufferString(`{"ID": "lock-1"}`)), "prod-db"))
+		Expect(responseRecorder.Code).Should(Equal(http.StatusForbidden))
+
+		handle(apiController.Store, withName(httptest.NewRequest("POST", "http://fakeurl.com", bytes.NewBufferString(`{"key": "value"}`)), "dev-db"))
+		Expect(responseRecorder.Code).Should(Equal(http.StatusOK))
+	})
+	It("should let callers with protected right modify protected tfstates", func() {
+		identity = &auth.Identity{Name: "ops", Grants: []auth.Grant{{States: []string{"prod-*"}, Rights: []string{auth.RightWrite, auth.RightProtected}}}}
+		handle(apiController.Store, withName(httptest.NewRequest("POST", "http://fakeurl.com", bytes.NewBufferString(`{"key": "value"}`)), "prod-db"))
+		Expect(responseRecorder.Code).Should(Equal(http.StatusOK))
+	})
+	It("should approve one modification with an approval token and audit it", func() {
+		created := createApproval(`{"state": "prod-db", "reason": "CHG-42"}`)
+		Expect(created.Token).Should(HavePrefix(ApprovalTokenPrefix + created.Id + "_"))
+		Expect(created.CreatedBy).Should(Equal("admin"))
+		Expect(created.ExpiresAt).Should(BeTemporally("~", time.Now().Add(DefaultApprovalExpiresIn), time.Minute))
+
+		req := withName(httptest.NewRequest("POST", "http://fakeurl.com", bytes.NewBufferString(`{"key": "value"}`)), "prod-db")
+		req.Header.Set(ApprovalHeader, created.Token)
+		handle(apiController.Store, req)
+		Expect(responseRecorder.Code).Should(Equal(http.StatusOK))
+
+		req = withName(httptest.NewRequest("POST", "http://fakeurl.com?approval="+created.Token, bytes.NewBufferString(`{"key": "value"}`)), "prod-db")
+		handle(apiController.Store, req)
+		Expect(responseRecorder.Code).Should(Equal(http.StatusForbidden))
+
+		actions := make([]string, 0)
+		for _, event := range auditLogger.events {
+			Expect(event.ApprovalId).Should(Equal(created.Id))
+			actions = append(actions, event.Action)
+		}
+		Expect(actions).Should(Equal([]string{AuditApprovalCreated, AuditApprovalUsed, AuditApprovalRefused}))
+
+		identity = admin
+		handle(protectionController.ListApprovals, httptest.NewRequest("GET", "http://fakeurl.com/approvals", nil))
+		var approvals []Approval
+		err := json.Unmarshal(responseRecorder.Body.Bytes(), &approvals)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(approvals).Should(HaveLen(1))
+		Expect(approvals[0].UsedBy).Should(Equal("ci"))
+		Expect(approvals[0].Hash).Should(BeEmpty())
+	})
+	It("should refuse approval token given for another tfstate or expired", func() {
+		created := createApproval(`{"state": "prod-network", "reason": "CHG-42"}`)
+		req := withName(httptest.NewRequest("POST", "http://fakeurl.com", bytes.NewBufferString(`{"key": "value"}`)), "prod-db")
+		req.Header.Set(ApprovalHeader, created.Token)
+		handle(apiController.Store, req)
+		Expect(responseRecorder.Code).Should(Equal(http.StatusForbidden))
+
+		created = createApproval(`{"state": "prod-db", "reason": "CHG-42", "expires_in": "1ns"}`)
+		time.Sleep(time.Millisecond)
+		req = withName(httptest.NewRequest("POST", "http://fakeurl.com", bytes.NewBufferString(`{"key": "value"}`)), "prod-db")
+		req.Header.Set(ApprovalHeader, created.Token)
+		handle(apiController.Store, req)
+		Expect(responseRecorder.Code).Should(Equal(http.StatusForbidden))
+	})
+	It("should approve writes made while holding a lock acquired with an approval token", func() {
+		created := createApproval(`{"state": "prod-db", "reason": "CHG-42"}`)
+		req := withName(httptest.NewRequest("LOCK", "http://fakeurl.com", bytes.NewBufferString(`{"ID": "lock-1"}`)), "prod-db")
+		req.Header.Set(ApprovalHeader, created.Token)
+		handle(apiController.Lock, req)
+		Expect(responseRecorder.Code).Should(Equal(http.StatusOK))
+
+		handle(apiController.Store, withName(httptest.NewRequest("POST", "http://fakeurl.com?ID=lock-1", bytes.NewBufferString(`{"key": "value"}`)), "prod-db"))
+		Expect(responseRecorder.Code).Should(Equal(http.StatusOK))
+		// terraform sends again approval given in address
+		handle(apiController.Store, withName(httptest.NewRequest("POST", "http://fakeurl.com?ID=lock-1&approval="+created.Token, bytes.NewBufferString(`{"key": "value"}`)), "prod-db"))
+		Expect(responseRecorder.Code).Should(Equal(http.StatusOK))
+		handle(apiController.Store, withName(httptest.NewRequest("POST", "http://fakeurl.com?ID=lock-2", bytes.NewBufferString(`{"key": "value"}`)), "prod-db"))
+		Expect(responseRecorder.Code).Should(Equal(http.StatusForbidden))
+	})
+	It("should not use approval token when lock can't be acquired", func() {
+		created := createApproval(`{"state": "prod-db", "reason": "CHG-42"}`)
+		setValue := fakeClient.SetValueStub
+		fakeClient.SetValueStub = func(name string, value values.Value) (credentials.Value, error) {
+			return credentials.Value{}, errors.New("a fake error")
+		}
+		req := withName(httptest.NewRequest("LOCK", "http://fakeurl.com", bytes.NewBufferString(`{"ID": "lock-1"}`)), "prod-db")
+		req.Header.Set(ApprovalHeader, created.Token)
+		handle(apiController.Lock, req)
+		Expect(responseRecorder.Code).ShouldNot(Equal(http.StatusOK))
+
+		fakeClient.SetValueStub = setValue
+		req = withName(httptest.NewRequest("LOCK", "http://fakeurl.com", bytes.NewBufferString(`{"ID": "lock-1"}`)), "prod-db")
+		req.Header.Set(ApprovalHeader, created.Token)
+		handle(apiController.Lock, req)
+		Expect(responseRecorder.Code).Should(Equal(http.StatusOK))
+	})
+	It("should let only one of concurrent requests use an approval token", func() {
+		created := createApproval(`{"state": "prod-db", "reason": "CHG-42"}`)
+		getLatestJSON := fakeClient.GetLatestJSONStub
+		fakeClient.GetLatestJSONStub = func(name string) (credentials.JSON, error) {
+			cred, err := getLatestJSON(name)
+			// let every request read approval before one of them marks it used
+			time.Sleep(10 * time.Millisecond)
+			return cred, err
+		}
+		var wg sync.WaitGroup
+		results := make(chan error, 5)
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer GinkgoRecover()
+				req := withName(httptest.NewRequest("POST", "http://fakeurl.com", nil), "prod-db")
+				req.Header.Set(ApprovalHeader, created.Token)
+				_, err := protections.UseApproval(req.WithContext(auth.WithIdentity(req.Context(), writer)), created.Token, "prod-db", "")
+				results <- err
+			}()
+		}
+		wg.Wait()
+		close(results)
+		used := 0
+		for err := range results {
+			if err == nil {
+				used++
+				continue
+			}
+			Expect(err).Should(Equal(ErrInvalidApproval))
+		}
+		Expect(used).Should(Equal(1))
+	})
+	It("should purge used and expired approvals and keep locks acquired with them approved", func() {
+		used := createApproval(`{"state": "prod-db", "reason": "CHG-42"}`)
+		req := withName(httptest.NewRequest("LOCK", "http://fakeurl.com", bytes.NewBufferString(`{"ID": "lock-1"}`)), "prod-db")
+		req.Header.Set(ApprovalHeader, used.Token)
+		handle(apiController.Lock, req)
+		Expect(responseRecorder.Code).Should(Equal(http.StatusOK))
+		createApproval(`{"state": "prod-db", "reason": "CHG-43", "expires_in": "1ns"}`)
+		pending := createApproval(`{"state": "prod-db", "reason": "CHG-44"}`)
+		time.Sleep(time.Millisecond)
+
+		err := protections.PurgeApprovals()
+		Expect(err).ShouldNot(HaveOccurred())
+
+		approvals, err := protections.ListApprovals()
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(approvals).Should(HaveLen(1))
+		Expect(approvals[0].Id).Should(Equal(pending.Id))
+		findCalls := fakeClient.FindByPathCallCount()
+		approved, err := protections.LockApproved("prod-db", "lock-1", "ci")
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(approved).Should(BeTrue())
+		Expect(fakeClient.FindByPathCallCount()).Should(Equal(findCalls))
+	})
+	It("should refuse writes with id of a lock acquired with an approval by someone else", func() {
+		created := createApproval(`{"state": "prod-db", "reason": "CHG-42"}`)
+		req := withName(httptest.NewRequest("LOCK", "http://fakeurl.com", bytes.NewBufferString(`{"ID": "lock-1"}`)), "prod-db")
+		req.Header.Set(ApprovalHeader, created.Token)
+		handle(apiController.Lock, req)
+		Expect(responseRecorder.Code).Should(Equal(http.StatusOK))
+
+		identity = &auth.Identity{Name: "other", Grants: writer.Grants}
+		handle(apiController.Store, withName(httptest.NewRequest("POST", "http://fakeurl.com?ID=lock-1", bytes.NewBufferString(`{"key": "value"}`)), "prod-db"))
+		Expect(responseRecorder.Code).Should(Equal(http.StatusForbidden))
+	})
+	Context("ProtectionController", func() {
+		It("should answer with http code bad request when approval is not for one tfstate or has no reason", func() {
+			identity = admin
+			for _, body := range []string{`{"state": "prod-*", "reason": "CHG-42"}`, `{"state": "prod-db"}`, `{"state": "prod-db", "reason": "CHG-42", "expires_in": "-1h"}`} {
+				handle(protectionController.CreateApproval, httptest.NewRequest("POST", "http://fakeurl.com/approvals", bytes.NewBufferString(body)))
+				Expect(responseRecorder.Code).Should(Equal(http.StatusBadRequest))
+			}
+			Expect(fakeClient.SetJSONCallCount()).Should(Equal(0))
+		})
+		It("should answer with http code forbidden when caller is not admin", func() {
+			handle(protectionController.CreateApproval, httptest.NewRequest("POST", "http://fakeurl.com/approvals", bytes.NewBufferString(`{"state": "prod-db", "reason": "CHG-42"}`)))
+			Expect(responseRecorder.Code).Should(Equal(http.StatusForbidden))
+			handle(protectionController.SetProtected, httptest.NewRequest("PUT", "http://fakeurl.com/protected", bytes.NewBufferString(`{"states": []}`)))
+			Expect(responseRecorder.Code).Should(Equal(http.StatusForbidden))
+			Expect(fakeClient.SetJSONCallCount()).Should(Equal(0))
+		})
+	})
+})
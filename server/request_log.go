@@ -0,0 +1,124 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/sirupsen/logrus"
+	"io"
+	"net/http"
+	"time"
+)
+
+const RequestIdHeader = "X-Request-Id"
+
+type requestIdKey struct{}
+
+type loggedUserKey struct{}
+
+// loggedUser hold name of the caller known once request is authenticated,
+// it lets middlewares running before authentication log who made the request
+type loggedUser struct {
+	name string
+}
+
+// SetLoggedUser set name of the caller shown in logs of the request
+func SetLoggedUser(ctx context.Context, name string) {
+	if user, ok := ctx.Value(loggedUserKey{}).(*loggedUser); ok {
+		user.name = name
+	}
+}
+
+// LoggedUser give name of the caller set by SetLoggedUser, basic auth username is given when none was set
+func LoggedUser(req *http.Request) string {
+	if user, ok := req.Context().Value(loggedUserKey{}).(*loggedUser); ok && user.name != "" {
+		return user.name
+	}
+	username, _, _ := req.BasicAuth()
+	return username
+}
+
+// RequestId give the id of the request found in ctx, empty if there is none
+func RequestId(ctx context.Context) string {
+	id, _ := ctx.Value(requestIdKey{}).(string)
+	return id
+}
+
+// RequestLogger give a log entry carrying the request id
+func RequestLogger(req *http.Request) *logrus.Entry {
+	entry := logrus.NewEntry(logrus.StandardLogger())
+	if id := RequestId(req.Context()); id != "" {
+		entry = entry.WithField("request_id", id)
+	}
+	return entry
+}
+
+// RequestIdMiddleware keep the X-Request-Id sent by client or generate a new one,
+// id is given back in response header and set in request context
+func RequestIdMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		id := req.Header.Get(RequestIdHeader)
+		if !validRequestId(id) {
+			id = newRequestId()
+		}
+		w.Header().Set(RequestIdHeader, id)
+		next.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), requestIdKey{}, id)))
+	})
+}
+
+func validRequestId(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		if c < 0x21 || c > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestId() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// AccessLogMiddleware emit one log line per request with who did what, how long it took and how much data was exchanged
+func AccessLogMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w}
+		body := &countReadCloser{ReadCloser: req.Body}
+		req.Body = body
+		req = req.WithContext(context.WithValue(req.Context(), loggedUserKey{}, &loggedUser{}))
+		next.ServeHTTP(sw, req)
+		status := sw.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		RequestLogger(req).WithFields(logrus.Fields{
+			"type":        "access",
+			"method":      req.Method,
+			"path":        req.URL.Path,
+			"status":      status,
+			"duration_ms": float64(time.Since(start).Nanoseconds()) / float64(time.Millisecond),
+			"bytes_in":    body.size,
+			"bytes_out":   sw.length,
+			"client_ip":   remoteIp(req),
+			"user":        LoggedUser(req),
+			"user_agent":  req.UserAgent(),
+		}).Infof("%s %s %d", req.Method, req.URL.Path, status)
+	})
+}
+
+type countReadCloser struct {
+	io.ReadCloser
+	size int64
+}
+
+func (r *countReadCloser) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.size += int64(n)
+	return n, err
+}
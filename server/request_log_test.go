@@ -0,0 +1,89 @@
+package server_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/orange-cloudfoundry/terraform-secure-backend/server"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+)
+
+var _ = Describe("RequestLog", func() {
+	var hook *test.Hook
+	var oldHooks logrus.LevelHooks
+	BeforeEach(func() {
+		oldHooks = logrus.StandardLogger().ReplaceHooks(logrus.LevelHooks{})
+		hook = test.NewLocal(logrus.StandardLogger())
+	})
+	AfterEach(func() {
+		logrus.StandardLogger().ReplaceHooks(oldHooks)
+	})
+	Context("RequestIdMiddleware", func() {
+		var requestId string
+		handler := RequestIdMiddleware(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			requestId = RequestId(req.Context())
+			NewProblemWriter(false).Write(w, req, errors.New("a fake error"))
+		}))
+		It("should keep request id sent by client and give it in error body", func() {
+			responseRecorder := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "http://fakeurl.com/states/foo", nil)
+			req.Header.Set(RequestIdHeader, "my-id")
+			handler.ServeHTTP(responseRecorder, req)
+
+			Expect(requestId).Should(Equal("my-id"))
+			Expect(responseRecorder.Header().Get(RequestIdHeader)).Should(Equal("my-id"))
+			problem := Problem{}
+			err := json.Unmarshal(responseRecorder.Body.Bytes(), &problem)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(problem.RequestId).Should(Equal("my-id"))
+		})
+		It("should generate a request id when client gives none or an invalid one", func() {
+			responseRecorder := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "http://fakeurl.com/states/foo", nil)
+			req.Header.Set(RequestIdHeader, "invalid id")
+			handler.ServeHTTP(responseRecorder, req)
+
+			Expect(requestId).Should(HaveLen(32))
+			Expect(responseRecorder.Header().Get(RequestIdHeader)).Should(Equal(requestId))
+		})
+	})
+	Context("AccessLogMiddleware", func() {
+		It("should emit one log line per request with request id", func() {
+			handler := RequestIdMiddleware(AccessLogMiddleware(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				ioutil.ReadAll(req.Body)
+				RequestLogger(req).Info("in handler")
+				w.WriteHeader(http.StatusCreated)
+				w.Write([]byte("done"))
+			})))
+			req := httptest.NewRequest("POST", "http://fakeurl.com/states/foo", bytes.NewBufferString("data"))
+			req.Header.Set(RequestIdHeader, "my-id")
+			req.SetBasicAuth("user", "password")
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			Expect(hook.AllEntries()).Should(HaveLen(2))
+			Expect(hook.AllEntries()[0].Data["request_id"]).Should(Equal("my-id"))
+			entry := hook.LastEntry()
+			Expect(entry.Data["type"]).Should(Equal("access"))
+			Expect(entry.Data["request_id"]).Should(Equal("my-id"))
+			Expect(entry.Data["status"]).Should(Equal(http.StatusCreated))
+			Expect(entry.Data["user"]).Should(Equal("user"))
+			Expect(entry.Data["bytes_in"]).Should(BeEquivalentTo(4))
+			Expect(entry.Data["bytes_out"]).Should(BeEquivalentTo(4))
+			Expect(entry.Data["client_ip"]).Should(Equal("192.0.2.1"))
+		})
+		It("should log name of authenticated caller as user", func() {
+			handler := AccessLogMiddleware(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				SetLoggedUser(req.Context(), "CN=ci-pipeline")
+			}))
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://fakeurl.com/states/foo", nil))
+
+			Expect(hook.LastEntry().Data["user"]).Should(Equal("CN=ci-pipeline"))
+		})
+	})
+})
@@ -2,23 +2,33 @@ package server
 
 import (
 	"code.cloudfoundry.org/credhub-cli/credhub"
-	"code.cloudfoundry.org/credhub-cli/credhub/auth"
-	"encoding/json"
+	cauth "code.cloudfoundry.org/credhub-cli/credhub/auth"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"github.com/cloudfoundry-community/gautocloud"
 	"github.com/cloudfoundry-community/gautocloud/connectors/generic"
 	"github.com/goji/httpauth"
 	"github.com/gorilla/mux"
+	"github.com/orange-cloudfoundry/terraform-secure-backend/server/auth"
 	cclient "github.com/orange-cloudfoundry/terraform-secure-backend/server/credhub"
+	"github.com/orange-cloudfoundry/terraform-secure-backend/server/metrics"
 	"github.com/orange-cloudfoundry/terraform-secure-backend/server/storer"
+	"github.com/orange-cloudfoundry/terraform-secure-backend/server/tracing"
+	"github.com/orange-cloudfoundry/terraform-secure-backend/server/webhook"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	log "github.com/sirupsen/logrus"
 	"golang.org/x/crypto/acme/autocert"
+	"golang.org/x/crypto/bcrypt"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 )
 
 const (
@@ -30,36 +40,72 @@ func init() {
 }
 
 type ServerConfig struct {
-	Host               string   `json:"host" yaml:"host"`
-	BasePath           string   `json:"base_path" yaml:"base_path"`
-	ChunkSize          int64    `json:"chunk_size" yaml:"chunk_size"`
-	Port               int      `json:"port" yaml:"port"`
-	Cert               string   `json:"cert" yaml:"cert" cloud-default:"server.crt"`
-	Key                string   `json:"key" yaml:"key" cloud-default:"server.key"`
-	LogLevel           string   `json:"log_level" yaml:"log_level" cloud-default:"info"`
-	LogJson            bool     `json:"log_json" yaml:"log_json"`
-	NoColor            bool     `json:"no_color" yaml:"no_color"`
-	LetsEncryptDomains []string `json:"lets_encrypt_domains" yaml:"lets_encrypt_domains"`
-	Username           string   `json:"username" yaml:"username"`
-	Password           string   `json:"password" yaml:"password"`
-	CredhubServer      string   `json:"credhub_server" yaml:"credhub_server"`
-	CredhubUsername    string   `json:"credhub_username" yaml:"credhub_username"`
-	CredhubPassword    string   `json:"credhub_password" yaml:"credhub_password"`
-	CredhubClient      string   `json:"credhub_client" yaml:"credhub_client"`
-	CredhubSecret      string   `json:"credhub_secret" yaml:"credhub_secret"`
-	CredhubCaCert      string   `json:"credhub_ca_cert" yaml:"credhub_ca_cert"`
-	SkipSslValidation  bool     `json:"skip_ssl_validation" yaml:"skip_ssl_validation"`
-	ShowError          bool     `json:"show_error" yaml:"show_error"`
-	CEF                bool     `json:"cef" yaml:"cef"`
-	CEFFile            string   `json:"cef-file" yaml:"cef-file"`
-	AuthUrl            string   `json:"auth-url" yaml:"auth-url"`
-	DryRun             bool     `json:"dry-run" yaml:"dry-run"`
+	Host               string           `json:"host" yaml:"host"`
+	BasePath           string           `json:"base_path" yaml:"base_path"`
+	ChunkSize          int64            `json:"chunk_size" yaml:"chunk_size"`
+	Port               int              `json:"port" yaml:"port"`
+	Cert               string           `json:"cert" yaml:"cert" cloud-default:"server.crt"`
+	Key                string           `json:"key" yaml:"key" cloud-default:"server.key"`
+	LogLevel           string           `json:"log_level" yaml:"log_level" cloud-default:"info"`
+	LogJson            bool             `json:"log_json" yaml:"log_json"`
+	NoColor            bool             `json:"no_color" yaml:"no_color"`
+	LetsEncryptDomains []string         `json:"lets_encrypt_domains" yaml:"lets_encrypt_domains"`
+	Username           string           `json:"username" yaml:"username"`
+	Password           string           `json:"password" yaml:"password"`
+	CredhubServer      string           `json:"credhub_server" yaml:"credhub_server"`
+	CredhubUsername    string           `json:"credhub_username" yaml:"credhub_username"`
+	CredhubPassword    string           `json:"credhub_password" yaml:"credhub_password"`
+	CredhubClient      string           `json:"credhub_client" yaml:"credhub_client"`
+	CredhubSecret      string           `json:"credhub_secret" yaml:"credhub_secret"`
+	CredhubCaCert      string           `json:"credhub_ca_cert" yaml:"credhub_ca_cert"`
+	SkipSslValidation  bool             `json:"skip_ssl_validation" yaml:"skip_ssl_validation"`
+	ShowError          bool             `json:"show_error" yaml:"show_error"`
+	CEF                bool             `json:"cef" yaml:"cef"`
+	CEFFile            string           `json:"cef-file" yaml:"cef-file"`
+	AuthUrl            string           `json:"auth-url" yaml:"auth-url"`
+	DryRun             bool             `json:"dry-run" yaml:"dry-run"`
+	TrashRetention     string           `json:"trash_retention" yaml:"trash_retention"`
+	MetricsUsername    string           `json:"metrics_username" yaml:"metrics_username"`
+	MetricsPassword    string           `json:"metrics_password" yaml:"metrics_password"`
+	OTLPEndpoint       string           `json:"otlp_endpoint" yaml:"otlp_endpoint"`
+	OTLPInsecure       bool             `json:"otlp_insecure" yaml:"otlp_insecure"`
+	Webhooks           []webhook.Config `json:"webhooks" yaml:"webhooks"`
+	WebhookLockHeldFor string           `json:"webhook_lock_held_for" yaml:"webhook_lock_held_for"`
+	Users              []auth.User      `json:"users" yaml:"users"`
+	UsersFile          string           `json:"users_file" yaml:"users_file"`
+	Policies           auth.Policies    `json:"policies" yaml:"policies"`
+	JWTIssuers         []auth.JWTIssuer `json:"jwt_issuers" yaml:"jwt_issuers"`
+	ClientCA           string           `json:"client_ca" yaml:"client_ca"`
+	ClientCertRequired bool             `json:"client_cert_required" yaml:"client_cert_required"`
+	ClientCertIdentity string           `json:"client_cert_identity" yaml:"client_cert_identity"`
+	Tenants            []TenantConfig   `json:"tenants" yaml:"tenants"`
+	TrustedProxies     []string         `json:"trusted_proxies" yaml:"trusted_proxies"`
+	AllowedIps         []string         `json:"allowed_ips" yaml:"allowed_ips"`
+	StateAllowedIps    []IpRule         `json:"state_allowed_ips" yaml:"state_allowed_ips"`
+	ProtectedStates    []string         `json:"protected_states" yaml:"protected_states"`
+	StatePermissions   StatePermissions `json:"state_permissions" yaml:"state_permissions"`
+	Maintenance        bool             `json:"maintenance" yaml:"maintenance"`
+	MaintenanceMessage string           `json:"maintenance_message" yaml:"maintenance_message"`
+	MaintenanceRetry   string           `json:"maintenance_retry_after" yaml:"maintenance_retry_after"`
+	AuthMaxFailures    int              `json:"auth_max_failures" yaml:"auth_max_failures"`
+	AuthLockout        string           `json:"auth_lockout" yaml:"auth_lockout"`
+	RateLimit          float64          `json:"rate_limit" yaml:"rate_limit"`
+	RateLimitBurst     int              `json:"rate_limit_burst" yaml:"rate_limit_burst"`
 }
 
 type Server struct {
-	config  *ServerConfig
-	handler http.Handler
-	version string
+	config   *ServerConfig
+	handler  http.Handler
+	version  string
+	notifier *webhook.Notifier
+	// tenants are all tenants served, main tenant first
+	tenants          []*Tenant
+	trashRetention   time.Duration
+	clientIpResolver *ClientIpResolver
+	allowlist        *IpAllowlist
+	maintenance      *Maintenance
+	// lockHeldFor is zero when no lock-held event must be sent
+	lockHeldFor time.Duration
 }
 
 func NewServer(version string, config *ServerConfig) (*Server, error) {
@@ -134,6 +180,10 @@ func (s *Server) Load() error {
 	if err != nil {
 		return err
 	}
+	s.config.ClientCA, err = s.getTlsPem(s.config.ClientCA)
+	if err != nil {
+		return err
+	}
 
 	err = s.loadHandler()
 	if err != nil {
@@ -152,16 +202,70 @@ func (s *Server) Load() error {
 }
 
 func (s *Server) loadHandler() error {
-	credhubClient, err := s.CreateCredhubCli()
+	err := ValidateTenants(s.config.BasePath, s.config.Tenants)
 	if err != nil {
 		return err
 	}
-	lockStore := NewLockStore(credhubClient)
-	store := storer.NewGzip(storer.NewB64(storer.NewCutter(
-		storer.NewCredhub(credhubClient), s.config.ChunkSize),
-	))
-	controller := NewApiController(s.config.BasePath, credhubClient, store, lockStore)
+	client, err := s.CreateCredhubCli()
+	if err != nil {
+		return err
+	}
+	credhubClient := cclient.NewErrorCredhubClient(cclient.NewMetricsCredhubClient(cclient.NewTracingCredhubClient(client)))
+	s.trashRetention = DefaultTrashRetention
+	if s.config.TrashRetention != "" {
+		s.trashRetention, err = time.ParseDuration(s.config.TrashRetention)
+		if err != nil {
+			return fmt.Errorf("Invalid trash_retention: %s", err.Error())
+		}
+	}
+	s.notifier, err = webhook.NewNotifier(s.config.Webhooks)
+	if err != nil {
+		return err
+	}
+	if s.config.WebhookLockHeldFor != "" {
+		s.lockHeldFor, err = time.ParseDuration(s.config.WebhookLockHeldFor)
+		if err != nil {
+			return fmt.Errorf("Invalid webhook_lock_held_for: %s", err.Error())
+		}
+	}
+	s.clientIpResolver, err = NewClientIpResolver(s.config.TrustedProxies)
+	if err != nil {
+		return err
+	}
+	s.allowlist, err = NewIpAllowlist(s.config.AllowedIps, s.config.StateAllowedIps)
+	if err != nil {
+		return err
+	}
+	maintenanceRetry := DefaultMaintenanceRetryAfter
+	if s.config.MaintenanceRetry != "" {
+		maintenanceRetry, err = time.ParseDuration(s.config.MaintenanceRetry)
+		if err != nil {
+			return fmt.Errorf("Invalid maintenance_retry_after: %s", err.Error())
+		}
+	}
+	s.maintenance = NewMaintenance(s.config.MaintenanceMessage, maintenanceRetry)
+	if s.config.Maintenance {
+		s.maintenance.Enable("", 0)
+	}
+	problemWriter := NewProblemWriter(s.config.ShowError)
+	handle := func(handler func(ApiController, http.ResponseWriter, *http.Request) error) http.HandlerFunc {
+		return problemWriter.Handle(func(w http.ResponseWriter, req *http.Request) error {
+			return handler(tenantFromContext(req.Context()).controller.WithContext(req.Context()), w, req)
+		})
+	}
+	handleTokens := func(handler func(TokenController, http.ResponseWriter, *http.Request) error) http.HandlerFunc {
+		return problemWriter.Handle(func(w http.ResponseWriter, req *http.Request) error {
+			return handler(*tenantFromContext(req.Context()).tokenController, w, req)
+		})
+	}
+	handleProtections := func(handler func(ProtectionController, http.ResponseWriter, *http.Request) error) http.HandlerFunc {
+		return problemWriter.Handle(func(w http.ResponseWriter, req *http.Request) error {
+			return handler(*tenantFromContext(req.Context()).protectionController, w, req)
+		})
+	}
 	rtr := mux.NewRouter()
+	lockoutLoggers := make([]LockoutLogger, 0)
+	auditLoggers := make([]AuditLogger, 0)
 	if s.config.CEF {
 		var cefW io.Writer = os.Stdout
 		if s.config.CEFFile != "" {
@@ -172,41 +276,312 @@ func (s *Server) loadHandler() error {
 		}
 		cefMiddleware := NewCEFMiddleware(cefW, s.version)
 		rtr.Use(cefMiddleware.Middleware)
+		lockoutLoggers = append(lockoutLoggers, cefMiddleware)
+		auditLoggers = append(auditLoggers, cefMiddleware)
+	}
+	rtr.Use(MetricsMiddleware)
+	rtr.Use(TracingMiddleware)
+	rtr.Use(CrossSiteMiddleware(problemWriter))
+	healthController := NewHealthController(s.version, s.config.BasePath, credhubClient).WithMaintenance(s.maintenance)
+	rtr.HandleFunc("/healthz", healthController.Healthz).Methods("GET")
+	rtr.HandleFunc("/readyz", healthController.Readyz).Methods("GET")
+	rtr.HandleFunc("/version", healthController.Version).Methods("GET")
+	var metricsHandler http.Handler = promhttp.Handler()
+	if s.config.MetricsUsername != "" {
+		metricsHandler = httpauth.SimpleBasicAuth(s.config.MetricsUsername, s.config.MetricsPassword)(metricsHandler)
+	}
+	rtr.Handle("/metrics", metricsHandler).Methods("GET")
+	rtr.HandleFunc("/openapi.json", OpenAPI).Methods("GET")
+
+	var failures *FailureTracker
+	if s.config.AuthMaxFailures >= 0 {
+		maxFailures := s.config.AuthMaxFailures
+		if maxFailures == 0 {
+			maxFailures = DefaultAuthMaxFailures
+		}
+		lockout := DefaultAuthLockout
+		if s.config.AuthLockout != "" {
+			lockout, err = time.ParseDuration(s.config.AuthLockout)
+			if err != nil {
+				return fmt.Errorf("Invalid auth_lockout: %s", err.Error())
+			}
+		}
+		failures = NewFailureTracker(maxFailures, lockout)
 	}
-	apiRtr := rtr.PathPrefix("/states").Subrouter()
-	apiRtr.HandleFunc("/{name}", controller.Store).Methods("POST")
-	apiRtr.HandleFunc("/{name}", controller.Retrieve).Methods("GET")
-	apiRtr.HandleFunc("/{name}", controller.Delete).Methods("DELETE")
-	apiRtr.HandleFunc("/{name}", controller.Lock).Methods("LOCK")
-	apiRtr.HandleFunc("/{name}", controller.UnLock).Methods("UNLOCK")
-	rtr.HandleFunc("/states", controller.List).Methods("GET")
-	if s.config.Username != "" {
-		rtr.Use(httpauth.SimpleBasicAuth(s.config.Username, s.config.Password))
+	loadTenant := func(config TenantConfig, credhubClient cclient.CredhubClient) (*Tenant, error) {
+		authenticators, err := s.loadAuthenticators(config)
+		if err != nil {
+			return nil, err
+		}
+		tokenStore := NewTokenStore(config.BasePath, credhubClient)
+		if len(authenticators) > 0 {
+			// tokens are checked first as basic authenticator refuses unknown users
+			authenticators = append([]auth.Authenticator{tokenStore}, authenticators...)
+		}
+		authMiddleware := NewAuthMiddleware(problemWriter, authenticators...)
+		if len(authenticators) > 0 && failures != nil {
+			authMiddleware = authMiddleware.WithFailureTracker(failures, lockoutLoggers...)
+		}
+		if s.config.RateLimit > 0 {
+			authMiddleware = authMiddleware.WithRateLimiter(NewRateLimiter(s.config.RateLimit, s.config.RateLimitBurst))
+		}
+		protections := NewProtectionStore(config.BasePath, credhubClient, config.ProtectedStates, auditLoggers...)
+		permissions, err := NewPermissionSyncer(config.BasePath, credhubClient, config.StatePermissions)
+		if err != nil {
+			return nil, err
+		}
+		return s.loadTenant(config, credhubClient, tokenStore, protections, permissions, authMiddleware), nil
+	}
+	mainConfig, err := s.mainTenantConfig()
+	if err != nil {
+		return err
+	}
+	mainTenant, err := loadTenant(mainConfig, credhubClient)
+	if err != nil {
+		return err
 	}
+	s.tenants = []*Tenant{mainTenant}
+	for _, config := range s.config.Tenants {
+		tenantClient := credhubClient
+		if config.hasCredhubCredentials() {
+			client, err := s.createCredhubCli(config.CredhubUsername, config.CredhubPassword, config.CredhubClient, config.CredhubSecret)
+			if err != nil {
+				return fmt.Errorf("Tenant '%s': %s", config.Name, err.Error())
+			}
+			tenantClient = cclient.NewErrorCredhubClient(cclient.NewMetricsCredhubClient(cclient.NewTracingCredhubClient(client)))
+		}
+		tenant, err := loadTenant(config, tenantClient)
+		if err != nil {
+			return fmt.Errorf("Tenant '%s': %s", config.Name, err.Error())
+		}
+		if len(tenant.authMiddleware.authenticators) == 0 {
+			return fmt.Errorf("Tenant '%s' must define users, users_file or jwt_issuers", config.Name)
+		}
+		s.tenants = append(s.tenants, tenant)
+	}
+	tenantMiddleware := NewTenantMiddleware(problemWriter, mainTenant, s.tenants[1:]...)
+
+	dashboard := NewDashboard(s.version, s.config.ChunkSize)
+	addRoutes := func(authRtr *mux.Router) {
+		apiRtr := authRtr.PathPrefix("/states").Subrouter()
+		apiRtr.HandleFunc("/{name}", handle(ApiController.Store)).Methods("POST")
+		apiRtr.HandleFunc("/{name}", handle(ApiController.Retrieve)).Methods("GET")
+		apiRtr.HandleFunc("/{name}", handle(ApiController.Delete)).Methods("DELETE")
+		apiRtr.HandleFunc("/{name}", handle(ApiController.Lock)).Methods("LOCK")
+		apiRtr.HandleFunc("/{name}", handle(ApiController.UnLock)).Methods("UNLOCK")
+		apiRtr.HandleFunc("/{name}/versions", handle(ApiController.Versions)).Methods("GET")
+		apiRtr.HandleFunc("/{name}/diff", handle(ApiController.Diff)).Methods("GET")
+		apiRtr.HandleFunc("/{name}/copy", handle(ApiController.Copy)).Methods("POST")
+		apiRtr.HandleFunc("/{name}/move", handle(ApiController.Move)).Methods("POST")
+		authRtr.HandleFunc("/states", handle(ApiController.List)).Methods("GET")
+		authRtr.Handle("/dashboard", dashboard).Methods("GET")
+		authRtr.HandleFunc("/trash", handle(ApiController.ListTrash)).Methods("GET")
+		authRtr.HandleFunc("/trash/{name}/restore", handle(ApiController.RestoreTrash)).Methods("POST")
+		authRtr.HandleFunc("/tokens", handleTokens(TokenController.Create)).Methods("POST")
+		authRtr.HandleFunc("/tokens", handleTokens(TokenController.List)).Methods("GET")
+		authRtr.HandleFunc("/tokens/{id}", handleTokens(TokenController.Revoke)).Methods("DELETE")
+		authRtr.HandleFunc("/protected", handleProtections(ProtectionController.GetProtected)).Methods("GET")
+		authRtr.HandleFunc("/protected", handleProtections(ProtectionController.SetProtected)).Methods("PUT")
+		authRtr.HandleFunc("/approvals", handleProtections(ProtectionController.CreateApproval)).Methods("POST")
+		authRtr.HandleFunc("/approvals", handleProtections(ProtectionController.ListApprovals)).Methods("GET")
+	}
+	if len(s.tenants) > 1 {
+		tenantRtr := rtr.PathPrefix("/t/{tenant}").Subrouter()
+		addRoutes(tenantRtr)
+		tenantRtr.Use(s.allowlist.Middleware(problemWriter), tenantMiddleware.ByURL, s.maintenance.Middleware(problemWriter))
+	}
+	// maintenance endpoint is kept out of maintenance middleware to be able to disable it
+	maintenanceController := NewMaintenanceController(s.maintenance)
+	maintenanceRtr := rtr.PathPrefix("/maintenance").Subrouter()
+	maintenanceRtr.HandleFunc("", problemWriter.Handle(maintenanceController.Get)).Methods("GET")
+	maintenanceRtr.HandleFunc("", problemWriter.Handle(maintenanceController.Enable)).Methods("PUT")
+	maintenanceRtr.HandleFunc("", problemWriter.Handle(maintenanceController.Disable)).Methods("DELETE")
+	maintenanceRtr.Use(s.allowlist.Middleware(problemWriter), tenantMiddleware.Main)
+	authRtr := rtr.PathPrefix("/").Subrouter()
+	addRoutes(authRtr)
+	authRtr.Use(s.allowlist.Middleware(problemWriter), tenantMiddleware.ByIdentity, s.maintenance.Middleware(problemWriter))
 	s.handler = rtr
 	return nil
 }
 
+// mainTenantConfig give config of tenant served without tenant name in url, user set with username and password
+// gets admin rights on all its tfstates
+func (s Server) mainTenantConfig() (TenantConfig, error) {
+	config := TenantConfig{
+		BasePath:         s.config.BasePath,
+		Users:            append([]auth.User{}, s.config.Users...),
+		UsersFile:        s.config.UsersFile,
+		Policies:         append(auth.Policies{}, s.config.Policies...),
+		JWTIssuers:       s.config.JWTIssuers,
+		ProtectedStates:  s.config.ProtectedStates,
+		StatePermissions: s.config.StatePermissions,
+	}
+	if s.config.Username != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(s.config.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return config, err
+		}
+		config.Users = append(config.Users, auth.User{Username: s.config.Username, Password: string(hash)})
+		config.Policies = append(config.Policies, auth.Policy{
+			Users:  []string{s.config.Username},
+			States: []string{"*"},
+			Rights: []string{auth.RightAdmin},
+		})
+	}
+	return config, nil
+}
+
+// loadTenant create stores and controllers of a tenant
+func (s Server) loadTenant(config TenantConfig, credhubClient cclient.CredhubClient, tokenStore *TokenStore, protections *ProtectionStore, permissions *PermissionSyncer, authMiddleware *AuthMiddleware) *Tenant {
+	instrument := func(next storer.Storer, layer string) storer.Storer {
+		return storer.NewTracing(storer.NewMetrics(next, layer), layer)
+	}
+	store := instrument(storer.NewGzip(
+		instrument(storer.NewB64(
+			instrument(storer.NewCutter(
+				instrument(storer.NewCredhub(credhubClient), "credhub"),
+				s.config.ChunkSize,
+			), "cutter"),
+		), "b64"),
+	), "gzip")
+	lockStore := NewLockStore(credhubClient)
+	trash := NewTrash(config.BasePath, credhubClient, store, s.trashRetention)
+	controller := NewApiController(config.BasePath, credhubClient, store, lockStore, trash, s.notifier).WithIpAllowlist(s.allowlist).WithProtections(protections).WithPermissions(permissions)
+	return NewTenant(config.Name, config.BasePath, controller, NewTokenController(tokenStore), authMiddleware)
+}
+
+// loadAuthenticators give authenticators from tenant config, authentication is disabled when no authenticator is given
+func (s Server) loadAuthenticators(config TenantConfig) ([]auth.Authenticator, error) {
+	authenticators := make([]auth.Authenticator, 0)
+	users := append([]auth.User{}, config.Users...)
+	policies := config.Policies
+	if config.UsersFile != "" {
+		fileUsers, err := auth.LoadUsersFile(config.UsersFile)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, fileUsers...)
+	}
+	if len(users) > 0 {
+		basicAuthenticator, err := auth.NewBasicAuthenticator(users, policies)
+		if err != nil {
+			return nil, err
+		}
+		authenticators = append(authenticators, basicAuthenticator)
+	}
+	if len(config.JWTIssuers) > 0 {
+		jwtAuthenticator, err := auth.NewJWTAuthenticator(config.JWTIssuers, policies)
+		if err != nil {
+			return nil, err
+		}
+		authenticators = append(authenticators, jwtAuthenticator)
+	}
+	if s.config.ClientCA != "" {
+		certAuthenticator, err := auth.NewCertAuthenticator(s.config.ClientCertIdentity, policies)
+		if err != nil {
+			return nil, err
+		}
+		authenticators = append(authenticators, certAuthenticator)
+	}
+	if len(authenticators) == 0 && config.Name == "" {
+		log.Warn("No users, jwt issuers or client ca configured, authentication is disabled.")
+	}
+	return authenticators, nil
+}
+
 func (s Server) runTls(servAddr string, handler http.Handler) (bool, error) {
 	if s.config.Cert == "" || s.config.Key == "" {
 		return false, fmt.Errorf("No certificate or key provided")
 	}
-	err := http.ListenAndServeTLS(servAddr, s.config.Cert, s.config.Key, handler)
+	tlsConfig := &tls.Config{}
+	err := s.loadClientCA(tlsConfig)
+	if err != nil {
+		return false, err
+	}
+	server := &http.Server{
+		Addr:      servAddr,
+		Handler:   handler,
+		TLSConfig: tlsConfig,
+	}
+	err = server.ListenAndServeTLS(s.config.Cert, s.config.Key)
 	if err != nil {
 		return false, err
 	}
 	return true, nil
 }
 
+// runLetsEncrypt serve on :443 with certificates acquired from let's encrypt
+func (s Server) runLetsEncrypt(handler http.Handler) error {
+	if s.config.ClientCA == "" {
+		return http.Serve(autocert.NewListener(s.config.LetsEncryptDomains...), handler)
+	}
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return err
+	}
+	manager := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(s.config.LetsEncryptDomains...),
+		Cache:      autocert.DirCache(filepath.Join(cacheDir, "golang-autocert")),
+	}
+	tlsConfig := manager.TLSConfig()
+	err = s.loadClientCA(tlsConfig)
+	if err != nil {
+		return err
+	}
+	listener, err := tls.Listen("tcp", ":443", tlsConfig)
+	if err != nil {
+		return err
+	}
+	return http.Serve(listener, handler)
+}
+
+// loadClientCA make tlsConfig ask for client certificates signed by client_ca, if set
+func (s Server) loadClientCA(tlsConfig *tls.Config) error {
+	if s.config.ClientCA == "" {
+		return nil
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM([]byte(s.config.ClientCA)) {
+		return fmt.Errorf("No certificate found in client_ca")
+	}
+	tlsConfig.ClientCAs = pool
+	tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	if s.config.ClientCertRequired {
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return nil
+}
+
 func (s Server) Run() error {
-	finalHandler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-		defer s.panicRecover(w)
+	finalHandler := RequestIdMiddleware(s.clientIpResolver.Middleware(AccessLogMiddleware(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		defer s.panicRecover(w, req)
 		s.handler.ServeHTTP(w, req)
-	})
+	}))))
+	if s.config.OTLPEndpoint != "" {
+		shutdown, err := tracing.Setup(s.config.OTLPEndpoint, s.config.OTLPInsecure, s.version)
+		if err != nil {
+			return fmt.Errorf("Error when setting up tracing: %s", err.Error())
+		}
+		defer shutdown(context.Background())
+		log.Infof("Exporting traces over OTLP to '%s'", s.config.OTLPEndpoint)
+	}
+	for _, tenant := range s.tenants {
+		go tenant.controller.trash.PurgeEvery(time.Hour)
+		if tenant.controller.protections != nil {
+			go tenant.controller.protections.PurgeApprovalsEvery(time.Hour)
+		}
+		if s.lockHeldFor > 0 {
+			go tenant.controller.store.WatchLocksHeld(tenant.Name, tenant.basePath, s.lockHeldFor, time.Minute, s.notifier)
+		}
+	}
+	go s.syncLocksHeldEvery(time.Minute)
+	go s.reconcilePermissions()
+	go s.maintenance.WatchSignal()
 	servAddr := fmt.Sprintf("%s:%d", s.config.Host, s.config.Port)
 	if s.config.LetsEncryptDomains != nil && len(s.config.LetsEncryptDomains) > 0 {
 		log.Info("Serving in https on ':443' with let's encrypt certificate (443 is mandatory by let's encrypt).")
-		return http.Serve(autocert.NewListener(s.config.LetsEncryptDomains...), finalHandler)
+		return s.runLetsEncrypt(finalHandler)
 	}
 	log.Infof("Serving in https on address '%s'", servAddr)
 	inTls, err := s.runTls(servAddr, finalHandler)
@@ -219,10 +594,47 @@ func (s Server) Run() error {
 	if inTls {
 		return nil
 	}
+	if s.config.ClientCA != "" {
+		return fmt.Errorf("Client certificates can't be used without tls: %s", err.Error())
+	}
 	log.Infof("Serving an insecure server in http on address '%s'", servAddr)
 	return http.ListenAndServe(servAddr, finalHandler)
 }
 
+// reconcilePermissions grant credhub permissions from config on tfstates already stored in all tenants
+func (s Server) reconcilePermissions() {
+	for _, tenant := range s.tenants {
+		_, err := tenant.controller.permissions.Reconcile()
+		if err != nil {
+			log.Warnf("Could not reconcile credhub permissions of '%s': %s", tenant.basePath, err.Error())
+		}
+	}
+}
+
+// syncLocksHeldEvery run syncLocksHeld now and then at each interval, this never returns.
+// Gauge is only moved by locks made through this instance, syncing it catches locks
+// made by other instances or deleted directly in credhub
+func (s Server) syncLocksHeldEvery(interval time.Duration) {
+	for {
+		s.syncLocksHeld()
+		time.Sleep(interval)
+	}
+}
+
+// syncLocksHeld set the number of locks held from locks found in all tenants
+func (s Server) syncLocksHeld() {
+	nb := 0
+	for _, tenant := range s.tenants {
+		tenantNb, err := tenant.controller.store.CountLocksHeld(tenant.basePath)
+		if err != nil {
+			log.Warnf("Could not count locks held: %s", err.Error())
+			return
+		}
+		nb += tenantNb
+	}
+	metrics.LocksHeld.Set(float64(nb))
+}
+
 func (s Server) getTlsPem(tlsConf string) (string, error) {
 	if tlsConf == "" {
 		return "", nil
@@ -253,6 +665,11 @@ func (s Server) getTlsFilePath(tlsConf string) (string, error) {
 }
 
 func (s Server) CreateCredhubCli() (cclient.CredhubClient, error) {
+	return s.createCredhubCli(s.config.CredhubUsername, s.config.CredhubPassword, s.config.CredhubClient, s.config.CredhubSecret)
+}
+
+// createCredhubCli create a client to credhub server from config authenticated with given credentials
+func (s Server) createCredhubCli(username, password, clientId, clientSecret string) (cclient.CredhubClient, error) {
 	if s.config.DryRun {
 		return &cclient.NullCredhubClient{}, nil
 	}
@@ -260,10 +677,6 @@ func (s Server) CreateCredhubCli() (cclient.CredhubClient, error) {
 	if !strings.HasPrefix(apiEndpoint, "https://") {
 		apiEndpoint = "https://" + apiEndpoint
 	}
-	username := s.config.CredhubUsername
-	password := s.config.CredhubPassword
-	clientId := s.config.CredhubClient
-	clientSecret := s.config.CredhubSecret
 	if (username == "" || password == "") && (clientId == "" || clientSecret == "") {
 		return nil, fmt.Errorf("One of pair Username/Password or Client_id/client_secret must be set.")
 	}
@@ -272,9 +685,9 @@ func (s Server) CreateCredhubCli() (cclient.CredhubClient, error) {
 		if clientId == "" {
 			clientId = "credhub_cli"
 		}
-		options = append(options, credhub.Auth(auth.UaaPassword(clientId, clientSecret, username, password)))
+		options = append(options, credhub.Auth(cauth.UaaPassword(clientId, clientSecret, username, password)))
 	} else {
-		options = append(options, credhub.Auth(auth.UaaClientCredentials(clientId, clientSecret)))
+		options = append(options, credhub.Auth(cauth.UaaClientCredentials(clientId, clientSecret)))
 	}
 	if s.config.SkipSslValidation {
 		options = append(options, credhub.SkipTLSValidation(true))
@@ -286,23 +699,19 @@ func (s Server) CreateCredhubCli() (cclient.CredhubClient, error) {
 	if caCert != "" {
 		options = append(options, credhub.CaCerts(caCert))
 	}
-	return credhub.New(apiEndpoint, options...)
+	client, err := credhub.New(apiEndpoint, options...)
+	if err != nil {
+		return nil, err
+	}
+	return cclient.NewClient(client), nil
 }
 
-func (s Server) panicRecover(w http.ResponseWriter) {
+func (s Server) panicRecover(w http.ResponseWriter, req *http.Request) {
 	err := recover()
 	if err == nil {
 		return
 	}
-	w.WriteHeader(http.StatusInternalServerError)
-	if s.config.ShowError {
-		w.Header().Set("Content-Type", "application/json")
-		errMsg := struct {
-			Status  int    `json:"status"`
-			Title   string `json:"title"`
-			Details string `json:"details"`
-		}{http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError), fmt.Sprint(err)}
-		b, _ := json.MarshalIndent(errMsg, "", "\t")
-		w.Write([]byte(b))
-	}
+	RequestLogger(req).Errorf("Recovered from panic: %v", err)
+	problem := NewProblem(http.StatusInternalServerError, "").WithCause(fmt.Errorf("%v", err))
+	NewProblemWriter(s.config.ShowError).Write(w, req, problem)
 }
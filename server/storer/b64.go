@@ -1,10 +1,10 @@
 package storer
 
 import (
+	"context"
 	"encoding/base64"
 	"fmt"
 	"io"
-	"io/ioutil"
 )
 
 type B64 struct {
@@ -15,6 +15,10 @@ func NewB64(next Storer) *B64 {
 	return &B64{next: next}
 }
 
+func (s B64) WithContext(ctx context.Context) Storer {
+	return NewB64(WithContext(s.next, ctx))
+}
+
 func (s B64) Store(path string, reader io.ReadCloser) error {
 	defer reader.Close()
 	pipeRead, pipeWrite := io.Pipe()
@@ -24,7 +28,7 @@ func (s B64) Store(path string, reader io.ReadCloser) error {
 		defer w.Close()
 		_, err := io.Copy(w, reader)
 		if err != nil {
-			panic(err)
+			pipeWrite.CloseWithError(err)
 		}
 	}()
 	return s.next.Store(path, pipeRead)
@@ -36,10 +40,29 @@ func (s B64) Retrieve(path string) (io.ReadCloser, error) {
 		return nil, fmt.Errorf("storer/b64: %s", err.Error())
 	}
 
-	r := base64.NewDecoder(base64.StdEncoding, origReader)
-	return ioutil.NopCloser(r), nil
+	return s.decode(origReader), nil
+}
+
+func (s B64) decode(origReader io.ReadCloser) io.ReadCloser {
+	return decodeReader{base64.NewDecoder(base64.StdEncoding, origReader), origReader}
 }
 
 func (s B64) Delete(path string) error {
 	return s.next.Delete(path)
 }
+
+func (s B64) Versions(path string) ([]Version, error) {
+	return s.next.Versions(path)
+}
+
+func (s B64) RetrieveVersion(path string, id string) (io.ReadCloser, error) {
+	origReader, err := s.next.RetrieveVersion(path, id)
+	if err != nil {
+		return nil, fmt.Errorf("storer/b64: %s", err.Error())
+	}
+	return s.decode(origReader), nil
+}
+
+func (s B64) Hash(path string) (string, error) {
+	return s.next.Hash(path)
+}
@@ -45,4 +45,19 @@ var _ = Describe("B64", func() {
 			Expect(storerRec.IsDeletedCall("foo")).To(BeTrue())
 		})
 	})
+	Context("RetrieveVersion", func() {
+		It("should give back reader with decoded data of the version", func() {
+			err := storer.Store("foo", Str2ReadCloser("bar"))
+			Expect(err).ToNot(HaveOccurred())
+			err = storer.Store("foo", Str2ReadCloser("baz"))
+			Expect(err).ToNot(HaveOccurred())
+			versions, err := storer.Versions("foo")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(versions).To(HaveLen(2))
+
+			r, err := storer.RetrieveVersion("foo", versions[1].ID)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(ReadCloserToBytes(r))).To(Equal("bar"))
+		})
+	})
 })
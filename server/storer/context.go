@@ -0,0 +1,19 @@
+package storer
+
+import (
+	"context"
+)
+
+// ContextBinder is implemented by storers which can be bound to a context,
+// operations made by a bound storer are traced as children of the span found in context
+type ContextBinder interface {
+	WithContext(ctx context.Context) Storer
+}
+
+// WithContext give storer bound to ctx, storer is given back unchanged if it can't be bound
+func WithContext(storer Storer, ctx context.Context) Storer {
+	if binder, ok := storer.(ContextBinder); ok {
+		return binder.WithContext(ctx)
+	}
+	return storer
+}
@@ -3,11 +3,13 @@ package storer
 import (
 	"bytes"
 	"code.cloudfoundry.org/credhub-cli/credhub/credentials/values"
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/orange-cloudfoundry/terraform-secure-backend/server/credhub"
 	"io"
 	"io/ioutil"
+	"strings"
 )
 
 type Credhub struct {
@@ -21,6 +23,10 @@ func NewCredhub(cclient credhub.CredhubClient) *Credhub {
 	}
 }
 
+func (s Credhub) WithContext(ctx context.Context) Storer {
+	return NewCredhub(credhub.WithContext(s.cclient, ctx))
+}
+
 func (s Credhub) Store(path string, reader io.ReadCloser) error {
 	defer reader.Close()
 	jDec := json.NewDecoder(reader)
@@ -38,16 +44,50 @@ func (s Credhub) Retrieve(path string) (io.ReadCloser, error) {
 	if err != nil {
 		return nil, fmt.Errorf("storer/credhub: %s", err.Error())
 	}
+	return s.encode(cred.Value)
+}
+
+func (s Credhub) encode(value interface{}) (io.ReadCloser, error) {
 	buf := &bytes.Buffer{}
 	jEnc := json.NewEncoder(buf)
-	err = jEnc.Encode(cred.Value)
+	err := jEnc.Encode(value)
 	if err != nil {
 		return nil, err
 	}
 	return ioutil.NopCloser(buf), nil
-
 }
 
 func (s Credhub) Delete(path string) error {
 	return s.cclient.Delete(path)
 }
+
+func (s Credhub) Versions(path string) ([]Version, error) {
+	creds, err := s.cclient.GetAllVersions(path)
+	if err != nil {
+		return nil, fmt.Errorf("storer/credhub: %s", err.Error())
+	}
+	versions := make([]Version, len(creds))
+	for i, cred := range creds {
+		versions[i] = Version{
+			ID:        cred.Id,
+			CreatedAt: cred.VersionCreatedAt,
+		}
+	}
+	return versions, nil
+}
+
+func (s Credhub) RetrieveVersion(path string, id string) (io.ReadCloser, error) {
+	cred, err := s.cclient.GetById(id)
+	if err != nil {
+		return nil, fmt.Errorf("storer/credhub: %s", err.Error())
+	}
+	if strings.TrimPrefix(cred.Name, "/") != strings.TrimPrefix(path, "/") {
+		return nil, fmt.Errorf("storer/credhub: version '%s' of '%s' does not exist", id, path)
+	}
+	return s.encode(cred.Value)
+}
+
+// Hash is not known by credhub storer, this is given by upper storer like Cutter which record it
+func (s Credhub) Hash(path string) (string, error) {
+	return "", nil
+}
@@ -1,6 +1,7 @@
 package storer_test
 
 import (
+	"code.cloudfoundry.org/credhub-cli/credhub/credentials"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	"github.com/orange-cloudfoundry/terraform-secure-backend/server/credhub/credhubfakes"
@@ -47,4 +48,40 @@ var _ = Describe("Credhub", func() {
 			Expect(fakeClient.DeleteCallCount()).Should(Equal(1))
 		})
 	})
+	Context("Versions", func() {
+		It("should give all versions of the credential", func() {
+			fakeClient.GetAllVersionsReturns([]credentials.Credential{
+				{Metadata: credentials.Metadata{Id: "2", Base: credentials.Base{Name: "/foo", VersionCreatedAt: "2019-01-02T00:00:00Z"}}},
+				{Metadata: credentials.Metadata{Id: "1", Base: credentials.Base{Name: "/foo", VersionCreatedAt: "2019-01-01T00:00:00Z"}}},
+			}, nil)
+
+			versions, err := storer.Versions("foo")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(versions).To(Equal([]Version{
+				{ID: "2", CreatedAt: "2019-01-02T00:00:00Z"},
+				{ID: "1", CreatedAt: "2019-01-01T00:00:00Z"},
+			}))
+		})
+	})
+	Context("RetrieveVersion", func() {
+		It("should give back the credential by its id", func() {
+			fakeClient.GetByIdReturns(credentials.Credential{
+				Metadata: credentials.Metadata{Id: "1", Base: credentials.Base{Name: "/foo"}},
+				Value:    map[string]interface{}{"foo": "bar"},
+			}, nil)
+
+			r, err := storer.RetrieveVersion("foo", "1")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(ReadCloserToBytes(r))).To(MatchJSON(`{"foo": "bar"}`))
+			Expect(fakeClient.GetByIdArgsForCall(0)).To(Equal("1"))
+		})
+		It("should return an error if id is a version of another credential", func() {
+			fakeClient.GetByIdReturns(credentials.Credential{
+				Metadata: credentials.Metadata{Id: "1", Base: credentials.Base{Name: "/bar"}},
+			}, nil)
+
+			_, err := storer.RetrieveVersion("foo", "1")
+			Expect(err).To(HaveOccurred())
+		})
+	})
 })
@@ -2,41 +2,77 @@ package storer
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
+	"github.com/orange-cloudfoundry/terraform-secure-backend/server/metrics"
+	"github.com/orange-cloudfoundry/terraform-secure-backend/server/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"io"
 	"io/ioutil"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type Cutter struct {
 	next      Storer
 	chunkSize int64
+	ctx       context.Context
 }
 
 type Index struct {
-	NumParts int `json:"num-parts"`
+	NumParts   int    `json:"num-parts"`
+	Generation string `json:"generation,omitempty"`
+	// Hash is the sha256 of all data stored in parts
+	Hash string `json:"hash,omitempty"`
 }
 
 type Part struct {
-	Part string `json:"part"`
+	Part       string `json:"part"`
+	Generation string `json:"generation,omitempty"`
 }
 
 func NewCutter(next Storer, chunkSize int64) *Cutter {
 	return &Cutter{
 		next:      next,
 		chunkSize: chunkSize,
+		ctx:       context.Background(),
 	}
 }
 
+func (s Cutter) WithContext(ctx context.Context) Storer {
+	return &Cutter{
+		next:      WithContext(s.next, ctx),
+		chunkSize: s.chunkSize,
+		ctx:       ctx,
+	}
+}
+
+// partStorer give next storer bound to a span created for a part operation
+func (s Cutter) partStorer(operation string, i int) (Storer, trace.Span) {
+	ctx, span := tracing.Start(s.ctx, "storer.cutter."+operation+"-part", attribute.Int("storer.part", i))
+	return WithContext(s.next, ctx), span
+}
+
+// Store write parts and then the index, index and parts written together share
+// the same generation to be able to find back which parts belong to an index version.
+// Index is only written when all parts has been written, if reader fails, index stays
+// on the previous generation and the stored state is left unchanged.
 func (s Cutter) Store(path string, reader io.ReadCloser) error {
 	defer reader.Close()
+	generation := strconv.FormatInt(time.Now().UnixNano(), 10)
+	hash := sha256.New()
+	tee := io.TeeReader(reader, hash)
 	i := 0
 	stop := false
 	for {
 		buf := &bytes.Buffer{}
-		buf.WriteString(`{ "part": "`)
-		written, err := io.CopyN(buf, reader, s.chunkSize)
+		buf.WriteString(`{ "generation": "` + generation + `", "part": "`)
+		written, err := io.CopyN(buf, tee, s.chunkSize)
 		if err != nil && err != io.EOF {
 			return err
 		}
@@ -49,7 +85,10 @@ func (s Cutter) Store(path string, reader io.ReadCloser) error {
 		}
 
 		buf.WriteString(`"}`)
-		err = s.next.Store(s.partPath(path, i), ioutil.NopCloser(buf))
+		next, span := s.partStorer("store", i)
+		span.SetAttributes(attribute.Int("storer.bytes", buf.Len()))
+		err = next.Store(s.partPath(path, i), ioutil.NopCloser(buf))
+		tracing.End(span, err)
 		if err != nil {
 			return err
 		}
@@ -59,9 +98,18 @@ func (s Cutter) Store(path string, reader io.ReadCloser) error {
 		i++
 	}
 	buf := &bytes.Buffer{}
-	b, _ := json.Marshal(Index{i + 1})
+	b, _ := json.Marshal(Index{
+		NumParts:   i + 1,
+		Generation: generation,
+		Hash:       fmt.Sprintf("%x", hash.Sum(nil)),
+	})
 	buf.Write(b)
-	return s.next.Store(s.indexPath(path), ioutil.NopCloser(buf))
+	err := s.next.Store(s.indexPath(path), ioutil.NopCloser(buf))
+	if err != nil {
+		return err
+	}
+	metrics.StoredChunks.Observe(float64(i + 1))
+	return nil
 }
 
 func (s Cutter) Retrieve(path string) (io.ReadCloser, error) {
@@ -69,38 +117,75 @@ func (s Cutter) Retrieve(path string) (io.ReadCloser, error) {
 	if err != nil {
 		return nil, fmt.Errorf("storer/cutter: %s", err.Error())
 	}
-	jDec := json.NewDecoder(rIndex)
-	var index Index
-	err = jDec.Decode(&index)
+	index, err := s.decodeIndex(rIndex)
 	if err != nil {
 		return nil, fmt.Errorf("storer/cutter: %s", err.Error())
 	}
+	return s.assemble(index, func(i int) (part Part, err error) {
+		partPath := s.partPath(path, i)
+		next, span := s.partStorer("retrieve", i)
+		defer func() {
+			span.SetAttributes(attribute.Int("storer.bytes", len(part.Part)))
+			tracing.End(span, err)
+		}()
+		r, err := next.Retrieve(partPath)
+		if err != nil {
+			return Part{}, err
+		}
+		part, err = s.decodePart(r)
+		if err != nil || index.Generation == "" || part.Generation == index.Generation {
+			return part, err
+		}
+		// latest part was written by a store which never wrote its index,
+		// part belonging to this index must be found in older versions
+		return s.partVersion(next, partPath, time.Now(), index.Generation)
+	}), nil
+}
+
+func (s Cutter) Hash(path string) (string, error) {
+	rIndex, err := s.next.Retrieve(s.indexPath(path))
+	if err != nil {
+		return "", fmt.Errorf("storer/cutter: %s", err.Error())
+	}
+	index, err := s.decodeIndex(rIndex)
+	if err != nil {
+		return "", fmt.Errorf("storer/cutter: %s", err.Error())
+	}
+	return index.Hash, nil
+}
+
+func (s Cutter) decodeIndex(r io.ReadCloser) (Index, error) {
+	defer r.Close()
+	var index Index
+	err := json.NewDecoder(r).Decode(&index)
+	return index, err
+}
+
+func (s Cutter) decodePart(r io.ReadCloser) (Part, error) {
+	defer r.Close()
+	var part Part
+	err := json.NewDecoder(r).Decode(&part)
+	return part, err
+}
+
+func (s Cutter) assemble(index Index, retrievePart func(i int) (Part, error)) io.ReadCloser {
 	piper, pipew := io.Pipe()
 	go func() {
 		defer pipew.Close()
 		for i := 0; i < index.NumParts; i++ {
-			r, err := s.next.Retrieve(s.partPath(path, i))
-			if err != nil {
-				r.Close()
-				panic(err)
-			}
-			jDec := json.NewDecoder(r)
-			var part Part
-			err = jDec.Decode(&part)
+			part, err := retrievePart(i)
 			if err != nil {
-				r.Close()
-				panic(err)
+				pipew.CloseWithError(err)
+				return
 			}
 			_, err = io.WriteString(pipew, part.Part)
 			if err != nil {
-				r.Close()
-				panic(err)
+				return
 			}
-			r.Close()
 		}
 	}()
 
-	return piper, nil
+	return piper
 }
 
 func (s Cutter) Delete(path string) error {
@@ -137,3 +222,93 @@ func (s Cutter) partPath(path string, index int) string {
 func (s Cutter) indexPath(path string) string {
 	return fmt.Sprintf("%s/index", path)
 }
+
+func (s Cutter) Versions(path string) ([]Version, error) {
+	return s.next.Versions(s.indexPath(path))
+}
+
+// RetrieveVersion rebuild a state as it was when the given index version was written.
+// For each part, the version taken is the one sharing the generation of the index version,
+// when index has no generation (written by an older backend) the newest part version
+// created before the index version is taken as parts are always written before their index.
+func (s Cutter) RetrieveVersion(path string, id string) (io.ReadCloser, error) {
+	indexVersions, err := s.next.Versions(s.indexPath(path))
+	if err != nil {
+		return nil, fmt.Errorf("storer/cutter: %s", err.Error())
+	}
+	var indexVersion *Version
+	for _, version := range indexVersions {
+		if version.ID == id {
+			indexVersion = &version
+			break
+		}
+	}
+	if indexVersion == nil {
+		return nil, fmt.Errorf("storer/cutter: version '%s' of '%s' does not exist", id, path)
+	}
+	indexCreatedAt, err := time.Parse(time.RFC3339, indexVersion.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("storer/cutter: %s", err.Error())
+	}
+	rIndex, err := s.next.RetrieveVersion(s.indexPath(path), id)
+	if err != nil {
+		return nil, fmt.Errorf("storer/cutter: %s", err.Error())
+	}
+	index, err := s.decodeIndex(rIndex)
+	if err != nil {
+		return nil, fmt.Errorf("storer/cutter: %s", err.Error())
+	}
+	return s.assemble(index, func(i int) (part Part, err error) {
+		next, span := s.partStorer("retrieve-version", i)
+		defer func() {
+			span.SetAttributes(attribute.Int("storer.bytes", len(part.Part)))
+			tracing.End(span, err)
+		}()
+		return s.partVersion(next, s.partPath(path, i), indexCreatedAt, index.Generation)
+	}), nil
+}
+
+// partVersion look at part versions from the newest created before the index to the oldest,
+// then at the ones created after it, and give the first one matching the generation
+func (s Cutter) partVersion(next Storer, path string, indexCreatedAt time.Time, generation string) (Part, error) {
+	versions, err := next.Versions(path)
+	if err != nil {
+		return Part{}, err
+	}
+	createdAts := make(map[string]time.Time)
+	for _, version := range versions {
+		createdAt, err := time.Parse(time.RFC3339, version.CreatedAt)
+		if err != nil {
+			return Part{}, err
+		}
+		createdAts[version.ID] = createdAt
+	}
+	sort.SliceStable(versions, func(i, j int) bool {
+		ci, cj := createdAts[versions[i].ID], createdAts[versions[j].ID]
+		iBefore, jBefore := !ci.After(indexCreatedAt), !cj.After(indexCreatedAt)
+		if iBefore != jBefore {
+			return iBefore
+		}
+		if iBefore {
+			return ci.After(cj)
+		}
+		return ci.Before(cj)
+	})
+	for _, version := range versions {
+		if generation == "" && createdAts[version.ID].After(indexCreatedAt) {
+			break
+		}
+		r, err := next.RetrieveVersion(path, version.ID)
+		if err != nil {
+			return Part{}, err
+		}
+		part, err := s.decodePart(r)
+		if err != nil {
+			return Part{}, err
+		}
+		if part.Generation == generation || generation == "" {
+			return part, nil
+		}
+	}
+	return Part{}, fmt.Errorf("storer/cutter: no version of '%s' found for index written at %s", path, indexCreatedAt.Format(time.RFC3339))
+}
@@ -1,6 +1,9 @@
 package storer_test
 
 import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	. "github.com/orange-cloudfoundry/terraform-secure-backend/server/storer"
@@ -25,7 +28,28 @@ var _ = Describe("Cutter", func() {
 		})
 	})
 
+	Context("Hash", func() {
+		It("should give sha256 of stored data written in index", func() {
+			err := storer.Store("foo", Str2ReadCloser("012"))
+			Expect(err).ToNot(HaveOccurred())
+
+			hash, err := storer.Hash("foo")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(hash).To(Equal(fmt.Sprintf("%x", sha256.Sum256([]byte("012")))))
+			Expect(storerRec.RetrieveIndex("foo").Hash).To(Equal(hash))
+		})
+	})
 	Context("Retrieve", func() {
+		It("should give back data of the index generation when a store failed before writing index", func() {
+			err := storer.Store("foo", Str2ReadCloser("012"))
+			Expect(err).ToNot(HaveOccurred())
+			err = storer.Store("foo", ErrorAfterReadCloser("34", errors.New("fake error")))
+			Expect(err).To(HaveOccurred())
+
+			r, err := storer.Retrieve("foo")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(ReadCloserToBytes(r))).To(Equal("012"))
+		})
 		It("should give back reader with decoded data", func() {
 			err := storer.Store("foo", Str2ReadCloser("012"))
 			Expect(err).ToNot(HaveOccurred())
@@ -51,4 +75,58 @@ var _ = Describe("Cutter", func() {
 			Expect(storerRec.IsDeletedCall("foo/index")).To(BeTrue())
 		})
 	})
+	Context("Versions", func() {
+		It("should give versions of the index", func() {
+			err := storer.Store("foo", Str2ReadCloser("012"))
+			Expect(err).ToNot(HaveOccurred())
+			storerRec.Tick()
+			err = storer.Store("foo", Str2ReadCloser("34"))
+			Expect(err).ToNot(HaveOccurred())
+
+			versions, err := storer.Versions("foo")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(versions).To(HaveLen(2))
+			Expect(versions[0].ID).To(Equal("foo/index@1"))
+			Expect(versions[1].ID).To(Equal("foo/index@0"))
+		})
+	})
+	Context("RetrieveVersion", func() {
+		It("should rebuild data with parts written for this index version", func() {
+			err := storer.Store("foo", Str2ReadCloser("012"))
+			Expect(err).ToNot(HaveOccurred())
+			storerRec.Tick()
+			err = storer.Store("foo", Str2ReadCloser("34"))
+			Expect(err).ToNot(HaveOccurred())
+			versions, err := storer.Versions("foo")
+			Expect(err).ToNot(HaveOccurred())
+
+			r, err := storer.RetrieveVersion("foo", versions[1].ID)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(ReadCloserToBytes(r))).To(Equal("012"))
+
+			r, err = storer.RetrieveVersion("foo", versions[0].ID)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(ReadCloserToBytes(r))).To(Equal("34"))
+		})
+		It("should rebuild data with parts of the same generation when versions are written in the same second", func() {
+			err := storer.Store("foo", Str2ReadCloser("012"))
+			Expect(err).ToNot(HaveOccurred())
+			err = storer.Store("foo", Str2ReadCloser("34"))
+			Expect(err).ToNot(HaveOccurred())
+			versions, err := storer.Versions("foo")
+			Expect(err).ToNot(HaveOccurred())
+
+			r, err := storer.RetrieveVersion("foo", versions[1].ID)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(ReadCloserToBytes(r))).To(Equal("012"))
+		})
+		It("should return an error when version does not exist", func() {
+			err := storer.Store("foo", Str2ReadCloser("012"))
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = storer.RetrieveVersion("foo", "unknown")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("does not exist"))
+		})
+	})
 })
@@ -2,6 +2,7 @@ package storer
 
 import (
 	"compress/gzip"
+	"context"
 	"fmt"
 	"io"
 )
@@ -14,6 +15,10 @@ func NewGzip(next Storer) *Gzip {
 	return &Gzip{next: next}
 }
 
+func (s Gzip) WithContext(ctx context.Context) Storer {
+	return NewGzip(WithContext(s.next, ctx))
+}
+
 func (s Gzip) Store(path string, reader io.ReadCloser) error {
 	defer reader.Close()
 	pipeRead, pipeWrite := io.Pipe()
@@ -26,7 +31,7 @@ func (s Gzip) Store(path string, reader io.ReadCloser) error {
 		defer zw.Close()
 		_, err := io.Copy(zw, reader)
 		if err != nil {
-			panic(err)
+			pipeWrite.CloseWithError(err)
 		}
 	}()
 	return s.next.Store(path, pipeRead)
@@ -37,14 +42,34 @@ func (s Gzip) Retrieve(path string) (io.ReadCloser, error) {
 	if err != nil {
 		return nil, fmt.Errorf("storer/gzip: %s", err.Error())
 	}
+	return s.decode(origReader)
+}
+
+func (s Gzip) decode(origReader io.ReadCloser) (io.ReadCloser, error) {
 	zr, err := gzip.NewReader(origReader)
 	if err != nil {
+		origReader.Close()
 		return nil, fmt.Errorf("storer/gzip: %s", err.Error())
 	}
-
-	return zr, nil
+	return decodeReader{zr, origReader}, nil
 }
 
 func (s Gzip) Delete(path string) error {
 	return s.next.Delete(path)
 }
+
+func (s Gzip) Versions(path string) ([]Version, error) {
+	return s.next.Versions(path)
+}
+
+func (s Gzip) RetrieveVersion(path string, id string) (io.ReadCloser, error) {
+	origReader, err := s.next.RetrieveVersion(path, id)
+	if err != nil {
+		return nil, fmt.Errorf("storer/gzip: %s", err.Error())
+	}
+	return s.decode(origReader)
+}
+
+func (s Gzip) Hash(path string) (string, error) {
+	return s.next.Hash(path)
+}
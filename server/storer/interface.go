@@ -8,4 +8,32 @@ type Storer interface {
 	Store(path string, reader io.ReadCloser) error
 	Retrieve(path string) (io.ReadCloser, error)
 	Delete(path string) error
+	Versions(path string) ([]Version, error)
+	RetrieveVersion(path string, id string) (io.ReadCloser, error)
+	// Hash give a hash of latest stored data without retrieving it, empty if it's not known
+	Hash(path string) (string, error)
+}
+
+// Version identify a stored version of a path, versions are always given from the newest to the oldest
+type Version struct {
+	ID        string `json:"id"`
+	CreatedAt string `json:"created_at"`
+}
+
+// decodeReader read from a decoder and, when closed, close it and the reader it decodes from
+// as decoders like gzip or base64 ones never close the reader underneath
+type decodeReader struct {
+	io.Reader
+	origReader io.ReadCloser
+}
+
+func (r decodeReader) Close() error {
+	var err error
+	if closer, ok := r.Reader.(io.Closer); ok {
+		err = closer.Close()
+	}
+	if origErr := r.origReader.Close(); origErr != nil {
+		return origErr
+	}
+	return err
 }
@@ -0,0 +1,113 @@
+package storer
+
+import (
+	"context"
+	"github.com/orange-cloudfoundry/terraform-secure-backend/server/metrics"
+	"io"
+	"time"
+)
+
+// Metrics record duration of operations made by next storer layer and size of data it stores.
+// As data is streamed, duration of a retrieve is recorded when reader given back is closed.
+type Metrics struct {
+	next  Storer
+	layer string
+}
+
+func NewMetrics(next Storer, layer string) *Metrics {
+	return &Metrics{next: next, layer: layer}
+}
+
+func (s Metrics) WithContext(ctx context.Context) Storer {
+	return NewMetrics(WithContext(s.next, ctx), s.layer)
+}
+
+func (s Metrics) observe(operation string, start time.Time, err error) {
+	metrics.StorerDuration.WithLabelValues(s.layer, operation, metrics.Result(err)).Observe(metrics.Since(start))
+}
+
+func (s Metrics) Store(path string, reader io.ReadCloser) error {
+	start := time.Now()
+	counter := &countingReader{ReadCloser: reader}
+	err := s.next.Store(path, counter)
+	s.observe("store", start, err)
+	if err == nil {
+		metrics.StoredBytes.WithLabelValues(s.layer).Observe(float64(counter.size))
+	}
+	return err
+}
+
+func (s Metrics) Retrieve(path string) (io.ReadCloser, error) {
+	return s.retrieve("retrieve", func() (io.ReadCloser, error) {
+		return s.next.Retrieve(path)
+	})
+}
+
+func (s Metrics) RetrieveVersion(path string, id string) (io.ReadCloser, error) {
+	return s.retrieve("retrieve-version", func() (io.ReadCloser, error) {
+		return s.next.RetrieveVersion(path, id)
+	})
+}
+
+func (s Metrics) retrieve(operation string, retrieve func() (io.ReadCloser, error)) (io.ReadCloser, error) {
+	start := time.Now()
+	reader, err := retrieve()
+	if err != nil {
+		s.observe(operation, start, err)
+		return nil, err
+	}
+	return &countingReader{
+		ReadCloser: reader,
+		onClose: func(err error) {
+			s.observe(operation, start, err)
+		},
+	}, nil
+}
+
+func (s Metrics) Delete(path string) error {
+	start := time.Now()
+	err := s.next.Delete(path)
+	s.observe("delete", start, err)
+	return err
+}
+
+func (s Metrics) Versions(path string) ([]Version, error) {
+	start := time.Now()
+	versions, err := s.next.Versions(path)
+	s.observe("versions", start, err)
+	return versions, err
+}
+
+func (s Metrics) Hash(path string) (string, error) {
+	start := time.Now()
+	hash, err := s.next.Hash(path)
+	s.observe("hash", start, err)
+	return hash, err
+}
+
+// countingReader count bytes read and keep read error to give them when closed
+type countingReader struct {
+	io.ReadCloser
+	size    int64
+	err     error
+	onClose func(err error)
+	closed  bool
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.size += int64(n)
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+	return n, err
+}
+
+func (r *countingReader) Close() error {
+	err := r.ReadCloser.Close()
+	if !r.closed && r.onClose != nil {
+		r.closed = true
+		r.onClose(r.err)
+	}
+	return err
+}
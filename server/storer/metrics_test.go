@@ -0,0 +1,97 @@
+package storer_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/orange-cloudfoundry/terraform-secure-backend/server/storer"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var _ = Describe("Metrics", func() {
+	var storer Storer
+	BeforeEach(func() {
+		storer = NewMetrics(storerRec, "test")
+		storerRec.Reset()
+	})
+	// layerSampleSum give sum of observations made in histogram with name for a layer
+	layerSampleSum := func(name string, layer string, operation string) (uint64, float64) {
+		families, err := prometheus.DefaultGatherer.Gather()
+		Expect(err).ToNot(HaveOccurred())
+		for _, family := range families {
+			if family.GetName() != name {
+				continue
+			}
+		metricLoop:
+			for _, metric := range family.GetMetric() {
+				for _, label := range metric.GetLabel() {
+					if label.GetName() == "layer" && label.GetValue() != layer {
+						continue metricLoop
+					}
+					if label.GetName() == "operation" && label.GetValue() != operation {
+						continue metricLoop
+					}
+				}
+				return metric.GetHistogram().GetSampleCount(), metric.GetHistogram().GetSampleSum()
+			}
+		}
+		return 0, 0
+	}
+	sampleSum := func(name string, operation string) (uint64, float64) {
+		return layerSampleSum(name, "test", operation)
+	}
+
+	Context("Store", func() {
+		It("should let next storer store data and record its size", func() {
+			countBefore, sumBefore := sampleSum("terraform_secure_backend_storer_stored_bytes", "")
+			err := storer.Store("foo", Str2ReadCloser("bar"))
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(storerRec.RetrieveString("foo")).To(Equal("bar"))
+			count, sum := sampleSum("terraform_secure_backend_storer_stored_bytes", "")
+			Expect(count - countBefore).To(BeEquivalentTo(1))
+			Expect(sum - sumBefore).To(BeEquivalentTo(3))
+		})
+	})
+
+	Context("Retrieve", func() {
+		It("should record duration when reader is closed", func() {
+			storerRec.Store("foo", Str2ReadCloser("bar"))
+			countBefore, _ := sampleSum("terraform_secure_backend_storer_duration_seconds", "retrieve")
+
+			r, err := storer.Retrieve("foo")
+			Expect(err).ToNot(HaveOccurred())
+			count, _ := sampleSum("terraform_secure_backend_storer_duration_seconds", "retrieve")
+			Expect(count).To(Equal(countBefore))
+
+			Expect(string(ReadCloserToBytes(r))).To(Equal("bar"))
+			r.Close()
+			count, _ = sampleSum("terraform_secure_backend_storer_duration_seconds", "retrieve")
+			Expect(count - countBefore).To(BeEquivalentTo(1))
+		})
+		It("should record duration of all layers when reader of top layer is closed", func() {
+			layers := []string{"test-gzip", "test-b64", "test-cutter", "test-credhub"}
+			storer = NewMetrics(NewGzip(
+				NewMetrics(NewB64(
+					NewMetrics(NewCutter(
+						NewMetrics(storerRec, layers[3]),
+						2), layers[2]),
+				), layers[1]),
+			), layers[0])
+			err := storer.Store("foo", Str2ReadCloser("bar"))
+			Expect(err).ToNot(HaveOccurred())
+			countsBefore := make(map[string]uint64)
+			for _, layer := range layers {
+				countsBefore[layer], _ = layerSampleSum("terraform_secure_backend_storer_duration_seconds", layer, "retrieve")
+			}
+
+			r, err := storer.Retrieve("foo")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(ReadCloserToBytes(r))).To(Equal("bar"))
+			r.Close()
+			for _, layer := range layers {
+				count, _ := layerSampleSum("terraform_secure_backend_storer_duration_seconds", layer, "retrieve")
+				Expect(count-countsBefore[layer]).To(BeNumerically(">=", 1), layer)
+			}
+		})
+	})
+})
@@ -0,0 +1,74 @@
+package storer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/orange-cloudfoundry/terraform-secure-backend/server/tfstate"
+	"io"
+)
+
+// Redact is a read only storer which give back tfstates with sensitive attributes and outputs replaced by a placeholder
+type Redact struct {
+	next Storer
+}
+
+func NewRedact(next Storer) *Redact {
+	return &Redact{next: next}
+}
+
+func (s Redact) WithContext(ctx context.Context) Storer {
+	return NewRedact(WithContext(s.next, ctx))
+}
+
+func (s Redact) Store(path string, reader io.ReadCloser) error {
+	reader.Close()
+	return fmt.Errorf("storer/redact: redacted tfstate can't be stored")
+}
+
+func (s Redact) Retrieve(path string) (io.ReadCloser, error) {
+	origReader, err := s.next.Retrieve(path)
+	if err != nil {
+		return nil, fmt.Errorf("storer/redact: %s", err.Error())
+	}
+	return s.redact(origReader), nil
+}
+
+func (s Redact) redact(origReader io.ReadCloser) io.ReadCloser {
+	pipeRead, pipeWrite := io.Pipe()
+	go func() {
+		defer origReader.Close()
+		state, err := tfstate.Decode(origReader)
+		if err != nil {
+			pipeWrite.CloseWithError(fmt.Errorf("storer/redact: %s", err.Error()))
+			return
+		}
+		err = json.NewEncoder(pipeWrite).Encode(tfstate.Redact(state))
+		pipeWrite.CloseWithError(err)
+	}()
+	return pipeRead
+}
+
+func (s Redact) Delete(path string) error {
+	return fmt.Errorf("storer/redact: redacted tfstate can't be deleted")
+}
+
+func (s Redact) Versions(path string) ([]Version, error) {
+	return s.next.Versions(path)
+}
+
+func (s Redact) RetrieveVersion(path string, id string) (io.ReadCloser, error) {
+	origReader, err := s.next.RetrieveVersion(path, id)
+	if err != nil {
+		return nil, fmt.Errorf("storer/redact: %s", err.Error())
+	}
+	return s.redact(origReader), nil
+}
+
+func (s Redact) Hash(path string) (string, error) {
+	hash, err := s.next.Hash(path)
+	if err != nil || hash == "" {
+		return hash, err
+	}
+	return "redacted-" + hash, nil
+}
@@ -0,0 +1,46 @@
+package storer_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/orange-cloudfoundry/terraform-secure-backend/server/storer"
+)
+
+var _ = Describe("Redact", func() {
+	var storer Storer
+	state := `{"version": 4, "outputs": {"password": {"value": "secret", "sensitive": true}, "ip": {"value": "10.0.0.1"}}}`
+	BeforeEach(func() {
+		storer = NewRedact(storerRec)
+		storerRec.Reset()
+	})
+	Context("Store", func() {
+		It("should refuse to store", func() {
+			err := storer.Store("foo", Str2ReadCloser(state))
+			Expect(err).To(HaveOccurred())
+			Expect(storerRec.RetrieveString("foo")).To(BeEmpty())
+		})
+	})
+	Context("Retrieve", func() {
+		It("should give back valid json with sensitive values redacted", func() {
+			storerRec.Store("foo", Str2ReadCloser(state))
+			r, err := storer.Retrieve("foo")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ReadCloserToBytes(r)).To(MatchJSON(`{"version": 4, "outputs": {"password": {"value": "(sensitive value)", "sensitive": true}, "ip": {"value": "10.0.0.1"}}}`))
+		})
+		It("should give an error on reading when data is not json", func() {
+			storerRec.Store("foo", Str2ReadCloser("not json"))
+			r, err := storer.Retrieve("foo")
+			Expect(err).ToNot(HaveOccurred())
+			_, err = r.Read(make([]byte, 10))
+			Expect(err).To(HaveOccurred())
+		})
+	})
+	Context("Delete", func() {
+		It("should refuse to delete", func() {
+			storerRec.Store("foo", Str2ReadCloser(state))
+			err := storer.Delete("foo")
+			Expect(err).To(HaveOccurred())
+			Expect(storerRec.IsDeletedCall("foo")).To(BeFalse())
+		})
+	})
+})
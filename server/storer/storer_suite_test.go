@@ -2,11 +2,14 @@ package storer_test
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"encoding/json"
+	"fmt"
 	"github.com/orange-cloudfoundry/terraform-secure-backend/server/storer"
 	"io"
 	"io/ioutil"
 	"testing"
+	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -20,23 +23,65 @@ func TestStorer(t *testing.T) {
 var storerRec *StorerRecorder = &StorerRecorder{
 	buf:        make(map[string][]byte),
 	deleteCall: make(map[string]bool),
+	history:    make(map[string][]recordedVersion),
 }
 
 type StorerRecorder struct {
 	buf        map[string][]byte
 	deleteCall map[string]bool
+	history    map[string][]recordedVersion
+	clock      int64
+}
+
+type recordedVersion struct {
+	storer.Version
+	data []byte
 }
 
 func (s *StorerRecorder) Store(path string, reader io.ReadCloser) error {
 	b, _ := ioutil.ReadAll(reader)
 	s.buf[path] = b
+	s.history[path] = append(s.history[path], recordedVersion{
+		Version: storer.Version{
+			ID:        fmt.Sprintf("%s@%d", path, len(s.history[path])),
+			CreatedAt: time.Unix(s.clock, 0).UTC().Format(time.RFC3339),
+		},
+		data: b,
+	})
 	return nil
 }
 
+// Tick make next stored data being created one second later
+func (s *StorerRecorder) Tick() {
+	s.clock++
+}
+
+func (s *StorerRecorder) Versions(path string) ([]storer.Version, error) {
+	history := s.history[path]
+	versions := make([]storer.Version, len(history))
+	for i, recorded := range history {
+		versions[len(history)-1-i] = recorded.Version
+	}
+	return versions, nil
+}
+
+func (s *StorerRecorder) RetrieveVersion(path string, id string) (io.ReadCloser, error) {
+	for _, recorded := range s.history[path] {
+		if recorded.ID == id {
+			return ioutil.NopCloser(bytes.NewBuffer(recorded.data)), nil
+		}
+	}
+	return nil, fmt.Errorf("version '%s' does not exist", id)
+}
+
 func (s *StorerRecorder) Retrieve(path string) (io.ReadCloser, error) {
 	return ioutil.NopCloser(bytes.NewBuffer(s.buf[path])), nil
 }
 
+func (s *StorerRecorder) Hash(path string) (string, error) {
+	return fmt.Sprintf("%x", sha256.Sum256(s.buf[path])), nil
+}
+
 func (s *StorerRecorder) RetrieveString(path string) string {
 	return string(s.buf[path])
 }
@@ -60,6 +105,8 @@ func (s *StorerRecorder) RetrieveBytes(path string) []byte {
 func (s *StorerRecorder) Reset() {
 	s.buf = make(map[string][]byte)
 	s.deleteCall = make(map[string]bool)
+	s.history = make(map[string][]recordedVersion)
+	s.clock = 0
 }
 
 func (s *StorerRecorder) Delete(path string) error {
@@ -83,3 +130,16 @@ func ReadCloserToBytes(r io.ReadCloser) []byte {
 	b, _ := ioutil.ReadAll(r)
 	return b
 }
+
+// ErrorAfterReadCloser give a reader which return err after reading s
+func ErrorAfterReadCloser(s string, err error) io.ReadCloser {
+	return ioutil.NopCloser(io.MultiReader(bytes.NewBufferString(s), &errReader{err}))
+}
+
+type errReader struct {
+	err error
+}
+
+func (r *errReader) Read(p []byte) (int, error) {
+	return 0, r.err
+}
@@ -20,6 +20,19 @@ type FakeStorer struct {
 	deleteReturnsOnCall map[int]struct {
 		result1 error
 	}
+	HashStub        func(string) (string, error)
+	hashMutex       sync.RWMutex
+	hashArgsForCall []struct {
+		arg1 string
+	}
+	hashReturns struct {
+		result1 string
+		result2 error
+	}
+	hashReturnsOnCall map[int]struct {
+		result1 string
+		result2 error
+	}
 	RetrieveStub        func(string) (io.ReadCloser, error)
 	retrieveMutex       sync.RWMutex
 	retrieveArgsForCall []struct {
@@ -33,6 +46,20 @@ type FakeStorer struct {
 		result1 io.ReadCloser
 		result2 error
 	}
+	RetrieveVersionStub        func(string, string) (io.ReadCloser, error)
+	retrieveVersionMutex       sync.RWMutex
+	retrieveVersionArgsForCall []struct {
+		arg1 string
+		arg2 string
+	}
+	retrieveVersionReturns struct {
+		result1 io.ReadCloser
+		result2 error
+	}
+	retrieveVersionReturnsOnCall map[int]struct {
+		result1 io.ReadCloser
+		result2 error
+	}
 	StoreStub        func(string, io.ReadCloser) error
 	storeMutex       sync.RWMutex
 	storeArgsForCall []struct {
@@ -45,6 +72,19 @@ type FakeStorer struct {
 	storeReturnsOnCall map[int]struct {
 		result1 error
 	}
+	VersionsStub        func(string) ([]storer.Version, error)
+	versionsMutex       sync.RWMutex
+	versionsArgsForCall []struct {
+		arg1 string
+	}
+	versionsReturns struct {
+		result1 []storer.Version
+		result2 error
+	}
+	versionsReturnsOnCall map[int]struct {
+		result1 []storer.Version
+		result2 error
+	}
 	invocations      map[string][][]interface{}
 	invocationsMutex sync.RWMutex
 }
@@ -55,15 +95,16 @@ func (fake *FakeStorer) Delete(arg1 string) error {
 	fake.deleteArgsForCall = append(fake.deleteArgsForCall, struct {
 		arg1 string
 	}{arg1})
+	stub := fake.DeleteStub
+	fakeReturns := fake.deleteReturns
 	fake.recordInvocation("Delete", []interface{}{arg1})
 	fake.deleteMutex.Unlock()
-	if fake.DeleteStub != nil {
-		return fake.DeleteStub(arg1)
+	if stub != nil {
+		return stub(arg1)
 	}
 	if specificReturn {
 		return ret.result1
 	}
-	fakeReturns := fake.deleteReturns
 	return fakeReturns.result1
 }
 
@@ -109,21 +150,86 @@ func (fake *FakeStorer) DeleteReturnsOnCall(i int, result1 error) {
 	}{result1}
 }
 
+func (fake *FakeStorer) Hash(arg1 string) (string, error) {
+	fake.hashMutex.Lock()
+	ret, specificReturn := fake.hashReturnsOnCall[len(fake.hashArgsForCall)]
+	fake.hashArgsForCall = append(fake.hashArgsForCall, struct {
+		arg1 string
+	}{arg1})
+	stub := fake.HashStub
+	fakeReturns := fake.hashReturns
+	fake.recordInvocation("Hash", []interface{}{arg1})
+	fake.hashMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeStorer) HashCallCount() int {
+	fake.hashMutex.RLock()
+	defer fake.hashMutex.RUnlock()
+	return len(fake.hashArgsForCall)
+}
+
+func (fake *FakeStorer) HashCalls(stub func(string) (string, error)) {
+	fake.hashMutex.Lock()
+	defer fake.hashMutex.Unlock()
+	fake.HashStub = stub
+}
+
+func (fake *FakeStorer) HashArgsForCall(i int) string {
+	fake.hashMutex.RLock()
+	defer fake.hashMutex.RUnlock()
+	argsForCall := fake.hashArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeStorer) HashReturns(result1 string, result2 error) {
+	fake.hashMutex.Lock()
+	defer fake.hashMutex.Unlock()
+	fake.HashStub = nil
+	fake.hashReturns = struct {
+		result1 string
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeStorer) HashReturnsOnCall(i int, result1 string, result2 error) {
+	fake.hashMutex.Lock()
+	defer fake.hashMutex.Unlock()
+	fake.HashStub = nil
+	if fake.hashReturnsOnCall == nil {
+		fake.hashReturnsOnCall = make(map[int]struct {
+			result1 string
+			result2 error
+		})
+	}
+	fake.hashReturnsOnCall[i] = struct {
+		result1 string
+		result2 error
+	}{result1, result2}
+}
+
 func (fake *FakeStorer) Retrieve(arg1 string) (io.ReadCloser, error) {
 	fake.retrieveMutex.Lock()
 	ret, specificReturn := fake.retrieveReturnsOnCall[len(fake.retrieveArgsForCall)]
 	fake.retrieveArgsForCall = append(fake.retrieveArgsForCall, struct {
 		arg1 string
 	}{arg1})
+	stub := fake.RetrieveStub
+	fakeReturns := fake.retrieveReturns
 	fake.recordInvocation("Retrieve", []interface{}{arg1})
 	fake.retrieveMutex.Unlock()
-	if fake.RetrieveStub != nil {
-		return fake.RetrieveStub(arg1)
+	if stub != nil {
+		return stub(arg1)
 	}
 	if specificReturn {
 		return ret.result1, ret.result2
 	}
-	fakeReturns := fake.retrieveReturns
 	return fakeReturns.result1, fakeReturns.result2
 }
 
@@ -172,6 +278,71 @@ func (fake *FakeStorer) RetrieveReturnsOnCall(i int, result1 io.ReadCloser, resu
 	}{result1, result2}
 }
 
+func (fake *FakeStorer) RetrieveVersion(arg1 string, arg2 string) (io.ReadCloser, error) {
+	fake.retrieveVersionMutex.Lock()
+	ret, specificReturn := fake.retrieveVersionReturnsOnCall[len(fake.retrieveVersionArgsForCall)]
+	fake.retrieveVersionArgsForCall = append(fake.retrieveVersionArgsForCall, struct {
+		arg1 string
+		arg2 string
+	}{arg1, arg2})
+	stub := fake.RetrieveVersionStub
+	fakeReturns := fake.retrieveVersionReturns
+	fake.recordInvocation("RetrieveVersion", []interface{}{arg1, arg2})
+	fake.retrieveVersionMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeStorer) RetrieveVersionCallCount() int {
+	fake.retrieveVersionMutex.RLock()
+	defer fake.retrieveVersionMutex.RUnlock()
+	return len(fake.retrieveVersionArgsForCall)
+}
+
+func (fake *FakeStorer) RetrieveVersionCalls(stub func(string, string) (io.ReadCloser, error)) {
+	fake.retrieveVersionMutex.Lock()
+	defer fake.retrieveVersionMutex.Unlock()
+	fake.RetrieveVersionStub = stub
+}
+
+func (fake *FakeStorer) RetrieveVersionArgsForCall(i int) (string, string) {
+	fake.retrieveVersionMutex.RLock()
+	defer fake.retrieveVersionMutex.RUnlock()
+	argsForCall := fake.retrieveVersionArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeStorer) RetrieveVersionReturns(result1 io.ReadCloser, result2 error) {
+	fake.retrieveVersionMutex.Lock()
+	defer fake.retrieveVersionMutex.Unlock()
+	fake.RetrieveVersionStub = nil
+	fake.retrieveVersionReturns = struct {
+		result1 io.ReadCloser
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeStorer) RetrieveVersionReturnsOnCall(i int, result1 io.ReadCloser, result2 error) {
+	fake.retrieveVersionMutex.Lock()
+	defer fake.retrieveVersionMutex.Unlock()
+	fake.RetrieveVersionStub = nil
+	if fake.retrieveVersionReturnsOnCall == nil {
+		fake.retrieveVersionReturnsOnCall = make(map[int]struct {
+			result1 io.ReadCloser
+			result2 error
+		})
+	}
+	fake.retrieveVersionReturnsOnCall[i] = struct {
+		result1 io.ReadCloser
+		result2 error
+	}{result1, result2}
+}
+
 func (fake *FakeStorer) Store(arg1 string, arg2 io.ReadCloser) error {
 	fake.storeMutex.Lock()
 	ret, specificReturn := fake.storeReturnsOnCall[len(fake.storeArgsForCall)]
@@ -179,15 +350,16 @@ func (fake *FakeStorer) Store(arg1 string, arg2 io.ReadCloser) error {
 		arg1 string
 		arg2 io.ReadCloser
 	}{arg1, arg2})
+	stub := fake.StoreStub
+	fakeReturns := fake.storeReturns
 	fake.recordInvocation("Store", []interface{}{arg1, arg2})
 	fake.storeMutex.Unlock()
-	if fake.StoreStub != nil {
-		return fake.StoreStub(arg1, arg2)
+	if stub != nil {
+		return stub(arg1, arg2)
 	}
 	if specificReturn {
 		return ret.result1
 	}
-	fakeReturns := fake.storeReturns
 	return fakeReturns.result1
 }
 
@@ -233,15 +405,85 @@ func (fake *FakeStorer) StoreReturnsOnCall(i int, result1 error) {
 	}{result1}
 }
 
+func (fake *FakeStorer) Versions(arg1 string) ([]storer.Version, error) {
+	fake.versionsMutex.Lock()
+	ret, specificReturn := fake.versionsReturnsOnCall[len(fake.versionsArgsForCall)]
+	fake.versionsArgsForCall = append(fake.versionsArgsForCall, struct {
+		arg1 string
+	}{arg1})
+	stub := fake.VersionsStub
+	fakeReturns := fake.versionsReturns
+	fake.recordInvocation("Versions", []interface{}{arg1})
+	fake.versionsMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeStorer) VersionsCallCount() int {
+	fake.versionsMutex.RLock()
+	defer fake.versionsMutex.RUnlock()
+	return len(fake.versionsArgsForCall)
+}
+
+func (fake *FakeStorer) VersionsCalls(stub func(string) ([]storer.Version, error)) {
+	fake.versionsMutex.Lock()
+	defer fake.versionsMutex.Unlock()
+	fake.VersionsStub = stub
+}
+
+func (fake *FakeStorer) VersionsArgsForCall(i int) string {
+	fake.versionsMutex.RLock()
+	defer fake.versionsMutex.RUnlock()
+	argsForCall := fake.versionsArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeStorer) VersionsReturns(result1 []storer.Version, result2 error) {
+	fake.versionsMutex.Lock()
+	defer fake.versionsMutex.Unlock()
+	fake.VersionsStub = nil
+	fake.versionsReturns = struct {
+		result1 []storer.Version
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeStorer) VersionsReturnsOnCall(i int, result1 []storer.Version, result2 error) {
+	fake.versionsMutex.Lock()
+	defer fake.versionsMutex.Unlock()
+	fake.VersionsStub = nil
+	if fake.versionsReturnsOnCall == nil {
+		fake.versionsReturnsOnCall = make(map[int]struct {
+			result1 []storer.Version
+			result2 error
+		})
+	}
+	fake.versionsReturnsOnCall[i] = struct {
+		result1 []storer.Version
+		result2 error
+	}{result1, result2}
+}
+
 func (fake *FakeStorer) Invocations() map[string][][]interface{} {
 	fake.invocationsMutex.RLock()
 	defer fake.invocationsMutex.RUnlock()
 	fake.deleteMutex.RLock()
 	defer fake.deleteMutex.RUnlock()
+	fake.hashMutex.RLock()
+	defer fake.hashMutex.RUnlock()
 	fake.retrieveMutex.RLock()
 	defer fake.retrieveMutex.RUnlock()
+	fake.retrieveVersionMutex.RLock()
+	defer fake.retrieveVersionMutex.RUnlock()
 	fake.storeMutex.RLock()
 	defer fake.storeMutex.RUnlock()
+	fake.versionsMutex.RLock()
+	defer fake.versionsMutex.RUnlock()
 	copiedInvocations := map[string][][]interface{}{}
 	for key, value := range fake.invocations {
 		copiedInvocations[key] = value
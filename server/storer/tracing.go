@@ -0,0 +1,89 @@
+package storer
+
+import (
+	"context"
+	"github.com/orange-cloudfoundry/terraform-secure-backend/server/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"io"
+)
+
+// Tracing create a span for each operation made by next storer layer,
+// as data is streamed, span of a retrieve ends when reader given back is closed.
+type Tracing struct {
+	next  Storer
+	layer string
+	ctx   context.Context
+}
+
+func NewTracing(next Storer, layer string) *Tracing {
+	return &Tracing{next: next, layer: layer, ctx: context.Background()}
+}
+
+func (s Tracing) WithContext(ctx context.Context) Storer {
+	return &Tracing{next: s.next, layer: s.layer, ctx: ctx}
+}
+
+func (s Tracing) start(operation, path string) (Storer, trace.Span) {
+	ctx, span := tracing.Start(s.ctx, "storer."+s.layer+"."+operation,
+		attribute.String("storer.layer", s.layer),
+		attribute.String("tfstate.path", path),
+	)
+	return WithContext(s.next, ctx), span
+}
+
+func (s Tracing) Store(path string, reader io.ReadCloser) error {
+	next, span := s.start("store", path)
+	counter := &countingReader{ReadCloser: reader}
+	err := next.Store(path, counter)
+	span.SetAttributes(attribute.Int64("storer.bytes", counter.size))
+	tracing.End(span, err)
+	return err
+}
+
+func (s Tracing) Retrieve(path string) (io.ReadCloser, error) {
+	next, span := s.start("retrieve", path)
+	reader, err := next.Retrieve(path)
+	return s.traceReader(span, reader, err)
+}
+
+func (s Tracing) RetrieveVersion(path string, id string) (io.ReadCloser, error) {
+	next, span := s.start("retrieve-version", path)
+	span.SetAttributes(attribute.String("storer.version", id))
+	reader, err := next.RetrieveVersion(path, id)
+	return s.traceReader(span, reader, err)
+}
+
+func (s Tracing) traceReader(span trace.Span, reader io.ReadCloser, err error) (io.ReadCloser, error) {
+	if err != nil {
+		tracing.End(span, err)
+		return nil, err
+	}
+	counter := &countingReader{ReadCloser: reader}
+	counter.onClose = func(err error) {
+		span.SetAttributes(attribute.Int64("storer.bytes", counter.size))
+		tracing.End(span, err)
+	}
+	return counter, nil
+}
+
+func (s Tracing) Delete(path string) error {
+	next, span := s.start("delete", path)
+	err := next.Delete(path)
+	tracing.End(span, err)
+	return err
+}
+
+func (s Tracing) Versions(path string) ([]Version, error) {
+	next, span := s.start("versions", path)
+	versions, err := next.Versions(path)
+	tracing.End(span, err)
+	return versions, err
+}
+
+func (s Tracing) Hash(path string) (string, error) {
+	next, span := s.start("hash", path)
+	hash, err := next.Hash(path)
+	tracing.End(span, err)
+	return hash, err
+}
@@ -0,0 +1,107 @@
+package storer_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/orange-cloudfoundry/terraform-secure-backend/server/storer"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+var _ = Describe("Tracing", func() {
+	var storer Storer
+	var recorder *tracetest.SpanRecorder
+	BeforeEach(func() {
+		recorder = tracetest.NewSpanRecorder()
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+		storer = NewTracing(NewCutter(NewTracing(storerRec, "credhub"), 2), "cutter")
+		storerRec.Reset()
+	})
+	AfterEach(func() {
+		otel.SetTracerProvider(sdktrace.NewTracerProvider())
+	})
+	spanByName := func(name string) sdktrace.ReadOnlySpan {
+		for _, span := range recorder.Ended() {
+			if span.Name() == name {
+				return span
+			}
+		}
+		return nil
+	}
+	attr := func(span sdktrace.ReadOnlySpan, key string) attribute.Value {
+		for _, kv := range span.Attributes() {
+			if string(kv.Key) == key {
+				return kv.Value
+			}
+		}
+		return attribute.Value{}
+	}
+
+	Context("Store", func() {
+		It("should create span for each layer and part as children of layer above", func() {
+			err := storer.Store("foo", Str2ReadCloser("bar"))
+			Expect(err).ToNot(HaveOccurred())
+
+			cutterSpan := spanByName("storer.cutter.store")
+			Expect(cutterSpan).ToNot(BeNil())
+			Expect(attr(cutterSpan, "storer.bytes").AsInt64()).To(BeEquivalentTo(3))
+			Expect(attr(cutterSpan, "tfstate.path").AsString()).To(Equal("foo"))
+
+			var partSpans []sdktrace.ReadOnlySpan
+			for _, span := range recorder.Ended() {
+				if span.Name() == "storer.cutter.store-part" {
+					partSpans = append(partSpans, span)
+				}
+			}
+			Expect(partSpans).To(HaveLen(2))
+			Expect(attr(partSpans[1], "storer.part").AsInt64()).To(BeEquivalentTo(1))
+			Expect(partSpans[0].Parent().SpanID()).To(Equal(cutterSpan.SpanContext().SpanID()))
+
+			for _, span := range recorder.Ended() {
+				if span.Name() == "storer.credhub.store" && attr(span, "tfstate.path").AsString() == "foo/0" {
+					Expect(span.Parent().SpanID()).To(Equal(partSpans[0].SpanContext().SpanID()))
+					return
+				}
+			}
+			Fail("no span found for storing first part")
+		})
+	})
+
+	Context("Retrieve", func() {
+		It("should end span when reader is closed", func() {
+			err := storer.Store("foo", Str2ReadCloser("bar"))
+			Expect(err).ToNot(HaveOccurred())
+
+			r, err := storer.Retrieve("foo")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(spanByName("storer.cutter.retrieve")).To(BeNil())
+
+			Expect(string(ReadCloserToBytes(r))).To(Equal("bar"))
+			r.Close()
+			span := spanByName("storer.cutter.retrieve")
+			Expect(span).ToNot(BeNil())
+			Expect(attr(span, "storer.bytes").AsInt64()).To(BeEquivalentTo(3))
+		})
+		It("should end span of every layer when reader of top layer is closed", func() {
+			storer = NewTracing(NewGzip(
+				NewTracing(NewB64(
+					NewTracing(NewCutter(
+						NewTracing(storerRec, "credhub"),
+						2), "cutter"),
+				), "b64"),
+			), "gzip")
+			err := storer.Store("foo", Str2ReadCloser("bar"))
+			Expect(err).ToNot(HaveOccurred())
+
+			r, err := storer.Retrieve("foo")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(ReadCloserToBytes(r))).To(Equal("bar"))
+			r.Close()
+			for _, layer := range []string{"gzip", "b64", "cutter", "credhub"} {
+				Expect(spanByName("storer."+layer+".retrieve")).ToNot(BeNil(), layer)
+			}
+		})
+	})
+})
@@ -0,0 +1,179 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/orange-cloudfoundry/terraform-secure-backend/server/auth"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+var tenantNameRegex = regexp.MustCompile("^[a-zA-Z0-9_-]+$")
+
+// TenantConfig describe a tenant served beside the main one, it has its own base path, credhub credentials and authentication.
+// When no credhub credentials are set, those of main config are used.
+type TenantConfig struct {
+	Name             string           `json:"name" yaml:"name"`
+	BasePath         string           `json:"base_path" yaml:"base_path"`
+	CredhubUsername  string           `json:"credhub_username" yaml:"credhub_username"`
+	CredhubPassword  string           `json:"credhub_password" yaml:"credhub_password"`
+	CredhubClient    string           `json:"credhub_client" yaml:"credhub_client"`
+	CredhubSecret    string           `json:"credhub_secret" yaml:"credhub_secret"`
+	Users            []auth.User      `json:"users" yaml:"users"`
+	UsersFile        string           `json:"users_file" yaml:"users_file"`
+	Policies         auth.Policies    `json:"policies" yaml:"policies"`
+	JWTIssuers       []auth.JWTIssuer `json:"jwt_issuers" yaml:"jwt_issuers"`
+	ProtectedStates  []string         `json:"protected_states" yaml:"protected_states"`
+	StatePermissions StatePermissions `json:"state_permissions" yaml:"state_permissions"`
+}
+
+func (c TenantConfig) hasCredhubCredentials() bool {
+	return c.CredhubUsername != "" || c.CredhubPassword != "" || c.CredhubClient != "" || c.CredhubSecret != ""
+}
+
+// ValidateTenants check tenants have a unique name and a base path which doesn't overlap base path of other tenants,
+// main base path included
+func ValidateTenants(mainBasePath string, tenants []TenantConfig) error {
+	basePaths := map[string]string{"": mainBasePath}
+	for _, tenant := range tenants {
+		if !tenantNameRegex.MatchString(tenant.Name) {
+			return fmt.Errorf("Invalid tenant name '%s': only letters, digits, '-' and '_' are allowed", tenant.Name)
+		}
+		if _, ok := basePaths[tenant.Name]; ok {
+			return fmt.Errorf("Tenant '%s' is defined more than once", tenant.Name)
+		}
+		if tenant.BasePath == "" {
+			return fmt.Errorf("Tenant '%s' must define a base_path", tenant.Name)
+		}
+		for name, basePath := range basePaths {
+			if overlapPaths(basePath, tenant.BasePath) {
+				if name == "" {
+					return fmt.Errorf("Base path of tenant '%s' overlaps main base_path", tenant.Name)
+				}
+				return fmt.Errorf("Base path of tenant '%s' overlaps base path of '%s'", tenant.Name, name)
+			}
+		}
+		basePaths[tenant.Name] = tenant.BasePath
+	}
+	return nil
+}
+
+func overlapPaths(p1, p2 string) bool {
+	p1 = "/" + strings.Trim(p1, "/") + "/"
+	p2 = "/" + strings.Trim(p2, "/") + "/"
+	return strings.HasPrefix(p1, p2) || strings.HasPrefix(p2, p1)
+}
+
+// Tenant is a set of tfstates stored under its own base path, with its own controllers and authentication
+type Tenant struct {
+	Name                 string
+	basePath             string
+	controller           *ApiController
+	tokenController      *TokenController
+	protectionController *ProtectionController
+	authMiddleware       *AuthMiddleware
+}
+
+func NewTenant(name, basePath string, controller *ApiController, tokenController *TokenController, authMiddleware *AuthMiddleware) *Tenant {
+	return &Tenant{
+		Name:                 name,
+		basePath:             basePath,
+		controller:           controller.WithTenant(name),
+		tokenController:      tokenController,
+		protectionController: NewProtectionController(controller.protections),
+		authMiddleware:       authMiddleware,
+	}
+}
+
+type tenantKey struct{}
+
+func withTenant(ctx context.Context, tenant *Tenant) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+func tenantFromContext(ctx context.Context) *Tenant {
+	tenant, _ := ctx.Value(tenantKey{}).(*Tenant)
+	return tenant
+}
+
+// TenantMiddleware select tenant of a request by tenant name in url or, for urls without tenant, by identity of caller.
+// Caller is authenticated once: against tenant of url or against tenants until one knows it
+type TenantMiddleware struct {
+	main          *Tenant
+	tenants       []*Tenant
+	problemWriter *ProblemWriter
+}
+
+func NewTenantMiddleware(problemWriter *ProblemWriter, main *Tenant, tenants ...*Tenant) *TenantMiddleware {
+	return &TenantMiddleware{main, tenants, problemWriter}
+}
+
+// ByURL serve request with tenant named by `tenant` route variable
+func (m TenantMiddleware) ByURL(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		name := mux.Vars(req)["tenant"]
+		for _, tenant := range m.tenants {
+			if tenant.Name == name {
+				m.serve(tenant, next, w, req)
+				return
+			}
+		}
+		m.problemWriter.Write(w, req, NewProblem(http.StatusNotFound, "Tenant does not exist"))
+	})
+}
+
+// Main serve request with main tenant whatever the caller
+func (m TenantMiddleware) Main(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		m.serve(m.main, next, w, req)
+	})
+}
+
+// ByIdentity serve request with tenant of caller, it is used for urls without tenant:
+// caller is served by the first tenant, main first, which authenticates it and is refused when none does
+func (m TenantMiddleware) ByIdentity(next http.Handler) http.Handler {
+	if len(m.tenants) == 0 {
+		return m.Main(next)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		keys := m.main.authMiddleware.failureKeys(req)
+		if m.main.authMiddleware.refuseLocked(w, req, keys) {
+			return
+		}
+		tenant, identity, err := m.identify(req)
+		if identity == nil {
+			m.main.authMiddleware.refuse(w, req, keys, err)
+			return
+		}
+		if tenant.Name != "" {
+			RequestLogger(req).Debugf("Request served by tenant '%s'", tenant.Name)
+		}
+		req = req.WithContext(withTenant(req.Context(), tenant))
+		tenant.authMiddleware.serveIdentity(identity, tenant.authMiddleware.failureKeys(req), next, w, req)
+	})
+}
+
+// identify give first tenant, main first, which authenticates caller with its identity,
+// when no tenant does the error given by main tenant is returned
+func (m TenantMiddleware) identify(req *http.Request) (*Tenant, *auth.Identity, error) {
+	var mainErr error
+	for i, tenant := range append([]*Tenant{m.main}, m.tenants...) {
+		identity, err := tenant.authMiddleware.authenticate(req)
+		if err == nil && identity != nil {
+			return tenant, identity, nil
+		}
+		if i == 0 {
+			mainErr = err
+		}
+	}
+	return nil, nil, mainErr
+}
+
+func (m TenantMiddleware) serve(tenant *Tenant, next http.Handler, w http.ResponseWriter, req *http.Request) {
+	if tenant.Name != "" {
+		RequestLogger(req).Debugf("Request served by tenant '%s'", tenant.Name)
+	}
+	tenant.authMiddleware.Middleware(next).ServeHTTP(w, req.WithContext(withTenant(req.Context(), tenant)))
+}
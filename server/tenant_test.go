@@ -0,0 +1,119 @@
+package server_test
+
+import (
+	"github.com/gorilla/mux"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/orange-cloudfoundry/terraform-secure-backend/server"
+	"github.com/orange-cloudfoundry/terraform-secure-backend/server/auth"
+	"golang.org/x/crypto/bcrypt"
+	"net/http"
+	"net/http/httptest"
+)
+
+var _ = Describe("Tenant", func() {
+	Context("ValidateTenants", func() {
+		It("should accept tenants with distinct names and base paths", func() {
+			err := ValidateTenants("/terraform/main", []TenantConfig{
+				{Name: "team-a", BasePath: "/terraform/team-a"},
+				{Name: "team_b", BasePath: "/terraform/team-b"},
+			})
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+		It("should refuse invalid or duplicated names", func() {
+			Expect(ValidateTenants("/main", []TenantConfig{{Name: "team/a", BasePath: "/a"}})).Should(HaveOccurred())
+			Expect(ValidateTenants("/main", []TenantConfig{{Name: "", BasePath: "/a"}})).Should(HaveOccurred())
+			Expect(ValidateTenants("/main", []TenantConfig{
+				{Name: "a", BasePath: "/a"},
+				{Name: "a", BasePath: "/b"},
+			})).Should(HaveOccurred())
+		})
+		It("should refuse tenants without base path or with overlapping base path", func() {
+			Expect(ValidateTenants("/main", []TenantConfig{{Name: "a"}})).Should(HaveOccurred())
+			Expect(ValidateTenants("/main", []TenantConfig{{Name: "a", BasePath: "/main/a"}})).Should(HaveOccurred())
+			Expect(ValidateTenants("/terraform/main", []TenantConfig{{Name: "a", BasePath: "/terraform"}})).Should(HaveOccurred())
+			Expect(ValidateTenants("/main", []TenantConfig{
+				{Name: "a", BasePath: "/a"},
+				{Name: "b", BasePath: "/a/"},
+			})).Should(HaveOccurred())
+			Expect(ValidateTenants("/main", []TenantConfig{{Name: "a", BasePath: "/mainly"}})).ShouldNot(HaveOccurred())
+		})
+	})
+	Context("TenantMiddleware", func() {
+		var identity *auth.Identity
+		var rtr *mux.Router
+		var authentications map[string]int
+		newTenant := func(name, username string) *Tenant {
+			hash, _ := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+			authenticator, err := auth.NewBasicAuthenticator([]auth.User{{Username: username, Password: string(hash)}}, auth.Policies{
+				{Users: []string{username}, States: []string{"*"}, Rights: []string{auth.RightWrite}},
+			})
+			Expect(err).ShouldNot(HaveOccurred())
+			counter := authenticatorFunc(func(req *http.Request) (*auth.Identity, error) {
+				authentications[name]++
+				return authenticator.Authenticate(req)
+			})
+			controller := NewApiController("/"+name, nil, nil, nil, nil, nil)
+			return NewTenant(name, "/"+name, controller, nil, NewAuthMiddleware(NewProblemWriter(false), counter))
+		}
+		serve := func(url, username string) int {
+			identity = nil
+			responseRecorder := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", url, nil)
+			req.SetBasicAuth(username, "password")
+			rtr.ServeHTTP(responseRecorder, req)
+			return responseRecorder.Code
+		}
+		BeforeEach(func() {
+			authentications = make(map[string]int)
+			middleware := NewTenantMiddleware(NewProblemWriter(false), newTenant("", "admin"), newTenant("team-a", "alice"), newTenant("team-b", "bob"))
+			next := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				identity = auth.FromContext(req.Context())
+			})
+			rtr = mux.NewRouter()
+			tenantRtr := rtr.PathPrefix("/t/{tenant}").Subrouter()
+			tenantRtr.Handle("/states", next)
+			tenantRtr.Use(middleware.ByURL)
+			mainRtr := rtr.PathPrefix("/").Subrouter()
+			mainRtr.Handle("/states", next)
+			mainRtr.Use(middleware.ByIdentity)
+		})
+		It("should select tenant from url", func() {
+			Expect(serve("http://fakeurl.com/t/team-a/states", "alice")).Should(Equal(http.StatusOK))
+			Expect(identity.Name).Should(Equal("alice"))
+		})
+		It("should select tenant from identity when no tenant is given in url", func() {
+			Expect(serve("http://fakeurl.com/states", "bob")).Should(Equal(http.StatusOK))
+			Expect(identity.Name).Should(Equal("bob"))
+
+			Expect(serve("http://fakeurl.com/states", "admin")).Should(Equal(http.StatusOK))
+			Expect(identity.Name).Should(Equal("admin"))
+		})
+		It("should authenticate caller once", func() {
+			Expect(serve("http://fakeurl.com/states", "alice")).Should(Equal(http.StatusOK))
+			Expect(authentications).Should(Equal(map[string]int{"": 1, "team-a": 1}))
+
+			authentications = make(map[string]int)
+			Expect(serve("http://fakeurl.com/t/team-a/states", "alice")).Should(Equal(http.StatusOK))
+			Expect(authentications).Should(Equal(map[string]int{"team-a": 1}))
+		})
+		It("should refuse callers of a tenant on another tenant", func() {
+			Expect(serve("http://fakeurl.com/t/team-b/states", "alice")).Should(Equal(http.StatusUnauthorized))
+			Expect(serve("http://fakeurl.com/t/team-a/states", "admin")).Should(Equal(http.StatusUnauthorized))
+			Expect(identity).Should(BeNil())
+		})
+		It("should refuse callers unknown by all tenants", func() {
+			Expect(serve("http://fakeurl.com/states", "mallory")).Should(Equal(http.StatusUnauthorized))
+			Expect(identity).Should(BeNil())
+		})
+		It("should answer with http code not found when tenant does not exist", func() {
+			Expect(serve("http://fakeurl.com/t/team-c/states", "alice")).Should(Equal(http.StatusNotFound))
+		})
+	})
+})
+
+type authenticatorFunc func(req *http.Request) (*auth.Identity, error)
+
+func (f authenticatorFunc) Authenticate(req *http.Request) (*auth.Identity, error) {
+	return f(req)
+}
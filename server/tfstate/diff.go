@@ -0,0 +1,145 @@
+package tfstate
+
+import (
+	"reflect"
+)
+
+type Diff struct {
+	Resources ResourcesDiff `json:"resources"`
+	Outputs   OutputsDiff   `json:"outputs"`
+}
+
+type ResourcesDiff struct {
+	Added   []string         `json:"added"`
+	Removed []string         `json:"removed"`
+	Changed []ResourceChange `json:"changed"`
+}
+
+type ResourceChange struct {
+	Address    string   `json:"address"`
+	Attributes []Change `json:"attributes"`
+}
+
+type OutputsDiff struct {
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+	Changed []Change `json:"changed"`
+}
+
+// Change describe an attribute or an output which has changed,
+// values are redacted when attribute or output is sensitive in one of the two states.
+// State version 3 doesn't tell which attributes are sensitive, so all its attribute values are redacted.
+type Change struct {
+	Name      string      `json:"name"`
+	Before    interface{} `json:"before"`
+	After     interface{} `json:"after"`
+	Sensitive bool        `json:"sensitive,omitempty"`
+}
+
+// Compare give what has changed in resources and outputs to go from state to another one
+func Compare(from, to State) Diff {
+	diff := Diff{
+		Resources: ResourcesDiff{
+			Added:   make([]string, 0),
+			Removed: make([]string, 0),
+			Changed: make([]ResourceChange, 0),
+		},
+		Outputs: OutputsDiff{
+			Added:   make([]string, 0),
+			Removed: make([]string, 0),
+			Changed: make([]Change, 0),
+		},
+	}
+
+	fromResources := from.Resources()
+	toResources := to.Resources()
+	redactAll := from.Version() < 4 || to.Version() < 4
+	addresses := make(map[string]bool)
+	for address := range fromResources {
+		addresses[address] = true
+	}
+	for address := range toResources {
+		addresses[address] = true
+	}
+	for _, address := range sortedKeys(addresses) {
+		fromResource, inFrom := fromResources[address]
+		toResource, inTo := toResources[address]
+		if !inFrom {
+			diff.Resources.Added = append(diff.Resources.Added, address)
+			continue
+		}
+		if !inTo {
+			diff.Resources.Removed = append(diff.Resources.Removed, address)
+			continue
+		}
+		changes := compareAttributes(fromResource, toResource, redactAll)
+		if len(changes) > 0 {
+			diff.Resources.Changed = append(diff.Resources.Changed, ResourceChange{
+				Address:    address,
+				Attributes: changes,
+			})
+		}
+	}
+
+	fromOutputs := from.Outputs()
+	toOutputs := to.Outputs()
+	names := make(map[string]bool)
+	for name := range fromOutputs {
+		names[name] = true
+	}
+	for name := range toOutputs {
+		names[name] = true
+	}
+	for _, name := range sortedKeys(names) {
+		fromOutput, inFrom := fromOutputs[name]
+		toOutput, inTo := toOutputs[name]
+		if !inFrom {
+			diff.Outputs.Added = append(diff.Outputs.Added, name)
+			continue
+		}
+		if !inTo {
+			diff.Outputs.Removed = append(diff.Outputs.Removed, name)
+			continue
+		}
+		if reflect.DeepEqual(fromOutput.Value, toOutput.Value) {
+			continue
+		}
+		diff.Outputs.Changed = append(diff.Outputs.Changed, newChange(
+			name, fromOutput.Value, toOutput.Value, fromOutput.Sensitive || toOutput.Sensitive,
+		))
+	}
+	return diff
+}
+
+func compareAttributes(from, to Resource, redactAll bool) []Change {
+	keys := make(map[string]bool)
+	for key := range from.Attributes {
+		keys[key] = true
+	}
+	for key := range to.Attributes {
+		keys[key] = true
+	}
+	changes := make([]Change, 0)
+	for _, key := range sortedKeys(keys) {
+		before, inFrom := from.Attributes[key]
+		after, inTo := to.Attributes[key]
+		if inFrom && inTo && reflect.DeepEqual(before, after) {
+			continue
+		}
+		changes = append(changes, newChange(key, before, after, redactAll || from.IsSensitive(key) || to.IsSensitive(key)))
+	}
+	return changes
+}
+
+func newChange(name string, before, after interface{}, sensitive bool) Change {
+	if !sensitive {
+		return Change{Name: name, Before: before, After: after}
+	}
+	if before != nil {
+		before = RedactedValue
+	}
+	if after != nil {
+		after = RedactedValue
+	}
+	return Change{Name: name, Before: before, After: after, Sensitive: true}
+}
@@ -0,0 +1,177 @@
+package tfstate_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/orange-cloudfoundry/terraform-secure-backend/server/tfstate"
+)
+
+var _ = Describe("Diff", func() {
+	Context("Compare", func() {
+		It("should give added, removed and changed resources and outputs in state version 4", func() {
+			from := MustDecode(`{
+  "version": 4,
+  "outputs": {
+    "ip": {"value": "10.0.0.1", "type": "string"},
+    "password": {"value": "secret1", "type": "string", "sensitive": true},
+    "old": {"value": "foo", "type": "string"}
+  },
+  "resources": [
+    {
+      "mode": "managed", "type": "null_resource", "name": "foo",
+      "instances": [{"attributes": {"id": "1", "triggers": {"a": "b"}}, "sensitive_attributes": []}]
+    },
+    {
+      "mode": "managed", "type": "db", "name": "main",
+      "instances": [{
+        "attributes": {"id": "db", "size": 10, "password": "secret"},
+        "sensitive_attributes": [[{"type": "get_attr", "value": "password"}]]
+      }]
+    }
+  ]
+}`)
+			to := MustDecode(`{
+  "version": 4,
+  "outputs": {
+    "ip": {"value": "10.0.0.2", "type": "string"},
+    "password": {"value": "secret2", "type": "string", "sensitive": true},
+    "new": {"value": "bar", "type": "string"}
+  },
+  "resources": [
+    {
+      "mode": "managed", "type": "db", "name": "main",
+      "instances": [{
+        "attributes": {"id": "db", "size": 20, "password": "othersecret"},
+        "sensitive_attributes": [[{"type": "get_attr", "value": "password"}]]
+      }]
+    },
+    {
+      "module": "module.net", "mode": "data", "type": "net", "name": "subnet",
+      "instances": [{"index_key": 0, "attributes": {"id": "net"}}]
+    }
+  ]
+}`)
+
+			diff := Compare(from, to)
+
+			Expect(diff.Resources.Added).To(Equal([]string{"module.net.data.net.subnet[0]"}))
+			Expect(diff.Resources.Removed).To(Equal([]string{"null_resource.foo"}))
+			Expect(diff.Resources.Changed).To(HaveLen(1))
+			Expect(diff.Resources.Changed[0].Address).To(Equal("db.main"))
+			Expect(diff.Resources.Changed[0].Attributes).To(HaveLen(2))
+			Expect(diff.Resources.Changed[0].Attributes[0]).To(Equal(Change{
+				Name: "password", Before: RedactedValue, After: RedactedValue, Sensitive: true,
+			}))
+			Expect(diff.Resources.Changed[0].Attributes[1].Name).To(Equal("size"))
+			Expect(diff.Resources.Changed[0].Attributes[1].Sensitive).To(BeFalse())
+
+			Expect(diff.Outputs.Added).To(Equal([]string{"new"}))
+			Expect(diff.Outputs.Removed).To(Equal([]string{"old"}))
+			Expect(diff.Outputs.Changed).To(Equal([]Change{
+				{Name: "ip", Before: "10.0.0.1", After: "10.0.0.2"},
+				{Name: "password", Before: RedactedValue, After: RedactedValue, Sensitive: true},
+			}))
+		})
+		It("should redact nested sensitive attributes", func() {
+			from := MustDecode(`{
+  "version": 4,
+  "resources": [{
+    "mode": "managed", "type": "user", "name": "admin",
+    "instances": [{
+      "attributes": {"credentials": [{"login": "admin", "key": "k1"}]},
+      "sensitive_attributes": [[
+        {"type": "get_attr", "value": "credentials"},
+        {"type": "index", "value": {"value": 0, "type": "number"}},
+        {"type": "get_attr", "value": "key"}
+      ]]
+    }]
+  }]
+}`)
+			to := MustDecode(`{
+  "version": 4,
+  "resources": [{
+    "mode": "managed", "type": "user", "name": "admin",
+    "instances": [{
+      "attributes": {"credentials": [{"login": "root", "key": "k2"}]},
+      "sensitive_attributes": [[
+        {"type": "get_attr", "value": "credentials"},
+        {"type": "index", "value": {"value": 0, "type": "number"}},
+        {"type": "get_attr", "value": "key"}
+      ]]
+    }]
+  }]
+}`)
+
+			diff := Compare(from, to)
+
+			Expect(diff.Resources.Changed).To(HaveLen(1))
+			Expect(diff.Resources.Changed[0].Attributes).To(Equal([]Change{
+				{Name: "credentials.0.key", Before: RedactedValue, After: RedactedValue, Sensitive: true},
+				{Name: "credentials.0.login", Before: "admin", After: "root"},
+			}))
+		})
+		It("should understand state version 3 and redact all its attribute values", func() {
+			from := MustDecode(`{
+  "version": 3,
+  "modules": [{
+    "path": ["root"],
+    "outputs": {"token": {"sensitive": true, "type": "string", "value": "t1"}},
+    "resources": {"aws_instance.web": {"primary": {"id": "i-1", "attributes": {"id": "i-1", "ami": "a"}}}}
+  }]
+}`)
+			to := MustDecode(`{
+  "version": 3,
+  "modules": [{
+    "path": ["root"],
+    "outputs": {"token": {"sensitive": true, "type": "string", "value": "t2"}},
+    "resources": {"aws_instance.web": {"primary": {"id": "i-1", "attributes": {"id": "i-1", "ami": "b"}}}}
+  }, {
+    "path": ["root", "network"],
+    "outputs": {},
+    "resources": {"aws_vpc.main": {"primary": {"id": "vpc", "attributes": {"id": "vpc"}}}}
+  }]
+}`)
+
+			diff := Compare(from, to)
+
+			Expect(diff.Resources.Added).To(Equal([]string{"module.network.aws_vpc.main"}))
+			Expect(diff.Resources.Changed).To(Equal([]ResourceChange{
+				{Address: "aws_instance.web", Attributes: []Change{{Name: "ami", Before: RedactedValue, After: RedactedValue, Sensitive: true}}},
+			}))
+			Expect(diff.Outputs.Changed).To(Equal([]Change{
+				{Name: "token", Before: RedactedValue, After: RedactedValue, Sensitive: true},
+			}))
+		})
+		It("should redact attribute values when comparing a state version 3 with a state version 4", func() {
+			from := MustDecode(`{
+  "version": 3,
+  "modules": [{
+    "path": ["root"],
+    "resources": {"db.main": {"primary": {"id": "db", "attributes": {"id": "db", "password": "secret"}}}}
+  }]
+}`)
+			to := MustDecode(`{
+  "version": 4,
+  "resources": [{"mode": "managed", "type": "db", "name": "main", "instances": [{"attributes": {"id": "db", "password": "secret2"}}]}]
+}`)
+
+			diff := Compare(from, to)
+
+			Expect(diff.Resources.Changed).To(Equal([]ResourceChange{
+				{Address: "db.main", Attributes: []Change{{Name: "password", Before: RedactedValue, After: RedactedValue, Sensitive: true}}},
+			}))
+		})
+		It("should see everything as added when comparing from an empty state", func() {
+			to := MustDecode(`{
+  "version": 4,
+  "outputs": {"ip": {"value": "10.0.0.1", "type": "string"}},
+  "resources": [{"mode": "managed", "type": "null_resource", "name": "foo", "instances": [{"attributes": {"id": "1"}}]}]
+}`)
+
+			diff := Compare(State{}, to)
+
+			Expect(diff.Resources.Added).To(Equal([]string{"null_resource.foo"}))
+			Expect(diff.Outputs.Added).To(Equal([]string{"ip"}))
+		})
+	})
+})
@@ -0,0 +1,110 @@
+package tfstate
+
+import (
+	"encoding/json"
+	"strconv"
+)
+
+// Redact replace in state values of attributes marked in sensitive_attributes and outputs marked sensitive by RedactedValue,
+// state version 3 doesn't mark sensitive attributes so all attribute values but id are replaced
+func Redact(state State) State {
+	if state.Version() >= 4 {
+		for _, rawResource := range asSlice(state["resources"]) {
+			for _, rawInstance := range asSlice(asMap(rawResource)["instances"]) {
+				instance := asMap(rawInstance)
+				for _, path := range asSlice(instance["sensitive_attributes"]) {
+					redactPath(instance["attributes"], asSlice(path))
+				}
+			}
+		}
+		redactOutputs(asMap(state["outputs"]))
+		return state
+	}
+	for _, rawModule := range asSlice(state["modules"]) {
+		module := asMap(rawModule)
+		for _, rawResource := range asMap(module["resources"]) {
+			resource := asMap(rawResource)
+			redactInstance(asMap(resource["primary"]))
+			for _, rawDeposed := range asSlice(resource["deposed"]) {
+				redactInstance(asMap(rawDeposed))
+			}
+		}
+		redactOutputs(asMap(module["outputs"]))
+	}
+	return state
+}
+
+// redactInstance replace all attribute values but id of a resource instance in state version 3
+func redactInstance(instance map[string]interface{}) {
+	attributes := asMap(instance["attributes"])
+	for k := range attributes {
+		if k != "id" {
+			attributes[k] = RedactedValue
+		}
+	}
+}
+
+func redactOutputs(outputs map[string]interface{}) {
+	for _, rawOutput := range outputs {
+		output := asMap(rawOutput)
+		if output != nil && output["sensitive"] == true {
+			output["value"] = RedactedValue
+		}
+	}
+}
+
+// redactPath follow path inside value and replace what is targeted by RedactedValue
+func redactPath(value interface{}, path []interface{}) {
+	if len(path) == 0 {
+		return
+	}
+	step := asMap(path[0])
+	var key interface{}
+	switch asString(step["type"]) {
+	case "get_attr":
+		key = asString(step["value"])
+	case "index":
+		key = asMap(step["value"])["value"]
+	default:
+		return
+	}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		k, ok := key.(string)
+		if !ok {
+			return
+		}
+		if _, exists := v[k]; !exists {
+			return
+		}
+		if len(path) == 1 {
+			v[k] = RedactedValue
+			return
+		}
+		redactPath(v[k], path[1:])
+	case []interface{}:
+		i, ok := toIndex(key)
+		if !ok || i < 0 || i >= len(v) {
+			return
+		}
+		if len(path) == 1 {
+			v[i] = RedactedValue
+			return
+		}
+		redactPath(v[i], path[1:])
+	}
+}
+
+func toIndex(key interface{}) (int, bool) {
+	switch k := key.(type) {
+	case json.Number:
+		i, err := k.Int64()
+		return int(i), err == nil
+	case float64:
+		return int(k), true
+	case string:
+		i, err := strconv.Atoi(k)
+		return i, err == nil
+	}
+	return 0, false
+}
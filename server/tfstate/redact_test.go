@@ -0,0 +1,97 @@
+package tfstate_test
+
+import (
+	"encoding/json"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/orange-cloudfoundry/terraform-secure-backend/server/tfstate"
+)
+
+var _ = Describe("Redact", func() {
+	It("should replace sensitive attributes and outputs in state version 4", func() {
+		state := MustDecode(`{
+  "version": 4,
+  "outputs": {
+    "ip": {"value": "10.0.0.1", "type": "string"},
+    "password": {"value": "secret", "type": "string", "sensitive": true}
+  },
+  "resources": [{
+    "mode": "managed", "type": "user", "name": "admin",
+    "instances": [{
+      "attributes": {"name": "admin", "password": "secret", "keys": [{"id": "1", "value": "secret"}]},
+      "sensitive_attributes": [
+        [{"type": "get_attr", "value": "password"}],
+        [{"type": "get_attr", "value": "keys"}, {"type": "index", "value": {"value": 0, "type": "number"}}, {"type": "get_attr", "value": "value"}],
+        [{"type": "get_attr", "value": "unknown"}]
+      ]
+    }]
+  }]
+}`)
+
+		b, err := json.Marshal(Redact(state))
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(b).To(MatchJSON(`{
+  "version": 4,
+  "outputs": {
+    "ip": {"value": "10.0.0.1", "type": "string"},
+    "password": {"value": "(sensitive value)", "type": "string", "sensitive": true}
+  },
+  "resources": [{
+    "mode": "managed", "type": "user", "name": "admin",
+    "instances": [{
+      "attributes": {"name": "admin", "password": "(sensitive value)", "keys": [{"id": "1", "value": "(sensitive value)"}]},
+      "sensitive_attributes": [
+        [{"type": "get_attr", "value": "password"}],
+        [{"type": "get_attr", "value": "keys"}, {"type": "index", "value": {"value": 0, "type": "number"}}, {"type": "get_attr", "value": "value"}],
+        [{"type": "get_attr", "value": "unknown"}]
+      ]
+    }]
+  }]
+}`))
+	})
+	It("should replace all attribute values but id in state version 3", func() {
+		state := MustDecode(`{
+  "version": 3,
+  "modules": [{
+    "path": ["root"],
+    "outputs": {},
+    "resources": {"db.main": {
+      "primary": {"id": "db", "attributes": {"id": "db", "password": "secret", "size": "10"}},
+      "deposed": [{"id": "old", "attributes": {"id": "old", "password": "oldsecret"}}]
+    }}
+  }]
+}`)
+
+		b, err := json.Marshal(Redact(state))
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(b).To(MatchJSON(`{
+  "version": 3,
+  "modules": [{
+    "path": ["root"],
+    "outputs": {},
+    "resources": {"db.main": {
+      "primary": {"id": "db", "attributes": {"id": "db", "password": "(sensitive value)", "size": "(sensitive value)"}},
+      "deposed": [{"id": "old", "attributes": {"id": "old", "password": "(sensitive value)"}}]
+    }}
+  }]
+}`))
+	})
+	It("should replace sensitive outputs in state version 3", func() {
+		state := MustDecode(`{
+  "version": 3,
+  "modules": [{
+    "path": ["root"],
+    "outputs": {"token": {"sensitive": true, "type": "string", "value": "secret"}, "ip": {"sensitive": false, "type": "string", "value": "10.0.0.1"}},
+    "resources": {}
+  }]
+}`)
+
+		b, err := json.Marshal(Redact(state))
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(string(b)).ToNot(ContainSubstring("secret"))
+		Expect(string(b)).To(ContainSubstring("10.0.0.1"))
+	})
+})
@@ -0,0 +1,237 @@
+package tfstate
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// RedactedValue is the placeholder set in place of a sensitive value
+const RedactedValue = "(sensitive value)"
+
+// State is a terraform state file as decoded from json, both format version 3 (terraform < 0.12)
+// and version 4 are understood
+type State map[string]interface{}
+
+type Resource struct {
+	Address    string
+	Attributes map[string]interface{}
+	Sensitive  map[string]bool
+}
+
+type Output struct {
+	Name      string
+	Value     interface{}
+	Sensitive bool
+}
+
+func Decode(r io.Reader) (State, error) {
+	jDec := json.NewDecoder(r)
+	jDec.UseNumber()
+	var state State
+	err := jDec.Decode(&state)
+	if err != nil {
+		return nil, fmt.Errorf("tfstate: %s", err.Error())
+	}
+	if state == nil {
+		state = State{}
+	}
+	return state, nil
+}
+
+func (s State) Version() int {
+	switch v := s["version"].(type) {
+	case json.Number:
+		i, _ := v.Int64()
+		return int(i)
+	case float64:
+		return int(v)
+	}
+	return 0
+}
+
+// IsSensitive tell if the attribute, in its flatten form, is or belong to a sensitive attribute
+func (r Resource) IsSensitive(attr string) bool {
+	for sensitive := range r.Sensitive {
+		if attr == sensitive || strings.HasPrefix(attr, sensitive+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// Resources give all resources instances found in state indexed by their address
+func (s State) Resources() map[string]Resource {
+	if s.Version() < 4 {
+		return s.resourcesV3()
+	}
+	return s.resourcesV4()
+}
+
+func (s State) resourcesV4() map[string]Resource {
+	resources := make(map[string]Resource)
+	for _, rawResource := range asSlice(s["resources"]) {
+		resource := asMap(rawResource)
+		address := fmt.Sprintf("%s.%s", asString(resource["type"]), asString(resource["name"]))
+		if asString(resource["mode"]) == "data" {
+			address = "data." + address
+		}
+		if module := asString(resource["module"]); module != "" {
+			address = module + "." + address
+		}
+		for _, rawInstance := range asSlice(resource["instances"]) {
+			instance := asMap(rawInstance)
+			instanceAddress := address
+			switch key := instance["index_key"].(type) {
+			case string:
+				instanceAddress += fmt.Sprintf("[%q]", key)
+			case json.Number, float64:
+				instanceAddress += fmt.Sprintf("[%v]", key)
+			}
+			attributes := make(map[string]interface{})
+			flatten("", instance["attributes"], attributes)
+			sensitive := make(map[string]bool)
+			for _, path := range asSlice(instance["sensitive_attributes"]) {
+				sensitive[pathToKey(asSlice(path))] = true
+			}
+			resources[instanceAddress] = Resource{
+				Address:    instanceAddress,
+				Attributes: attributes,
+				Sensitive:  sensitive,
+			}
+		}
+	}
+	return resources
+}
+
+func (s State) resourcesV3() map[string]Resource {
+	resources := make(map[string]Resource)
+	for _, rawModule := range asSlice(s["modules"]) {
+		module := asMap(rawModule)
+		prefix := modulePrefix(module)
+		for name, rawResource := range asMap(module["resources"]) {
+			primary := asMap(asMap(rawResource)["primary"])
+			attributes := make(map[string]interface{})
+			for k, v := range asMap(primary["attributes"]) {
+				attributes[k] = v
+			}
+			address := prefix + name
+			resources[address] = Resource{
+				Address:    address,
+				Attributes: attributes,
+				Sensitive:  make(map[string]bool),
+			}
+		}
+	}
+	return resources
+}
+
+// Outputs give all outputs found in state indexed by their name
+func (s State) Outputs() map[string]Output {
+	outputs := make(map[string]Output)
+	if s.Version() >= 4 {
+		for name, rawOutput := range asMap(s["outputs"]) {
+			output := asMap(rawOutput)
+			outputs[name] = Output{
+				Name:      name,
+				Value:     output["value"],
+				Sensitive: output["sensitive"] == true,
+			}
+		}
+		return outputs
+	}
+	for _, rawModule := range asSlice(s["modules"]) {
+		module := asMap(rawModule)
+		prefix := modulePrefix(module)
+		for name, rawOutput := range asMap(module["outputs"]) {
+			output := asMap(rawOutput)
+			outputs[prefix+name] = Output{
+				Name:      prefix + name,
+				Value:     output["value"],
+				Sensitive: output["sensitive"] == true,
+			}
+		}
+	}
+	return outputs
+}
+
+func modulePrefix(module map[string]interface{}) string {
+	prefix := ""
+	for i, p := range asSlice(module["path"]) {
+		if i == 0 && p == "root" {
+			continue
+		}
+		prefix += "module." + asString(p) + "."
+	}
+	return prefix
+}
+
+// pathToKey convert a path from sensitive_attributes (list of get_attr and index steps) in its flatten form
+func pathToKey(path []interface{}) string {
+	keys := make([]string, 0, len(path))
+	for _, rawStep := range path {
+		step := asMap(rawStep)
+		switch asString(step["type"]) {
+		case "get_attr":
+			keys = append(keys, asString(step["value"]))
+		case "index":
+			keys = append(keys, fmt.Sprint(asMap(step["value"])["value"]))
+		}
+	}
+	return strings.Join(keys, ".")
+}
+
+func flatten(prefix string, value interface{}, result map[string]interface{}) {
+	join := func(key string) string {
+		if prefix == "" {
+			return key
+		}
+		return prefix + "." + key
+	}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if len(v) == 0 && prefix != "" {
+			result[prefix] = v
+		}
+		for key, elem := range v {
+			flatten(join(key), elem, result)
+		}
+	case []interface{}:
+		if len(v) == 0 && prefix != "" {
+			result[prefix] = v
+		}
+		for i, elem := range v {
+			flatten(join(fmt.Sprint(i)), elem, result)
+		}
+	default:
+		if prefix != "" {
+			result[prefix] = v
+		}
+	}
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func asMap(v interface{}) map[string]interface{} {
+	m, _ := v.(map[string]interface{})
+	return m
+}
+
+func asSlice(v interface{}) []interface{} {
+	s, _ := v.([]interface{})
+	return s
+}
+
+func asString(v interface{}) string {
+	s, _ := v.(string)
+	return s
+}
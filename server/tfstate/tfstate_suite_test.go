@@ -0,0 +1,21 @@
+package tfstate_test
+
+import (
+	"bytes"
+	"github.com/orange-cloudfoundry/terraform-secure-backend/server/tfstate"
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestTfstate(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Tfstate Suite")
+}
+
+func MustDecode(s string) tfstate.State {
+	state, err := tfstate.Decode(bytes.NewBufferString(s))
+	Expect(err).ToNot(HaveOccurred())
+	return state
+}
@@ -0,0 +1,368 @@
+package server
+
+import (
+	"code.cloudfoundry.org/credhub-cli/credhub/credentials/values"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/orange-cloudfoundry/terraform-secure-backend/server/auth"
+	"github.com/orange-cloudfoundry/terraform-secure-backend/server/credhub"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	TOKENS_PREFIX = "/.tokens"
+	// TokenPrefix start every api token, it lets them be recognized when sent as basic auth password
+	TokenPrefix = "tsb_"
+	// tokenCacheTTL is the time a token which authenticated a caller is kept without reading it again in credhub
+	tokenCacheTTL = 30 * time.Second
+)
+
+// ApiToken is a token created by an admin, it is stored in credhub at <base path>/.tokens/<id>
+// with the sha256 of the token, token itself is only given at creation
+type ApiToken struct {
+	Id        string     `json:"id"`
+	Name      string     `json:"name"`
+	Prefixes  []string   `json:"prefixes"`
+	Rights    []string   `json:"rights"`
+	CreatedAt time.Time  `json:"created_at"`
+	CreatedBy string     `json:"created_by,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Hash      string     `json:"hash,omitempty"`
+}
+
+func (t ApiToken) expired() bool {
+	return t.ExpiresAt != nil && time.Now().After(*t.ExpiresAt)
+}
+
+// grant give rights of token on tfstates starting with its prefixes
+func (t ApiToken) grant() auth.Grant {
+	globs := make([]string, len(t.Prefixes))
+	for i, prefix := range t.Prefixes {
+		globs[i] = prefix + "*"
+	}
+	return auth.Grant{States: globs, Rights: t.Rights}
+}
+
+// TokenStore keep api tokens in credhub and authenticate callers sending a token as basic auth password
+type TokenStore struct {
+	basePath      string
+	credhubClient credhub.CredhubClient
+	cache         *tokenCache
+}
+
+func NewTokenStore(basePath string, credhubClient credhub.CredhubClient) *TokenStore {
+	return &TokenStore{basePath, credhubClient, &tokenCache{entries: make(map[string]cachedToken)}}
+}
+
+func (s TokenStore) WithContext(ctx context.Context) *TokenStore {
+	return &TokenStore{s.basePath, credhub.WithContext(s.credhubClient, ctx), s.cache}
+}
+
+// tokenCache keep tokens which authenticated a caller during tokenCacheTTL to not read them in credhub on each request,
+// a token revoked on a backend stays in cache of other backends sharing credhub until it expires
+type tokenCache struct {
+	mu      sync.Mutex
+	entries map[string]cachedToken
+}
+
+type cachedToken struct {
+	token    ApiToken
+	cachedAt time.Time
+}
+
+func (c *tokenCache) get(id string) (ApiToken, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[id]
+	if !ok || time.Since(entry.cachedAt) >= tokenCacheTTL {
+		return ApiToken{}, false
+	}
+	return entry.token, true
+}
+
+// set keep token in cache and drop entries which are too old
+func (c *tokenCache) set(token ApiToken) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for id, entry := range c.entries {
+		if time.Since(entry.cachedAt) >= tokenCacheTTL {
+			delete(c.entries, id)
+		}
+	}
+	c.entries[token.Id] = cachedToken{token, time.Now()}
+}
+
+func (c *tokenCache) forget(id string) {
+	c.mu.Lock()
+	delete(c.entries, id)
+	c.mu.Unlock()
+}
+
+// Create store a new token and give it with the secret token to send, it is not possible to get it again afterward
+func (s TokenStore) Create(token ApiToken) (ApiToken, string, error) {
+	id := make([]byte, 8)
+	secret := make([]byte, 32)
+	_, err := rand.Read(id)
+	if err == nil {
+		_, err = rand.Read(secret)
+	}
+	if err != nil {
+		return ApiToken{}, "", fmt.Errorf("could not generate token: %s", err.Error())
+	}
+	token.Id = hex.EncodeToString(id)
+	clearToken := TokenPrefix + token.Id + "_" + base64.RawURLEncoding.EncodeToString(secret)
+	token.Hash = hashToken(clearToken)
+	b, _ := json.Marshal(token)
+	var value values.JSON
+	json.Unmarshal(b, &value)
+	_, err = s.credhubClient.SetJSON(s.tokenPath(token.Id), value)
+	if err != nil {
+		return ApiToken{}, "", err
+	}
+	token.Hash = ""
+	return token, clearToken, nil
+}
+
+// Find give token with this id, it gives an error containing `does not exist` when there is none
+func (s TokenStore) Find(id string) (ApiToken, error) {
+	cred, err := s.credhubClient.GetLatestJSON(s.tokenPath(id))
+	if err != nil {
+		return ApiToken{}, err
+	}
+	b, err := json.Marshal(cred.Value)
+	if err != nil {
+		return ApiToken{}, err
+	}
+	var token ApiToken
+	err = json.Unmarshal(b, &token)
+	return token, err
+}
+
+// List give tokens, without their hash, from the most recently created to the oldest
+func (s TokenStore) List() ([]ApiToken, error) {
+	result, err := s.credhubClient.FindByPath(s.basePath + TOKENS_PREFIX)
+	if err != nil {
+		return nil, err
+	}
+	tokens := make([]ApiToken, 0)
+	for _, cred := range result.Credentials {
+		token, err := s.Find(ParseTfName(cred.Name))
+		if err != nil {
+			return nil, err
+		}
+		token.Hash = ""
+		tokens = append(tokens, token)
+	}
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].CreatedAt.After(tokens[j].CreatedAt)
+	})
+	return tokens, nil
+}
+
+// Revoke delete token, it is forgotten by cache of this backend
+func (s TokenStore) Revoke(id string) error {
+	s.cache.forget(id)
+	return s.credhubClient.Delete(s.tokenPath(id))
+}
+
+// Authenticate give identity of the token sent as basic auth password, username is ignored.
+// Tokens which authenticated a caller are cached during tokenCacheTTL, hash and expiry are always checked
+func (s TokenStore) Authenticate(req *http.Request) (*auth.Identity, error) {
+	_, password, ok := req.BasicAuth()
+	if !ok || !strings.HasPrefix(password, TokenPrefix) {
+		return nil, nil
+	}
+	parts := strings.SplitN(strings.TrimPrefix(password, TokenPrefix), "_", 2)
+	if len(parts) != 2 || !validTokenId(parts[0]) {
+		return nil, auth.ErrInvalidCredentials
+	}
+	token, cached := s.cache.get(parts[0])
+	if !cached {
+		var err error
+		token, err = s.WithContext(req.Context()).Find(parts[0])
+		if err != nil && strings.Contains(err.Error(), "does not exist") {
+			return nil, auth.ErrInvalidCredentials
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if subtle.ConstantTimeCompare([]byte(token.Hash), []byte(hashToken(password))) != 1 {
+		return nil, auth.ErrInvalidCredentials
+	}
+	if token.expired() {
+		return nil, fmt.Errorf("%s: token '%s' is expired", auth.ErrInvalidCredentials.Error(), token.Name)
+	}
+	if !cached {
+		s.cache.set(token)
+	}
+	return &auth.Identity{
+		Name:   "token:" + token.Name,
+		Grants: []auth.Grant{token.grant()},
+	}, nil
+}
+
+func (s TokenStore) tokenPath(id string) string {
+	return s.basePath + TOKENS_PREFIX + "/" + id
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func validTokenId(id string) bool {
+	_, err := hex.DecodeString(id)
+	return err == nil && len(id) == 16
+}
+
+// TokenController let admins of all tfstates create, list and revoke api tokens
+type TokenController struct {
+	store *TokenStore
+}
+
+func NewTokenController(store *TokenStore) *TokenController {
+	return &TokenController{store}
+}
+
+// TokenRequest is what is sent to create a token, rights are write and lock when not set
+type TokenRequest struct {
+	Name     string   `json:"name"`
+	Prefixes []string `json:"prefixes"`
+	Rights   []string `json:"rights"`
+	// ExpiresIn is a duration (e.g.: 720h), token never expires when not set
+	ExpiresIn string `json:"expires_in"`
+}
+
+// CreatedToken is given back when a token is created
+type CreatedToken struct {
+	ApiToken
+	Token string `json:"token"`
+}
+
+func (c TokenController) authorize(req *http.Request) error {
+	if auth.FromContext(req.Context()).IsAdmin() {
+		return nil
+	}
+	return NewProblem(http.StatusForbidden, "Only admins of all tfstates can manage api tokens")
+}
+
+func (c TokenController) Create(w http.ResponseWriter, req *http.Request) error {
+	defer req.Body.Close()
+	entry := RequestLogger(req).WithField("action", "create-token")
+	if err := c.authorize(req); err != nil {
+		return err
+	}
+	var tokenReq TokenRequest
+	err := json.NewDecoder(req.Body).Decode(&tokenReq)
+	if err != nil {
+		return NewProblem(http.StatusBadRequest, "Invalid token request given").WithCause(err)
+	}
+	token, err := tokenReq.token()
+	if err != nil {
+		return NewProblem(http.StatusBadRequest, err.Error())
+	}
+	token.CreatedBy = identityName(req)
+	token, clearToken, err := c.store.WithContext(req.Context()).Create(token)
+	if err != nil {
+		entry.Error(err)
+		return err
+	}
+	entry.WithField("token", token.Name).WithField("id", token.Id).Info("Api token created")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	b, _ := json.MarshalIndent(CreatedToken{token, clearToken}, "", "\t")
+	w.Write(b)
+	return nil
+}
+
+func (r TokenRequest) token() (ApiToken, error) {
+	if r.Name == "" {
+		return ApiToken{}, fmt.Errorf("Token must have a name")
+	}
+	if len(r.Prefixes) == 0 {
+		return ApiToken{}, fmt.Errorf("Token must be scoped to at least one prefix, use an empty prefix for all tfstates")
+	}
+	for _, prefix := range r.Prefixes {
+		if strings.ContainsAny(prefix, `*?[\/`) {
+			return ApiToken{}, fmt.Errorf("Prefix '%s' must not contain glob characters or '/'", prefix)
+		}
+	}
+	token := ApiToken{
+		Name:      r.Name,
+		Prefixes:  r.Prefixes,
+		Rights:    r.Rights,
+		CreatedAt: time.Now().UTC().Truncate(time.Second),
+	}
+	if len(token.Rights) == 0 {
+		token.Rights = []string{auth.RightWrite, auth.RightLock}
+	}
+	err := token.grant().Validate()
+	if err != nil {
+		return ApiToken{}, err
+	}
+	if r.ExpiresIn != "" {
+		expiresIn, err := time.ParseDuration(r.ExpiresIn)
+		if err != nil || expiresIn <= 0 {
+			return ApiToken{}, fmt.Errorf("Invalid expires_in '%s', it must be a positive duration", r.ExpiresIn)
+		}
+		expiresAt := token.CreatedAt.Add(expiresIn)
+		token.ExpiresAt = &expiresAt
+	}
+	return token, nil
+}
+
+func (c TokenController) List(w http.ResponseWriter, req *http.Request) error {
+	entry := RequestLogger(req).WithField("action", "list-tokens")
+	if err := c.authorize(req); err != nil {
+		return err
+	}
+	tokens, err := c.store.WithContext(req.Context()).List()
+	if err != nil {
+		entry.Error(err)
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	b, _ := json.MarshalIndent(tokens, "", "\t")
+	w.Write(b)
+	return nil
+}
+
+func (c TokenController) Revoke(w http.ResponseWriter, req *http.Request) error {
+	id := mux.Vars(req)["id"]
+	entry := RequestLogger(req).WithField("action", "revoke-token").WithField("id", id)
+	if err := c.authorize(req); err != nil {
+		return err
+	}
+	if !validTokenId(id) {
+		return NewProblem(http.StatusNotFound, fmt.Sprintf("Token '%s' does not exist", id))
+	}
+	store := c.store.WithContext(req.Context())
+	token, err := store.Find(id)
+	if err != nil && strings.Contains(err.Error(), "does not exist") {
+		return NewProblem(http.StatusNotFound, fmt.Sprintf("Token '%s' does not exist", id))
+	}
+	if err != nil {
+		entry.Error(err)
+		return err
+	}
+	err = store.Revoke(id)
+	if err != nil {
+		entry.Error(err)
+		return err
+	}
+	entry.WithField("token", token.Name).Info("Api token revoked")
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
@@ -0,0 +1,134 @@
+package server_test
+
+import (
+	"bytes"
+	"code.cloudfoundry.org/credhub-cli/credhub/credentials"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/orange-cloudfoundry/terraform-secure-backend/server"
+	"github.com/orange-cloudfoundry/terraform-secure-backend/server/auth"
+	"github.com/orange-cloudfoundry/terraform-secure-backend/server/credhub/credhubfakes"
+	"net/http"
+	"net/http/httptest"
+	"time"
+)
+
+var _ = Describe("Tokens", func() {
+	var fakeClient *credhubfakes.FakeCredhubClient
+	var tokenStore *TokenStore
+	var tokenController *TokenController
+	var responseRecorder *httptest.ResponseRecorder
+	var identity *auth.Identity
+	problemWriter := NewProblemWriter(true)
+	handle := func(handler func(http.ResponseWriter, *http.Request) error) http.HandlerFunc {
+		return func(w http.ResponseWriter, req *http.Request) {
+			problemWriter.Handle(handler)(w, req.WithContext(auth.WithIdentity(req.Context(), identity)))
+		}
+	}
+	create := func(body string) CreatedToken {
+		handle(tokenController.Create)(responseRecorder, httptest.NewRequest("POST", "http://fakeurl.com/tokens", bytes.NewBufferString(body)))
+		Expect(responseRecorder.Code).Should(Equal(http.StatusCreated))
+		var created CreatedToken
+		err := json.Unmarshal(responseRecorder.Body.Bytes(), &created)
+		Expect(err).ShouldNot(HaveOccurred())
+		// make credhub give back what has been stored
+		_, value := fakeClient.SetJSONArgsForCall(fakeClient.SetJSONCallCount() - 1)
+		fakeClient.GetLatestJSONReturns(credentials.JSON{Value: value}, nil)
+		return created
+	}
+	authenticate := func(password string) (*auth.Identity, error) {
+		req := httptest.NewRequest("GET", "http://fakeurl.com/states/foo", nil)
+		req.SetBasicAuth("terraform", password)
+		return tokenStore.Authenticate(req)
+	}
+	BeforeEach(func() {
+		responseRecorder = httptest.NewRecorder()
+		fakeClient = new(credhubfakes.FakeCredhubClient)
+		tokenStore = NewTokenStore("test", fakeClient)
+		tokenController = NewTokenController(tokenStore)
+		identity = &auth.Identity{Name: "admin", Grants: []auth.Grant{{States: []string{"*"}, Rights: []string{auth.RightAdmin}}}}
+	})
+	It("should create a token stored hashed under reserved path", func() {
+		created := create(`{"name": "ci", "prefixes": ["team-a-"]}`)
+
+		Expect(created.Token).Should(HavePrefix(TokenPrefix + created.Id + "_"))
+		Expect(created.Rights).Should(ConsistOf(auth.RightWrite, auth.RightLock))
+		Expect(created.CreatedBy).Should(Equal("admin"))
+		path, value := fakeClient.SetJSONArgsForCall(0)
+		Expect(path).Should(Equal("test/.tokens/" + created.Id))
+		b, _ := json.Marshal(value)
+		Expect(string(b)).ShouldNot(ContainSubstring(created.Token))
+		Expect(value["hash"]).ShouldNot(BeEmpty())
+	})
+	It("should authenticate token sent as basic auth password with rights on its prefixes", func() {
+		created := create(`{"name": "ci", "prefixes": ["team-a-"], "rights": ["read"]}`)
+
+		tokenIdentity, err := authenticate(created.Token)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(tokenIdentity.Name).Should(Equal("token:ci"))
+		Expect(tokenIdentity.Can(auth.RightRead, "team-a-network")).Should(BeTrue())
+		Expect(tokenIdentity.Can(auth.RightWrite, "team-a-network")).Should(BeFalse())
+		Expect(tokenIdentity.Can(auth.RightRead, "team-b-network")).Should(BeFalse())
+	})
+	It("should refuse wrong, revoked or expired tokens and ignore other passwords", func() {
+		created := create(`{"name": "ci", "prefixes": [""], "expires_in": "1h"}`)
+		_, err := authenticate(created.Token + "x")
+		Expect(err).Should(HaveOccurred())
+
+		var stored map[string]interface{}
+		_, value := fakeClient.SetJSONArgsForCall(0)
+		b, _ := json.Marshal(value)
+		json.Unmarshal(b, &stored)
+		stored["expires_at"] = time.Now().Add(-time.Minute).Format(time.RFC3339)
+		fakeClient.GetLatestJSONReturns(credentials.JSON{Value: stored}, nil)
+		_, err = authenticate(created.Token)
+		Expect(err).Should(HaveOccurred())
+
+		fakeClient.GetLatestJSONReturns(credentials.JSON{}, errors.New("The request could not be completed because the credential does not exist"))
+		_, err = authenticate(created.Token)
+		Expect(err).Should(Equal(auth.ErrInvalidCredentials))
+
+		tokenIdentity, err := authenticate("a password")
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(tokenIdentity).Should(BeNil())
+	})
+	It("should refuse invalid token requests", func() {
+		for _, body := range []string{`{"prefixes": [""]}`, `{"name": "ci"}`, `{"name": "ci", "prefixes": ["team-*"]}`, `{"name": "ci", "prefixes": [""], "rights": ["delete"]}`, `{"name": "ci", "prefixes": [""], "expires_in": "-1h"}`} {
+			responseRecorder = httptest.NewRecorder()
+			handle(tokenController.Create)(responseRecorder, httptest.NewRequest("POST", "http://fakeurl.com/tokens", bytes.NewBufferString(body)))
+			Expect(responseRecorder.Code).Should(Equal(http.StatusBadRequest), body)
+		}
+	})
+	It("should revoke token", func() {
+		created := create(`{"name": "ci", "prefixes": [""]}`)
+		responseRecorder = httptest.NewRecorder()
+		req := mux.SetURLVars(httptest.NewRequest("DELETE", "http://fakeurl.com/tokens/"+created.Id, nil), map[string]string{"id": created.Id})
+		handle(tokenController.Revoke)(responseRecorder, req)
+
+		Expect(responseRecorder.Code).Should(Equal(http.StatusNoContent))
+		Expect(fakeClient.DeleteArgsForCall(0)).Should(Equal("test/.tokens/" + created.Id))
+	})
+	It("should not read again in credhub a token which authenticated a caller until it is revoked", func() {
+		created := create(`{"name": "ci", "prefixes": [""]}`)
+		for i := 0; i < 3; i++ {
+			_, err := authenticate(created.Token)
+			Expect(err).ShouldNot(HaveOccurred())
+		}
+		Expect(fakeClient.GetLatestJSONCallCount()).Should(Equal(1))
+
+		req := mux.SetURLVars(httptest.NewRequest("DELETE", "http://fakeurl.com/tokens/"+created.Id, nil), map[string]string{"id": created.Id})
+		handle(tokenController.Revoke)(responseRecorder, req)
+		fakeClient.GetLatestJSONReturns(credentials.JSON{}, errors.New("The request could not be completed because the credential does not exist"))
+
+		_, err := authenticate(created.Token)
+		Expect(err).Should(Equal(auth.ErrInvalidCredentials))
+	})
+	It("should only let admins of all tfstates manage tokens", func() {
+		identity = &auth.Identity{Name: "team-a", Grants: []auth.Grant{{States: []string{"team-a-*"}, Rights: []string{auth.RightAdmin}}}}
+		handle(tokenController.List)(responseRecorder, httptest.NewRequest("GET", "http://fakeurl.com/tokens", nil))
+		Expect(responseRecorder.Code).Should(Equal(http.StatusForbidden))
+	})
+})
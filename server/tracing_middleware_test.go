@@ -0,0 +1,45 @@
+package server_test
+
+import (
+	"github.com/gorilla/mux"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/orange-cloudfoundry/terraform-secure-backend/server"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"net/http/httptest"
+)
+
+var _ = Describe("TracingMiddleware", func() {
+	var recorder *tracetest.SpanRecorder
+	BeforeEach(func() {
+		recorder = tracetest.NewSpanRecorder()
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	})
+	AfterEach(func() {
+		otel.SetTracerProvider(sdktrace.NewTracerProvider())
+	})
+	It("should create a span for request as child of incoming W3C trace context", func() {
+		var handlerSpan trace.SpanContext
+		rtr := mux.NewRouter()
+		rtr.Use(TracingMiddleware)
+		rtr.HandleFunc("/states/{name}", func(w http.ResponseWriter, req *http.Request) {
+			handlerSpan = trace.SpanContextFromContext(req.Context())
+			w.WriteHeader(http.StatusNoContent)
+		})
+		req := httptest.NewRequest("GET", "http://fakeurl.com/states/foo", nil)
+		req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+		rtr.ServeHTTP(httptest.NewRecorder(), req)
+
+		Expect(recorder.Ended()).To(HaveLen(1))
+		span := recorder.Ended()[0]
+		Expect(span.Name()).To(Equal("GET /states/{name}"))
+		Expect(span.SpanContext().TraceID().String()).To(Equal("4bf92f3577b34da6a3ce929d0e0e4736"))
+		Expect(span.Parent().SpanID().String()).To(Equal("00f067aa0ba902b7"))
+		Expect(handlerSpan.SpanID()).To(Equal(span.SpanContext().SpanID()))
+	})
+})
@@ -0,0 +1,43 @@
+package server
+
+import (
+	"github.com/orange-cloudfoundry/terraform-secure-backend/server/storer"
+	log "github.com/sirupsen/logrus"
+)
+
+// copyState rewrite through the storer the state found at src to dst
+func copyState(s storer.Storer, src, dst string) error {
+	r, err := s.Retrieve(src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return s.Store(dst, r)
+}
+
+// copyStateHistory rewrite through the storer every versions of the state found at src to dst
+// from the oldest to the newest, older versions which can't be retrieved anymore are skipped and logged with logger
+func copyStateHistory(s storer.Storer, src, dst string, logger *log.Entry) error {
+	versions, err := s.Versions(src)
+	if err != nil {
+		logger.WithField("path", src).Warnf("History can't be copied: %s", err.Error())
+		versions = []storer.Version{}
+	}
+	for i := len(versions) - 1; i > 0; i-- {
+		err := copyStateVersion(s, src, dst, versions[i].ID)
+		if err != nil {
+			logger.WithField("path", src).WithField("version", versions[i].ID).
+				Warnf("Version skipped when copying history: %s", err.Error())
+		}
+	}
+	return copyState(s, src, dst)
+}
+
+func copyStateVersion(s storer.Storer, src, dst, id string) error {
+	r, err := s.RetrieveVersion(src, id)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return s.Store(dst, r)
+}
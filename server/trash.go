@@ -0,0 +1,165 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"github.com/orange-cloudfoundry/terraform-secure-backend/server/credhub"
+	"github.com/orange-cloudfoundry/terraform-secure-backend/server/storer"
+	log "github.com/sirupsen/logrus"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	TRASH_PREFIX = "/.trash"
+	// DefaultTrashRetention is the time a deleted state is kept in trash when no retention is configured
+	DefaultTrashRetention = 7 * 24 * time.Hour
+)
+
+type TrashEntry struct {
+	Name      string    `json:"name"`
+	DeletedAt time.Time `json:"deleted_at"`
+	ExpireAt  time.Time `json:"expire_at"`
+}
+
+// Trash keep deleted states under TRASH_PREFIX of the base path for a retention period,
+// each deleted state is stored at <base path>/.trash/<name>/<deletion unix timestamp in nanoseconds>
+type Trash struct {
+	basePath      string
+	storer        storer.Storer
+	credhubClient credhub.CredhubClient
+	retention     time.Duration
+}
+
+func NewTrash(basePath string, credhubClient credhub.CredhubClient, storer storer.Storer, retention time.Duration) *Trash {
+	if retention <= 0 {
+		retention = DefaultTrashRetention
+	}
+	return &Trash{basePath, storer, credhubClient, retention}
+}
+
+func (t Trash) WithContext(ctx context.Context) *Trash {
+	return &Trash{t.basePath, storer.WithContext(t.storer, ctx), credhub.WithContext(t.credhubClient, ctx), t.retention}
+}
+
+// Put move the state found at path with given name inside the trash, with its history
+func (t Trash) Put(path, name string, logger *log.Entry) (TrashEntry, error) {
+	entry := t.newEntry(name, time.Now())
+	err := copyStateHistory(t.storer, path, t.entryPath(entry), logger)
+	if err != nil {
+		return entry, err
+	}
+	return entry, t.storer.Delete(path)
+}
+
+// List give entries in trash from the most recently deleted to the oldest
+func (t Trash) List() ([]TrashEntry, error) {
+	result, err := t.credhubClient.FindByPath(t.trashPath())
+	if err != nil {
+		return nil, err
+	}
+	prefix := strings.TrimPrefix(t.trashPath(), "/") + "/"
+	entries := make([]TrashEntry, 0)
+	for _, cred := range result.Credentials {
+		name := strings.TrimPrefix(strings.TrimPrefix(cred.Name, "/"), prefix)
+		splited := strings.Split(name, "/")
+		if len(splited) != 3 || splited[2] != "index" {
+			continue
+		}
+		timestamp, err := strconv.ParseInt(splited[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		entries = append(entries, t.newEntry(splited[0], time.Unix(0, timestamp)))
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].DeletedAt.After(entries[j].DeletedAt)
+	})
+	return entries, nil
+}
+
+// Find give the most recently deleted entry with this name,
+// if deletedAt is not zero only entry deleted at this time is given,
+// a deletedAt without fraction of second gives the most recent entry deleted during this second
+func (t Trash) Find(name string, deletedAt time.Time) (TrashEntry, bool, error) {
+	entries, err := t.List()
+	if err != nil {
+		return TrashEntry{}, false, err
+	}
+	for _, entry := range entries {
+		if entry.Name != name {
+			continue
+		}
+		if !deletedAt.IsZero() && !sameDeletion(entry.DeletedAt, deletedAt) {
+			continue
+		}
+		return entry, true, nil
+	}
+	return TrashEntry{}, false, nil
+}
+
+func sameDeletion(entryDeletedAt, deletedAt time.Time) bool {
+	if deletedAt.Nanosecond() == 0 {
+		return entryDeletedAt.Truncate(time.Second).Equal(deletedAt)
+	}
+	return entryDeletedAt.Equal(deletedAt)
+}
+
+// Restore move back entry from trash to path, with its history
+func (t Trash) Restore(entry TrashEntry, path string, logger *log.Entry) error {
+	err := copyStateHistory(t.storer, t.entryPath(entry), path, logger)
+	if err != nil {
+		return err
+	}
+	return t.storer.Delete(t.entryPath(entry))
+}
+
+// Purge delete definitely entries which exceed retention period
+func (t Trash) Purge() error {
+	entries, err := t.List()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, entry := range entries {
+		if entry.ExpireAt.After(now) {
+			continue
+		}
+		log.WithField("action", "purge").WithField("name", entry.Name).Debug("Purging tfstate from trash")
+		err = t.storer.Delete(t.entryPath(entry))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PurgeEvery run Purge now and then at each interval, this never returns
+func (t Trash) PurgeEvery(interval time.Duration) {
+	for {
+		err := t.Purge()
+		if err != nil {
+			log.WithField("action", "purge").Errorf("Error when purging trash: %s", err.Error())
+		}
+		time.Sleep(interval)
+	}
+}
+
+func (t Trash) newEntry(name string, deletedAt time.Time) TrashEntry {
+	deletedAt = deletedAt.UTC().Round(0)
+	return TrashEntry{
+		Name:      name,
+		DeletedAt: deletedAt,
+		ExpireAt:  deletedAt.Add(t.retention),
+	}
+}
+
+func (t Trash) trashPath() string {
+	return t.basePath + TRASH_PREFIX
+}
+
+func (t Trash) entryPath(entry TrashEntry) string {
+	return fmt.Sprintf("%s/%s/%d", t.trashPath(), entry.Name, entry.DeletedAt.UnixNano())
+}
@@ -0,0 +1,130 @@
+package server_test
+
+import (
+	"code.cloudfoundry.org/credhub-cli/credhub/credentials"
+	"code.cloudfoundry.org/credhub-cli/credhub/credentials/values"
+	"errors"
+	"fmt"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/orange-cloudfoundry/terraform-secure-backend/server"
+	"github.com/orange-cloudfoundry/terraform-secure-backend/server/credhub/credhubfakes"
+	"github.com/orange-cloudfoundry/terraform-secure-backend/server/storer"
+	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"time"
+)
+
+var _ = Describe("Trash", func() {
+	var fakeClient *credhubfakes.FakeCredhubClient
+	var trash *Trash
+	logger := log.NewEntry(log.StandardLogger())
+	BeforeEach(func() {
+		fakeClient = new(credhubfakes.FakeCredhubClient)
+		trash = NewTrash("test", fakeClient, storer.NewCredhub(fakeClient), time.Hour)
+	})
+	Context("Put and Restore", func() {
+		It("should move state with its history", func() {
+			fakeClient.GetAllVersionsReturns([]credentials.Credential{
+				{Metadata: credentials.Metadata{Id: "v3"}},
+				{Metadata: credentials.Metadata{Id: "v2"}},
+				{Metadata: credentials.Metadata{Id: "v1"}},
+			}, nil)
+			fakeClient.GetByIdStub = func(id string) (credentials.Credential, error) {
+				return credentials.Credential{Metadata: credentials.Metadata{Base: credentials.Base{Name: "test/foo"}}, Value: map[string]interface{}{"version": id}}, nil
+			}
+			fakeClient.GetLatestJSONReturns(credentials.JSON{Value: values.JSON{"version": "v3"}}, nil)
+
+			entry, err := trash.Put("test/foo", "foo", logger)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(fakeClient.SetJSONCallCount()).Should(Equal(3))
+			for i, version := range []string{"v1", "v2", "v3"} {
+				path, value := fakeClient.SetJSONArgsForCall(i)
+				Expect(path).Should(HavePrefix("test" + TRASH_PREFIX + "/foo/"))
+				Expect(value).Should(Equal(values.JSON{"version": version}))
+			}
+			Expect(fakeClient.DeleteArgsForCall(0)).Should(Equal("test/foo"))
+
+			fakeClient.GetByIdStub = func(id string) (credentials.Credential, error) {
+				path, _ := fakeClient.SetJSONArgsForCall(0)
+				return credentials.Credential{Metadata: credentials.Metadata{Base: credentials.Base{Name: path}}, Value: map[string]interface{}{"version": id}}, nil
+			}
+			err = trash.Restore(entry, "test/foo", logger)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(fakeClient.SetJSONCallCount()).Should(Equal(6))
+			for i := 3; i < 6; i++ {
+				path, _ := fakeClient.SetJSONArgsForCall(i)
+				Expect(path).Should(Equal("test/foo"))
+			}
+		})
+	})
+	Context("Put", func() {
+		It("should not mix up states deleted during the same second", func() {
+			fakeClient.GetAllVersionsReturns(nil, errors.New("does not exist"))
+
+			entry1, err := trash.Put("test/foo", "foo", logger)
+			Expect(err).ToNot(HaveOccurred())
+			entry2, err := trash.Put("test/foo", "foo", logger)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(entry1.DeletedAt).ShouldNot(Equal(entry2.DeletedAt))
+			path1, _ := fakeClient.SetJSONArgsForCall(0)
+			path2, _ := fakeClient.SetJSONArgsForCall(1)
+			Expect(path1).ShouldNot(Equal(path2))
+		})
+		It("should log with given logger when history can't be copied", func() {
+			oldHooks := log.StandardLogger().ReplaceHooks(log.LevelHooks{})
+			defer log.StandardLogger().ReplaceHooks(oldHooks)
+			hook := test.NewLocal(log.StandardLogger())
+			fakeClient.GetAllVersionsReturns(nil, errors.New("a fake error"))
+
+			_, err := trash.Put("test/foo", "foo", logger.WithField("request_id", "my-id"))
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(hook.LastEntry()).ShouldNot(BeNil())
+			Expect(hook.LastEntry().Data["request_id"]).Should(Equal("my-id"))
+		})
+	})
+	Context("Find", func() {
+		BeforeEach(func() {
+			fakeClient.FindByPathReturns(credentials.FindResults{Credentials: []credentials.Base{
+				{Name: "/test/.trash/foo/2000000000100/index"},
+				{Name: "/test/.trash/foo/2000000000200/index"},
+			}}, nil)
+		})
+		It("should give entry deleted at the exact time asked", func() {
+			entry, found, err := trash.Find("foo", time.Unix(2000, 100))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(found).To(BeTrue())
+			Expect(entry.DeletedAt.UnixNano()).Should(Equal(int64(2000000000100)))
+		})
+		It("should give the most recent entry deleted during the second asked", func() {
+			entry, found, err := trash.Find("foo", time.Unix(2000, 0))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(found).To(BeTrue())
+			Expect(entry.DeletedAt.UnixNano()).Should(Equal(int64(2000000000200)))
+		})
+	})
+	Context("Purge", func() {
+		It("should only delete entries which exceed retention", func() {
+			recent := time.Now().Add(-30 * time.Minute).UnixNano()
+			fakeClient.FindByPathReturns(credentials.FindResults{Credentials: []credentials.Base{
+				{Name: "/test/.trash/foo/1000000000000/index"},
+				{Name: fmt.Sprintf("/test/.trash/bar/%d/index", recent)},
+			}}, nil)
+
+			err := trash.Purge()
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(fakeClient.DeleteCallCount()).Should(Equal(1))
+			Expect(fakeClient.DeleteArgsForCall(0)).Should(Equal("test" + TRASH_PREFIX + "/foo/1000000000000"))
+		})
+		It("should return an error when listing trash was in error", func() {
+			fakeClient.FindByPathReturns(credentials.FindResults{}, errors.New("a fake error"))
+
+			err := trash.Purge()
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
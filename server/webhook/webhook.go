@@ -0,0 +1,259 @@
+// Package webhook notify external services (e.g.: chatops) of events happening on tfstates and locks
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/hashicorp/terraform/state"
+	"github.com/orange-cloudfoundry/terraform-secure-backend/server/metrics"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"sync"
+	"time"
+)
+
+const (
+	EventStore       = "store"
+	EventDelete      = "delete"
+	EventLock        = "lock"
+	EventUnlock      = "unlock"
+	EventForceUnlock = "force-unlock"
+	// EventLockHeld is sent when a lock is held longer than configured duration
+	EventLockHeld = "lock-held"
+
+	SignatureHeader = "X-Webhook-Signature"
+	EventHeader     = "X-Webhook-Event"
+	DeliveryHeader  = "X-Webhook-Delivery"
+
+	DefaultMaxRetries   = 3
+	DefaultRetryBackoff = time.Second
+	DefaultTimeout      = 10 * time.Second
+)
+
+var events = []string{EventStore, EventDelete, EventLock, EventUnlock, EventForceUnlock, EventLockHeld}
+
+// Config describe a webhook, all events and all states are sent when Events or States are empty.
+// Secret is mandatory, it signs every payload sent
+type Config struct {
+	URL    string   `json:"url" yaml:"url"`
+	Secret string   `json:"secret" yaml:"secret"`
+	Events []string `json:"events" yaml:"events"`
+	// States are globs matched against state names, e.g.: `prod-*`
+	States     []string `json:"states" yaml:"states"`
+	MaxRetries int      `json:"max_retries" yaml:"max_retries"`
+	// RetryBackoff is the wait before first retry, it is doubled at each retry
+	RetryBackoff      string `json:"retry_backoff" yaml:"retry_backoff"`
+	Timeout           string `json:"timeout" yaml:"timeout"`
+	SkipSslValidation bool   `json:"skip_ssl_validation" yaml:"skip_ssl_validation"`
+}
+
+// Event is the payload sent as json to webhooks
+type Event struct {
+	Event     string          `json:"event"`
+	State     string          `json:"state"`
+	Tenant    string          `json:"tenant,omitempty"`
+	Time      time.Time       `json:"time"`
+	User      string          `json:"user,omitempty"`
+	RequestId string          `json:"request_id,omitempty"`
+	Lock      *state.LockInfo `json:"lock,omitempty"`
+}
+
+type hook struct {
+	config     Config
+	client     *http.Client
+	maxRetries int
+	backoff    time.Duration
+}
+
+// Notifier send events to webhooks in background, a nil Notifier send nothing
+type Notifier struct {
+	hooks []hook
+	wg    sync.WaitGroup
+}
+
+func NewNotifier(configs []Config) (*Notifier, error) {
+	n := &Notifier{}
+	for _, config := range configs {
+		h, err := newHook(config)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid webhook '%s': %s", config.URL, err.Error())
+		}
+		n.hooks = append(n.hooks, h)
+	}
+	return n, nil
+}
+
+func newHook(config Config) (hook, error) {
+	h := hook{
+		config:     config,
+		maxRetries: config.MaxRetries,
+		backoff:    DefaultRetryBackoff,
+	}
+	u, err := url.Parse(config.URL)
+	if err != nil {
+		return h, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return h, fmt.Errorf("url must be an http or https url")
+	}
+	if config.Secret == "" {
+		return h, fmt.Errorf("secret must be set to sign payloads")
+	}
+	for _, event := range config.Events {
+		if !contains(events, event) {
+			return h, fmt.Errorf("unknown event '%s'", event)
+		}
+	}
+	for _, glob := range config.States {
+		if _, err := path.Match(glob, ""); err != nil {
+			return h, fmt.Errorf("invalid state glob '%s': %s", glob, err.Error())
+		}
+	}
+	if h.maxRetries <= 0 {
+		h.maxRetries = DefaultMaxRetries
+	}
+	if config.RetryBackoff != "" {
+		h.backoff, err = time.ParseDuration(config.RetryBackoff)
+		if err != nil {
+			return h, fmt.Errorf("invalid retry_backoff: %s", err.Error())
+		}
+	}
+	timeout := DefaultTimeout
+	if config.Timeout != "" {
+		timeout, err = time.ParseDuration(config.Timeout)
+		if err != nil {
+			return h, fmt.Errorf("invalid timeout: %s", err.Error())
+		}
+	}
+	h.client = &http.Client{Timeout: timeout}
+	if config.SkipSslValidation {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig.InsecureSkipVerify = true
+		h.client.Transport = transport
+	}
+	return h, nil
+}
+
+// Notify send event to each webhook interested in it without waiting for them to answer
+func (n *Notifier) Notify(event Event) {
+	if n == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	var b []byte
+	for _, h := range n.hooks {
+		if !h.accept(event) {
+			continue
+		}
+		if b == nil {
+			b, _ = json.Marshal(event)
+		}
+		n.wg.Add(1)
+		go func(h hook) {
+			defer n.wg.Done()
+			h.deliver(event, b)
+		}(h)
+	}
+}
+
+// Wait until all events sent have been delivered or given up
+func (n *Notifier) Wait() {
+	if n == nil {
+		return
+	}
+	n.wg.Wait()
+}
+
+func (h hook) accept(event Event) bool {
+	if len(h.config.Events) > 0 && !contains(h.config.Events, event.Event) {
+		return false
+	}
+	if len(h.config.States) == 0 {
+		return true
+	}
+	for _, glob := range h.config.States {
+		if ok, _ := path.Match(glob, event.State); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (h hook) deliver(event Event, payload []byte) {
+	entry := log.WithField("action", "webhook").
+		WithField("event", event.Event).
+		WithField("name", event.State).
+		WithField("url", h.config.URL)
+	delivery := newDeliveryId()
+	backoff := h.backoff
+	var err error
+	for attempt := 0; attempt <= h.maxRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		err = h.send(event.Event, delivery, payload)
+		if err == nil {
+			metrics.WebhookDeliveries.WithLabelValues(event.Event, "success").Inc()
+			entry.Debug("Webhook delivered")
+			return
+		}
+		entry.Debugf("Webhook delivery attempt %d failed: %s", attempt+1, err.Error())
+	}
+	metrics.WebhookDeliveries.WithLabelValues(event.Event, "error").Inc()
+	entry.Errorf("Giving up webhook delivery after %d attempts: %s", h.maxRetries+1, err.Error())
+}
+
+func (h hook) send(event, delivery string, payload []byte) error {
+	req, err := http.NewRequest("POST", h.config.URL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, event)
+	req.Header.Set(DeliveryHeader, delivery)
+	req.Header.Set(SignatureHeader, "sha256="+Sign(h.config.Secret, payload))
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("receiver answered with status code %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Sign give the hex encoded HMAC-SHA256 of payload, receivers compare it to the X-Webhook-Signature header
+func Sign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+func newDeliveryId() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,96 @@
+package webhook_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/orange-cloudfoundry/terraform-secure-backend/server/webhook"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+)
+
+type receivedCall struct {
+	header http.Header
+	body   []byte
+}
+
+var _ = Describe("Notifier", func() {
+	log.SetOutput(ioutil.Discard)
+	var receiver *httptest.Server
+	var mu sync.Mutex
+	var calls []receivedCall
+	var failures int
+	BeforeEach(func() {
+		calls = nil
+		failures = 0
+		receiver = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+			b, _ := ioutil.ReadAll(req.Body)
+			calls = append(calls, receivedCall{req.Header, b})
+			if failures > 0 {
+				failures--
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		}))
+	})
+	AfterEach(func() {
+		receiver.Close()
+	})
+	notify := func(config Config, event Event) {
+		notifier, err := NewNotifier([]Config{config})
+		Expect(err).ShouldNot(HaveOccurred())
+		notifier.Notify(event)
+		notifier.Wait()
+	}
+	It("should send event signed with secret", func() {
+		notify(Config{URL: receiver.URL, Secret: "my-secret"}, Event{Event: EventStore, State: "prod"})
+
+		Expect(calls).Should(HaveLen(1))
+		Expect(calls[0].body).Should(ContainSubstring(`"event":"store"`))
+		Expect(calls[0].body).Should(ContainSubstring(`"state":"prod"`))
+		Expect(calls[0].header.Get(EventHeader)).Should(Equal(EventStore))
+		Expect(calls[0].header.Get(DeliveryHeader)).ShouldNot(BeEmpty())
+		Expect(calls[0].header.Get(SignatureHeader)).Should(Equal("sha256=" + Sign("my-secret", calls[0].body)))
+	})
+	It("should only send events and states matching filters", func() {
+		config := Config{URL: receiver.URL, Secret: "my-secret", Events: []string{EventLock, EventForceUnlock}, States: []string{"prod-*"}}
+		notify(config, Event{Event: EventLock, State: "prod-network"})
+		notify(config, Event{Event: EventStore, State: "prod-network"})
+		notify(config, Event{Event: EventLock, State: "dev-network"})
+
+		Expect(calls).Should(HaveLen(1))
+		Expect(calls[0].body).Should(ContainSubstring(`"state":"prod-network"`))
+	})
+	It("should retry until receiver accepts event", func() {
+		failures = 2
+		notify(Config{URL: receiver.URL, Secret: "my-secret", MaxRetries: 3, RetryBackoff: "1ms"}, Event{Event: EventDelete, State: "prod"})
+
+		Expect(calls).Should(HaveLen(3))
+		Expect(calls[2].header.Get(DeliveryHeader)).Should(Equal(calls[0].header.Get(DeliveryHeader)))
+	})
+	It("should give up after max retries", func() {
+		failures = 10
+		notify(Config{URL: receiver.URL, Secret: "my-secret", MaxRetries: 2, RetryBackoff: "1ms"}, Event{Event: EventDelete, State: "prod"})
+
+		Expect(calls).Should(HaveLen(3))
+	})
+	It("should refuse invalid config", func() {
+		_, err := NewNotifier([]Config{{URL: "ftp://receiver", Secret: "my-secret"}})
+		Expect(err).Should(HaveOccurred())
+		_, err = NewNotifier([]Config{{URL: receiver.URL, Secret: "my-secret", Events: []string{"unknown"}}})
+		Expect(err).Should(HaveOccurred())
+		_, err = NewNotifier([]Config{{URL: receiver.URL, Secret: "my-secret", States: []string{"["}}})
+		Expect(err).Should(HaveOccurred())
+		_, err = NewNotifier([]Config{{URL: receiver.URL}})
+		Expect(err).Should(HaveOccurred())
+	})
+	It("should send nothing when notifier is nil", func() {
+		var notifier *Notifier
+		notifier.Notify(Event{Event: EventStore, State: "prod"})
+		notifier.Wait()
+		Expect(calls).Should(BeEmpty())
+	})
+})